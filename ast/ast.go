@@ -1,6 +1,10 @@
 package ast
 
-import "bytes"
+import (
+	"strings"
+
+	"github.com/Serein-sz/knife/token"
+)
 
 type Node interface {
 	Line() int
@@ -10,6 +14,8 @@ type Node interface {
 
 type Program struct {
 	Statements []Statement
+	// Comments holds every line comment of the source, in order.
+	Comments []*Comment
 }
 
 func (p *Program) Line() int {
@@ -17,15 +23,26 @@ func (p *Program) Line() int {
 }
 
 func (p *Program) String() string {
-	var out bytes.Buffer
-
+	statements := make([]string, 0, len(p.Statements))
 	for _, s := range p.Statements {
-		out.WriteString(s.String())
+		statements = append(statements, s.String())
 	}
-
-	return out.String()
+	return strings.Join(statements, "\n")
 }
 
 func (p *Program) TokenLiteral() string {
 	return p.Statements[0].TokenLiteral()
 }
+
+type Comment struct {
+	Token token.Token
+}
+
+func (c *Comment) Line() int {
+	return c.Token.Line
+}
+
+// Text returns the comment without the leading slashes and spaces.
+func (c *Comment) Text() string {
+	return strings.TrimSpace(strings.TrimPrefix(c.Token.Literal, "//"))
+}
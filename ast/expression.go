@@ -2,7 +2,6 @@ package ast
 
 import (
 	"bytes"
-	"strings"
 
 	"github.com/Serein-sz/knife/token"
 )
@@ -15,6 +14,27 @@ type Expression interface {
 type Identifier struct {
 	Token token.Token
 	Value string
+	// Binding is filled in by the resolver.
+	Binding Binding
+}
+
+type BindingKind uint8
+
+const (
+	// Unresolved identifiers are looked up by name at run time.
+	Unresolved BindingKind = iota
+	// Local identifiers live in slot Slot of the function frame Depth
+	// frames above the current one.
+	Local
+	// Global identifiers are looked up by name in the environment Depth
+	// frames above the current one, then among the builtins.
+	Global
+)
+
+type Binding struct {
+	Kind  BindingKind
+	Depth int
+	Slot  int
 }
 
 func (i *Identifier) Line() int {
@@ -50,6 +70,25 @@ func (n *Null) String() string {
 
 func (n *Null) expressionNode() {}
 
+type Boolean struct {
+	Token token.Token
+	Value bool
+}
+
+func (b *Boolean) Line() int {
+	return b.Token.Line
+}
+
+func (b *Boolean) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+func (b *Boolean) String() string {
+	return b.Token.Literal
+}
+
+func (b *Boolean) expressionNode() {}
+
 type NumberLiteral struct {
 	Token token.Token
 	Value string
@@ -83,7 +122,7 @@ func (sl *StringLiteral) TokenLiteral() string {
 }
 
 func (sl *StringLiteral) String() string {
-	return sl.Value
+	return `"` + sl.Value + `"`
 }
 
 func (sl *StringLiteral) expressionNode() {}
@@ -92,6 +131,7 @@ type FunctionCallExpression struct {
 	Token     token.Token
 	Arguments []Expression
 	Function  Expression
+	RParen    token.Token
 }
 
 func (fce *FunctionCallExpression) Line() int {
@@ -107,17 +147,26 @@ func (ce *FunctionCallExpression) String() string {
 	out.WriteString(ce.Function.String())
 	out.WriteString("(")
 	for index, expression := range ce.Arguments {
-		out.WriteString(strings.ReplaceAll(expression.String(), "\n", ""))
+		out.WriteString(expression.String())
 		if index != len(ce.Arguments)-1 {
 			out.WriteString(", ")
 		}
 	}
-	out.WriteString(")\n")
+	out.WriteString(")")
 	return out.String()
 }
 
 func (ce *FunctionCallExpression) expressionNode() {}
 
+// Span returns the source range of the call, from the start of the called
+// expression to the closing parenthesis.
+func (ce *FunctionCallExpression) Span() Span {
+	return Span{
+		Start: tokenSpan(firstToken(ce.Function)).Start,
+		End:   tokenSpan(ce.RParen).End,
+	}
+}
+
 type PrefixExpression struct {
 	Token token.Token
 	Op    string
@@ -165,3 +214,71 @@ func (ie *InfixExpression) String() string {
 }
 
 func (ie *InfixExpression) expressionNode() {}
+
+type IfExpression struct {
+	Token       token.Token
+	Condition   Expression
+	Consequence *BlockStatement
+	// Alternative is nil without an else branch. For "else if" it is a
+	// block holding the nested IfExpression, whose Token is the "if".
+	Alternative *BlockStatement
+}
+
+func (ie *IfExpression) Line() int {
+	return ie.Token.Line
+}
+
+func (ie *IfExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("if (")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(") ")
+	out.WriteString(ie.Consequence.String())
+	if elseIf := ie.ElseIf(); elseIf != nil {
+		out.WriteString(" else ")
+		out.WriteString(elseIf.String())
+	} else if ie.Alternative != nil {
+		out.WriteString(" else ")
+		out.WriteString(ie.Alternative.String())
+	}
+	return out.String()
+}
+
+// ElseIf returns the nested IfExpression of an "else if" branch.
+func (ie *IfExpression) ElseIf() *IfExpression {
+	if ie.Alternative == nil || ie.Alternative.Token.Type != token.IF || len(ie.Alternative.Statements) != 1 {
+		return nil
+	}
+	if s, ok := ie.Alternative.Statements[0].(*ExpressionStatement); ok {
+		nested, _ := s.Expression.(*IfExpression)
+		return nested
+	}
+	return nil
+}
+
+func (ie *IfExpression) expressionNode() {}
+
+// MemberExpression reads the export Property of the module Object.
+type MemberExpression struct {
+	Token    token.Token
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) Line() int {
+	return me.Token.Line
+}
+
+func (me *MemberExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+func (me *MemberExpression) String() string {
+	return me.Object.String() + "." + me.Property.String()
+}
+
+func (me *MemberExpression) expressionNode() {}
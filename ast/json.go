@@ -0,0 +1,516 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Serein-sz/knife/token"
+)
+
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) before(other Position) bool {
+	return p.Line < other.Line || p.Line == other.Line && p.Column < other.Column
+}
+
+// Span is the source range of a node. End is the position just after its
+// last character.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+func (s *Span) include(other Span) {
+	if other.Start.Line == 0 {
+		return
+	}
+	if s.Start.Line == 0 || other.Start.before(s.Start) {
+		s.Start = other.Start
+	}
+	if s.End.before(other.End) {
+		s.End = other.End
+	}
+}
+
+// NodeSpan returns the source range of node and its children, up to the
+// closing brace or parenthesis. It is zero for nodes without positions.
+func NodeSpan(node Node) Span {
+	return (&encoder{}).node(node).Span
+}
+
+func tokenSpan(tok token.Token) Span {
+	if tok.Line == 0 {
+		return Span{}
+	}
+	width := len(tok.Literal)
+	if tok.Type == token.STRING {
+		width += 2
+	}
+	return Span{
+		Start: Position{tok.Line, tok.Column},
+		End:   Position{tok.Line, tok.Column + width},
+	}
+}
+
+// jsonNode is the JSON form of every node: its kind, its span, and the
+// fields of that kind. Value holds a string for literals and identifiers
+// and a node for let and return statements.
+type jsonNode struct {
+	Kind        string          `json:"kind"`
+	Span        Span            `json:"span"`
+	Op          string          `json:"op,omitempty"`
+	Value       json.RawMessage `json:"value,omitempty"`
+	Name        *jsonNode       `json:"name,omitempty"`
+	Parameters  []*jsonNode     `json:"parameters,omitempty"`
+	Function    *jsonNode       `json:"function,omitempty"`
+	Arguments   []*jsonNode     `json:"arguments,omitempty"`
+	Lhs         *jsonNode       `json:"lhs,omitempty"`
+	Rhs         *jsonNode       `json:"rhs,omitempty"`
+	Expression  *jsonNode       `json:"expression,omitempty"`
+	Body        *jsonNode       `json:"body,omitempty"`
+	Condition   *jsonNode       `json:"condition,omitempty"`
+	Consequence *jsonNode       `json:"consequence,omitempty"`
+	Alternative *jsonNode       `json:"alternative,omitempty"`
+	Statements  []*jsonNode     `json:"statements,omitempty"`
+	Comments    []jsonComment   `json:"comments,omitempty"`
+	Exported    bool            `json:"exported,omitempty"`
+	Path        *jsonNode       `json:"path,omitempty"`
+	Alias       *jsonNode       `json:"alias,omitempty"`
+	Names       []*jsonNode     `json:"names,omitempty"`
+	Object      *jsonNode       `json:"object,omitempty"`
+	Property    *jsonNode       `json:"property,omitempty"`
+}
+
+type jsonComment struct {
+	Text string `json:"text"`
+	Span Span   `json:"span"`
+}
+
+// EncodeJSON returns the JSON form of the tree rooted at node, as
+// {"kind": ..., "span": ..., <children>} objects.
+func EncodeJSON(node Node) ([]byte, error) {
+	e := &encoder{}
+	n := e.node(node)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return json.MarshalIndent(n, "", "  ")
+}
+
+type encoder struct {
+	err error
+}
+
+func (e *encoder) node(node Node) *jsonNode {
+	out := &jsonNode{Kind: strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")}
+	var value *jsonNode
+	switch n := node.(type) {
+	case *Program:
+		out.Statements = encodeList(e, n.Statements)
+		for _, c := range n.Comments {
+			out.Comments = append(out.Comments, jsonComment{Text: c.Token.Literal, Span: tokenSpan(c.Token)})
+		}
+	case *LetStatement:
+		out.Span = tokenSpan(n.Token)
+		out.Exported = n.Exported
+		if n.Name != nil {
+			out.Name = e.node(n.Name)
+		}
+		if n.Value != nil {
+			value = e.node(n.Value)
+		}
+	case *FunctionDefineStatement:
+		out.Span = tokenSpan(n.Token)
+		out.Exported = n.Exported
+		if n.Name != nil {
+			out.Name = e.node(n.Name)
+		}
+		out.Parameters = encodeList(e, n.Parameters)
+		if n.Body != nil {
+			out.Body = e.node(n.Body)
+		}
+	case *BlockStatement:
+		out.Span = tokenSpan(n.Token)
+		out.Span.include(tokenSpan(n.RBrace))
+		out.Statements = encodeList(e, n.Statements)
+	case *ReturnStatement:
+		out.Span = tokenSpan(n.Token)
+		if n.Value != nil {
+			value = e.node(n.Value)
+		}
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			out.Expression = e.node(n.Expression)
+		}
+	case *PrefixExpression:
+		out.Span = tokenSpan(n.Token)
+		out.Op = n.Op
+		if n.Rhs != nil {
+			out.Rhs = e.node(n.Rhs)
+		}
+	case *InfixExpression:
+		out.Op = n.Op
+		if n.Lhs != nil {
+			out.Lhs = e.node(n.Lhs)
+		}
+		if n.Rhs != nil {
+			out.Rhs = e.node(n.Rhs)
+		}
+	case *FunctionCallExpression:
+		out.Span = tokenSpan(n.RParen)
+		if n.Function != nil {
+			out.Function = e.node(n.Function)
+		}
+		out.Arguments = encodeList(e, n.Arguments)
+	case *ImportStatement:
+		out.Span = tokenSpan(n.Token)
+		if n.Path != nil {
+			out.Path = e.node(n.Path)
+		}
+		if n.Alias != nil {
+			out.Alias = e.node(n.Alias)
+		}
+		out.Names = encodeList(e, n.Names)
+	case *MemberExpression:
+		if n.Object != nil {
+			out.Object = e.node(n.Object)
+		}
+		if n.Property != nil {
+			out.Property = e.node(n.Property)
+		}
+	case *Identifier:
+		out.Span = tokenSpan(n.Token)
+		out.Value = encodeString(n.Value)
+	case *NumberLiteral:
+		out.Span = tokenSpan(n.Token)
+		out.Value = encodeString(n.Value)
+	case *StringLiteral:
+		out.Span = tokenSpan(n.Token)
+		out.Value = encodeString(n.Value)
+	case *Boolean:
+		out.Span = tokenSpan(n.Token)
+		out.Value, _ = json.Marshal(n.Value)
+	case *Null:
+		out.Span = tokenSpan(n.Token)
+	case *IfExpression:
+		out.Span = tokenSpan(n.Token)
+		if n.Condition != nil {
+			out.Condition = e.node(n.Condition)
+		}
+		if n.Consequence != nil {
+			out.Consequence = e.node(n.Consequence)
+		}
+		if n.Alternative != nil {
+			out.Alternative = e.node(n.Alternative)
+		}
+	default:
+		e.err = fmt.Errorf("ast: cannot encode node type %T", n)
+		return out
+	}
+	if value != nil {
+		out.Value, _ = json.Marshal(value)
+	}
+	// A node spans its own tokens and all of its children.
+	children := append([]*jsonNode{out.Name, out.Function, out.Lhs, out.Rhs, out.Expression, out.Body,
+		out.Condition, out.Consequence, out.Alternative, out.Path, out.Alias, out.Object, out.Property, value}, out.Parameters...)
+	children = append(append(append(children, out.Arguments...), out.Statements...), out.Names...)
+	for _, c := range children {
+		if c != nil {
+			out.Span.include(c.Span)
+		}
+	}
+	return out
+}
+
+func encodeList[T Node](e *encoder, list []T) []*jsonNode {
+	var out []*jsonNode
+	for _, n := range list {
+		out = append(out, e.node(n))
+	}
+	return out
+}
+
+func encodeString(s string) json.RawMessage {
+	data, _ := json.Marshal(s)
+	return data
+}
+
+// DecodeJSON rebuilds a tree from the output of EncodeJSON. Spans are
+// optional, so tools can emit trees without positions.
+func DecodeJSON(data []byte) (Node, error) {
+	var n jsonNode
+	if err := json.Unmarshal(data, &n); err != nil {
+		return nil, err
+	}
+	return decodeNode(&n)
+}
+
+// DecodeProgram is DecodeJSON for a tree whose root is a Program.
+func DecodeProgram(data []byte) (*Program, error) {
+	node, err := DecodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	program, ok := node.(*Program)
+	if !ok {
+		return nil, fmt.Errorf("ast: expected a Program, got %T", node)
+	}
+	return program, nil
+}
+
+func decodeNode(n *jsonNode) (Node, error) {
+	if n == nil {
+		return nil, fmt.Errorf("ast: missing node")
+	}
+	start := func(tt token.TokenType, literal string) token.Token {
+		return token.Token{Type: tt, Literal: literal, Line: n.Span.Start.Line, Column: n.Span.Start.Column}
+	}
+	end := func(tt token.TokenType, literal string) token.Token {
+		return token.Token{Type: tt, Literal: literal, Line: n.Span.End.Line, Column: n.Span.End.Column - len(literal)}
+	}
+	switch n.Kind {
+	case "Program":
+		statements, err := decodeList[Statement](n.Statements)
+		if err != nil {
+			return nil, err
+		}
+		program := &Program{Statements: append([]Statement{}, statements...)}
+		for _, c := range n.Comments {
+			tok := token.Token{Type: token.COMMENT, Literal: c.Text, Line: c.Span.Start.Line, Column: c.Span.Start.Column}
+			program.Comments = append(program.Comments, &Comment{Token: tok})
+		}
+		return program, nil
+	case "LetStatement":
+		name, err := decodeAs[*Identifier](n.Name, "name")
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeValue(n)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, fmt.Errorf("ast: LetStatement: missing value")
+		}
+		return &LetStatement{Token: start(token.LET, "let"), Name: name, Value: value, Exported: n.Exported}, nil
+	case "FunctionDefineStatement":
+		name, err := decodeAs[*Identifier](n.Name, "name")
+		if err != nil {
+			return nil, err
+		}
+		params, err := decodeList[*Identifier](n.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		body, err := decodeAs[*BlockStatement](n.Body, "body")
+		if err != nil {
+			return nil, err
+		}
+		return &FunctionDefineStatement{Token: start(token.FUNCTION, "func"), Name: name, Parameters: params, Body: body, Exported: n.Exported}, nil
+	case "BlockStatement":
+		statements, err := decodeList[Statement](n.Statements)
+		if err != nil {
+			return nil, err
+		}
+		return &BlockStatement{Token: start(token.LBRACE, "{"), Statements: statements, RBrace: end(token.RBRACE, "}")}, nil
+	case "ReturnStatement":
+		value, err := decodeValue(n)
+		if err != nil {
+			return nil, err
+		}
+		return &ReturnStatement{Token: start(token.RETURN, "return"), Value: value}, nil
+	case "ExpressionStatement":
+		expression, err := decodeAs[Expression](n.Expression, "expression")
+		if err != nil {
+			return nil, err
+		}
+		return &ExpressionStatement{Token: firstToken(expression), Expression: expression}, nil
+	case "PrefixExpression":
+		rhs, err := decodeAs[Expression](n.Rhs, "rhs")
+		if err != nil {
+			return nil, err
+		}
+		return &PrefixExpression{Token: start(token.TokenType(n.Op), n.Op), Op: n.Op, Rhs: rhs}, nil
+	case "InfixExpression":
+		lhs, err := decodeAs[Expression](n.Lhs, "lhs")
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := decodeAs[Expression](n.Rhs, "rhs")
+		if err != nil {
+			return nil, err
+		}
+		tok := token.Token{Type: token.TokenType(n.Op), Literal: n.Op, Line: lhs.Line()}
+		return &InfixExpression{Token: tok, Lhs: lhs, Op: n.Op, Rhs: rhs}, nil
+	case "FunctionCallExpression":
+		function, err := decodeAs[Expression](n.Function, "function")
+		if err != nil {
+			return nil, err
+		}
+		args, err := decodeList[Expression](n.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		tok := token.Token{Type: token.LPAREN, Literal: "(", Line: function.Line()}
+		return &FunctionCallExpression{Token: tok, Function: function, Arguments: args, RParen: end(token.RPAREN, ")")}, nil
+	case "ImportStatement":
+		path, err := decodeAs[*StringLiteral](n.Path, "path")
+		if err != nil {
+			return nil, err
+		}
+		statement := &ImportStatement{Token: start(token.IMPORT, "import"), Path: path}
+		if n.Alias != nil {
+			if statement.Alias, err = decodeAs[*Identifier](n.Alias, "alias"); err != nil {
+				return nil, err
+			}
+		}
+		if statement.Names, err = decodeList[*Identifier](n.Names); err != nil {
+			return nil, err
+		}
+		return statement, nil
+	case "MemberExpression":
+		object, err := decodeAs[Expression](n.Object, "object")
+		if err != nil {
+			return nil, err
+		}
+		property, err := decodeAs[*Identifier](n.Property, "property")
+		if err != nil {
+			return nil, err
+		}
+		tok := token.Token{Type: token.DOT, Literal: ".", Line: property.Token.Line, Column: property.Token.Column - 1}
+		return &MemberExpression{Token: tok, Object: object, Property: property}, nil
+	case "Identifier":
+		v, err := decodeString(n)
+		return &Identifier{Token: start(token.IDENT, v), Value: v}, err
+	case "NumberLiteral":
+		v, err := decodeString(n)
+		return &NumberLiteral{Token: start(token.NUMBER, v), Value: v}, err
+	case "StringLiteral":
+		v, err := decodeString(n)
+		return &StringLiteral{Token: start(token.STRING, v), Value: v}, err
+	case "Boolean":
+		var v bool
+		if err := json.Unmarshal(n.Value, &v); err != nil {
+			return nil, fmt.Errorf("ast: Boolean: value must be a boolean")
+		}
+		if v {
+			return &Boolean{Token: start(token.TRUE, "true"), Value: v}, nil
+		}
+		return &Boolean{Token: start(token.FALSE, "false"), Value: v}, nil
+	case "Null":
+		return &Null{Token: start(token.NULL, "null"), Value: "null"}, nil
+	case "IfExpression":
+		condition, err := decodeAs[Expression](n.Condition, "condition")
+		if err != nil {
+			return nil, err
+		}
+		consequence, err := decodeAs[*BlockStatement](n.Consequence, "consequence")
+		if err != nil {
+			return nil, err
+		}
+		ifExpression := &IfExpression{Token: start(token.IF, "if"), Condition: condition, Consequence: consequence}
+		if n.Alternative != nil {
+			if ifExpression.Alternative, err = decodeAs[*BlockStatement](n.Alternative, "alternative"); err != nil {
+				return nil, err
+			}
+			markElseIf(ifExpression.Alternative)
+		}
+		return ifExpression, nil
+	}
+	return nil, fmt.Errorf("ast: unknown node kind %q", n.Kind)
+}
+
+func decodeAs[T Node](n *jsonNode, field string) (T, error) {
+	var zero T
+	if n == nil {
+		return zero, fmt.Errorf("ast: missing %s", field)
+	}
+	node, err := decodeNode(n)
+	if err != nil {
+		return zero, err
+	}
+	t, ok := node.(T)
+	if !ok {
+		return zero, fmt.Errorf("ast: %s cannot be a %s", field, n.Kind)
+	}
+	return t, nil
+}
+
+func decodeList[T Node](list []*jsonNode) ([]T, error) {
+	var out []T
+	for _, n := range list {
+		t, err := decodeAs[T](n, "list item")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// decodeValue decodes the optional expression in the value field of a let
+// or return statement.
+func decodeValue(n *jsonNode) (Expression, error) {
+	if len(n.Value) == 0 || string(n.Value) == "null" {
+		return nil, nil
+	}
+	var value jsonNode
+	if err := json.Unmarshal(n.Value, &value); err != nil {
+		return nil, fmt.Errorf("ast: %s: value: %w", n.Kind, err)
+	}
+	return decodeAs[Expression](&value, "value")
+}
+
+func decodeString(n *jsonNode) (string, error) {
+	var s string
+	if err := json.Unmarshal(n.Value, &s); err != nil {
+		return "", fmt.Errorf("ast: %s: value must be a string", n.Kind)
+	}
+	return s, nil
+}
+
+func firstToken(e Expression) token.Token {
+	switch e := e.(type) {
+	case *InfixExpression:
+		return firstToken(e.Lhs)
+	case *FunctionCallExpression:
+		return firstToken(e.Function)
+	case *MemberExpression:
+		return firstToken(e.Object)
+	case *Identifier:
+		return e.Token
+	case *NumberLiteral:
+		return e.Token
+	case *StringLiteral:
+		return e.Token
+	case *Null:
+		return e.Token
+	case *Boolean:
+		return e.Token
+	case *PrefixExpression:
+		return e.Token
+	case *IfExpression:
+		return e.Token
+	}
+	return token.Token{}
+}
+
+// markElseIf restores the "if" token of a block that only wraps the nested
+// if of an "else if", recognized by both starting at the same position.
+func markElseIf(block *BlockStatement) {
+	if len(block.Statements) != 1 {
+		return
+	}
+	s, ok := block.Statements[0].(*ExpressionStatement)
+	if !ok {
+		return
+	}
+	nested, ok := s.Expression.(*IfExpression)
+	if ok && nested.Token.Line == block.Token.Line && nested.Token.Column == block.Token.Column {
+		block.Token = nested.Token
+	}
+}
@@ -0,0 +1,81 @@
+package ast_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	kast "github.com/Serein-sz/knife/ast"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	sources := []string{
+		"// comment\nlet a = !1 // trailing\nfunc f(x, y) {\n    return (x + y) * 2\n}\nprint(f(a, 'str') == null, f(1, 2) != 3)\n",
+		"import \"./m.k\" as m\nimport { a, b } from \"lib/n\"\nimport \"./o.k\"\nexport let c = m.f(a).g\nexport func h() {}\n",
+	}
+	for _, path := range []string{"../example/format.k", "../example/parser.k", "../example/src/main.k"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, string(data))
+	}
+	for _, src := range sources {
+		program := parse(t, src)
+		encoded, err := kast.EncodeJSON(program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := kast.DecodeProgram(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.String() != program.String() {
+			t.Fatalf("expected=%q, got=%q", program.String(), decoded.String())
+		}
+		again, err := kast.EncodeJSON(decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, again) {
+			t.Fatalf("re-encoding changed the tree:\n%s\n%s", encoded, again)
+		}
+	}
+}
+
+func TestJSONSpans(t *testing.T) {
+	encoded, err := kast.EncodeJSON(parse(t, "print(\"a\", 1)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The call spans from print to the closing parenthesis.
+	compact := strings.Join(strings.Fields(string(encoded)), "")
+	if !strings.Contains(compact, `"kind":"FunctionCallExpression","span":{"start":{"line":1,"column":1},"end":{"line":1,"column":14}}`) {
+		t.Fatalf("unexpected span:\n%s", encoded)
+	}
+}
+
+func TestDecodeWithoutSpans(t *testing.T) {
+	program, err := kast.DecodeProgram([]byte(`{"kind": "Program", "statements": [
+		{"kind": "LetStatement", "name": {"kind": "Identifier", "value": "x"},
+		 "value": {"kind": "InfixExpression", "op": "+",
+		           "lhs": {"kind": "NumberLiteral", "value": "1"}, "rhs": {"kind": "StringLiteral", "value": ""}}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.String() != `let x = 1 + ""` {
+		t.Fatalf("unexpected program %q", program.String())
+	}
+
+	for _, bad := range []string{
+		`{"kind": "Program", "statements": [{"kind": "Unknown"}]}`,
+		`{"kind": "Program", "statements": [{"kind": "LetStatement", "name": {"kind": "Null"}, "value": {"kind": "Null"}}]}`,
+		`{"kind": "Identifier", "value": "x"}`,
+	} {
+		if _, err := kast.DecodeProgram([]byte(bad)); err == nil {
+			t.Fatalf("expected %s to be rejected", bad)
+		}
+	}
+}
@@ -16,6 +16,8 @@ type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
 	Value Expression
+	// Exported is set by a leading export at the top level of a module.
+	Exported bool
 }
 
 func (ls *LetStatement) Line() int {
@@ -28,13 +30,15 @@ func (ls *LetStatement) TokenLiteral() string {
 
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
+	if ls.Exported {
+		out.WriteString("export ")
+	}
 	out.WriteString(ls.Token.Literal + " ")
 	out.WriteString(ls.Name.String())
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
 	}
-	out.WriteString("\n")
 	return out.String()
 }
 
@@ -45,6 +49,10 @@ type FunctionDefineStatement struct {
 	Name       *Identifier
 	Parameters []*Identifier
 	Body       *BlockStatement
+	// Locals is the number of frame slots the resolver assigned to the
+	// parameters and the names defined in the body.
+	Locals   int
+	Exported bool
 }
 
 func (fds *FunctionDefineStatement) Line() int {
@@ -57,6 +65,9 @@ func (fds *FunctionDefineStatement) TokenLiteral() string {
 
 func (fds *FunctionDefineStatement) String() string {
 	var out bytes.Buffer
+	if fds.Exported {
+		out.WriteString("export ")
+	}
 	out.WriteString(fds.Token.Literal + " ")
 	out.WriteString(fds.Name.String())
 	out.WriteString("(")
@@ -76,6 +87,7 @@ func (fds *FunctionDefineStatement) statementNode() {}
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	RBrace     token.Token
 }
 
 func (bs *BlockStatement) Line() int {
@@ -87,16 +99,14 @@ func (bs *BlockStatement) TokenLiteral() string {
 }
 
 func (bs *BlockStatement) String() string {
-	var out bytes.Buffer
-	out.WriteString("{\n")
-	for i, s := range bs.Statements {
-		out.WriteString("    " + strings.ReplaceAll(s.String(), "\n", ""))
-		if i != len(bs.Statements)-1 {
-			out.WriteString("\n")
-		}
+	if len(bs.Statements) == 0 {
+		return "{}"
 	}
-	out.WriteString("\n}\n")
-	return out.String()
+	statements := make([]string, 0, len(bs.Statements))
+	for _, s := range bs.Statements {
+		statements = append(statements, s.String())
+	}
+	return "{ " + strings.Join(statements, "; ") + " }"
 }
 
 func (fds *BlockStatement) statementNode() {}
@@ -116,8 +126,10 @@ func (rs *ReturnStatement) TokenLiteral() string {
 
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
-	out.WriteString(rs.Token.Literal + " ")
-	out.WriteString(rs.Value.String())
+	out.WriteString(rs.Token.Literal)
+	if rs.Value != nil {
+		out.WriteString(" " + rs.Value.String())
+	}
 	return out.String()
 }
 
@@ -141,3 +153,39 @@ func (es *ExpressionStatement) String() string {
 }
 
 func (es *ExpressionStatement) statementNode() {}
+
+// ImportStatement binds the module at Path to Alias, or the exports Names
+// of the module to names of their own. With neither, the module only runs.
+type ImportStatement struct {
+	Token token.Token
+	Path  *StringLiteral
+	Alias *Identifier
+	Names []*Identifier
+}
+
+func (is *ImportStatement) Line() int {
+	return is.Token.Line
+}
+
+func (is *ImportStatement) TokenLiteral() string {
+	return is.Token.Literal
+}
+
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(is.Token.Literal + " ")
+	if is.Names != nil {
+		names := make([]string, 0, len(is.Names))
+		for _, n := range is.Names {
+			names = append(names, n.String())
+		}
+		out.WriteString("{ " + strings.Join(names, ", ") + " } from ")
+	}
+	out.WriteString(is.Path.String())
+	if is.Alias != nil {
+		out.WriteString(" as " + is.Alias.String())
+	}
+	return out.String()
+}
+
+func (is *ImportStatement) statementNode() {}
@@ -0,0 +1,221 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is called by Walk for each node. If the returned
+// visitor w is not nil, Walk visits each child of node with w and then
+// calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first, source order.
+// Missing children, such as the value of a bare return, are skipped.
+func Walk(v Visitor, node Node) {
+	if node == nil {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+	case *LetStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *FunctionDefineStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+	case *ReturnStatement:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+	case *PrefixExpression:
+		if n.Rhs != nil {
+			Walk(v, n.Rhs)
+		}
+	case *InfixExpression:
+		if n.Lhs != nil {
+			Walk(v, n.Lhs)
+		}
+		if n.Rhs != nil {
+			Walk(v, n.Rhs)
+		}
+	case *FunctionCallExpression:
+		if n.Function != nil {
+			Walk(v, n.Function)
+		}
+		for _, a := range n.Arguments {
+			Walk(v, a)
+		}
+	case *ImportStatement:
+		if n.Path != nil {
+			Walk(v, n.Path)
+		}
+		if n.Alias != nil {
+			Walk(v, n.Alias)
+		}
+		for _, name := range n.Names {
+			Walk(v, name)
+		}
+	case *MemberExpression:
+		if n.Object != nil {
+			Walk(v, n.Object)
+		}
+		if n.Property != nil {
+			Walk(v, n.Property)
+		}
+	case *IfExpression:
+		if n.Condition != nil {
+			Walk(v, n.Condition)
+		}
+		if n.Consequence != nil {
+			Walk(v, n.Consequence)
+		}
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+	case *Identifier, *Null, *Boolean, *NumberLiteral, *StringLiteral:
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node, calling f for each node and
+// descending into its children only while f returns true. Like Walk, it
+// calls f(nil) after the children of a node have been visited.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite replaces every node of the tree rooted at node, children before
+// their parent, with the result of f and returns the new root. f returns its
+// argument to keep a node. A replacement must fit where the original was:
+// an Expression for an expression, a *BlockStatement for a body, an
+// *Identifier for a name and a *StringLiteral for an import path;
+// otherwise Rewrite panics. Returning nil for a statement removes it from
+// its list.
+func Rewrite(node Node, f func(Node) Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		n.Statements = rewriteStatements(n.Statements, f)
+	case *LetStatement:
+		n.Name = rewriteIdentifier(n.Name, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *FunctionDefineStatement:
+		n.Name = rewriteIdentifier(n.Name, f)
+		for i, p := range n.Parameters {
+			n.Parameters[i] = rewriteIdentifier(p, f)
+		}
+		if n.Body != nil {
+			n.Body = rewriteAs[*BlockStatement](n.Body, f)
+		}
+	case *BlockStatement:
+		n.Statements = rewriteStatements(n.Statements, f)
+	case *ReturnStatement:
+		n.Value = rewriteExpression(n.Value, f)
+	case *ExpressionStatement:
+		n.Expression = rewriteExpression(n.Expression, f)
+	case *PrefixExpression:
+		n.Rhs = rewriteExpression(n.Rhs, f)
+	case *InfixExpression:
+		n.Lhs = rewriteExpression(n.Lhs, f)
+		n.Rhs = rewriteExpression(n.Rhs, f)
+	case *FunctionCallExpression:
+		n.Function = rewriteExpression(n.Function, f)
+		for i, a := range n.Arguments {
+			n.Arguments[i] = rewriteExpression(a, f)
+		}
+	case *ImportStatement:
+		if n.Path != nil {
+			n.Path = rewriteAs[*StringLiteral](n.Path, f)
+		}
+		n.Alias = rewriteIdentifier(n.Alias, f)
+		for i, name := range n.Names {
+			n.Names[i] = rewriteIdentifier(name, f)
+		}
+	case *MemberExpression:
+		n.Object = rewriteExpression(n.Object, f)
+		n.Property = rewriteIdentifier(n.Property, f)
+	case *IfExpression:
+		n.Condition = rewriteExpression(n.Condition, f)
+		if n.Consequence != nil {
+			n.Consequence = rewriteAs[*BlockStatement](n.Consequence, f)
+		}
+		if n.Alternative != nil {
+			n.Alternative = rewriteAs[*BlockStatement](n.Alternative, f)
+		}
+	case *Identifier, *Null, *Boolean, *NumberLiteral, *StringLiteral:
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+	return f(node)
+}
+
+func rewriteStatements(statements []Statement, f func(Node) Node) []Statement {
+	out := statements[:0]
+	for _, s := range statements {
+		if r := Rewrite(s, f); r != nil {
+			out = append(out, as[Statement](r, s))
+		}
+	}
+	return out
+}
+
+func rewriteExpression(e Expression, f func(Node) Node) Expression {
+	if e == nil {
+		return nil
+	}
+	return rewriteAs[Expression](e, f)
+}
+
+func rewriteIdentifier(id *Identifier, f func(Node) Node) *Identifier {
+	if id == nil {
+		return nil
+	}
+	return rewriteAs[*Identifier](id, f)
+}
+
+func rewriteAs[T Node](node T, f func(Node) Node) T {
+	return as[T](Rewrite(node, f), node)
+}
+
+func as[T Node](replacement, original Node) T {
+	r, ok := replacement.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T cannot replace %T", replacement, original))
+	}
+	return r
+}
@@ -0,0 +1,206 @@
+package ast_test
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+
+	kast "github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/lexer"
+	kparser "github.com/Serein-sz/knife/parser"
+)
+
+func parse(t *testing.T, src string) *kast.Program {
+	t.Helper()
+	p := kparser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+func TestInspect(t *testing.T) {
+	program := parse(t, "let a = !1\nfunc f(x, y) {\n return x + y\n}\nprint(f(a, \"s\") == null)\n")
+	var kinds []string
+	kast.Inspect(program, func(n kast.Node) bool {
+		if n != nil {
+			kinds = append(kinds, strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."))
+		}
+		return true
+	})
+	expected := "Program LetStatement Identifier PrefixExpression NumberLiteral " +
+		"FunctionDefineStatement Identifier Identifier Identifier BlockStatement ReturnStatement InfixExpression Identifier Identifier " +
+		"ExpressionStatement FunctionCallExpression Identifier InfixExpression FunctionCallExpression Identifier Identifier StringLiteral Null"
+	if got := strings.Join(kinds, " "); got != expected {
+		t.Fatalf("expected=%s\ngot=%s", expected, got)
+	}
+
+	calls := 0
+	kast.Inspect(program, func(n kast.Node) bool {
+		if _, ok := n.(*kast.FunctionDefineStatement); ok {
+			return false
+		}
+		if _, ok := n.(*kast.FunctionCallExpression); ok {
+			calls++
+		}
+		return true
+	})
+	if calls != 2 {
+		t.Fatalf("expected 2 calls outside of function bodies, got %d", calls)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	program := parse(t, "let a = 1 + 1\nreturn a\nprint(a)\nfunc f() {\n return 1\n}\n")
+	kast.Rewrite(program, func(n kast.Node) kast.Node {
+		switch n := n.(type) {
+		case *kast.NumberLiteral:
+			if n.Value == "1" {
+				return &kast.NumberLiteral{Token: n.Token, Value: "2"}
+			}
+		case *kast.ExpressionStatement:
+			return nil
+		}
+		return n
+	})
+	expected := "let a = 2 + 2\nreturn a\nfunc f() { return 2 }"
+	if program.String() != expected {
+		t.Fatalf("expected=%q, got=%q", expected, program.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected replacing an expression with a statement to panic")
+		}
+	}()
+	kast.Rewrite(program, func(n kast.Node) kast.Node {
+		if _, ok := n.(*kast.InfixExpression); ok {
+			return &kast.ReturnStatement{}
+		}
+		return n
+	})
+}
+
+// TestWalkersCoverEveryNode reads the ast sources and checks that Walk,
+// Rewrite and the JSON encoder handle every node type and every child field of it, so adding a
+// node type or a field without teaching the walkers about it fails here.
+func TestWalkersCoverEveryNode(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := pkgs["ast"].Files
+
+	// Node types are the structs whose pointer has a String method.
+	structs := map[string]*ast.StructType{}
+	nodes := map[string]bool{}
+	var walker []*ast.FuncDecl
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						if st, ok := ts.Type.(*ast.StructType); ok {
+							structs[ts.Name.Name] = st
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if d.Recv != nil && d.Name.Name == "String" {
+					if star, ok := d.Recv.List[0].Type.(*ast.StarExpr); ok {
+						nodes[star.X.(*ast.Ident).Name] = true
+					}
+				}
+				if d.Recv == nil && (d.Name.Name == "Walk" || d.Name.Name == "Rewrite") || d.Recv != nil && d.Name.Name == "node" {
+					walker = append(walker, d)
+				}
+			}
+		}
+	}
+	if len(walker) != 3 {
+		t.Fatalf("expected to find Walk, Rewrite and the JSON encoder, found %d", len(walker))
+	}
+
+	isChild := func(expr ast.Expr) bool {
+		name := strings.TrimLeft(exprString(expr), "[]*")
+		return name == "Node" || name == "Statement" || name == "Expression" || nodes[name]
+	}
+
+	for _, fn := range walker {
+		handled := caseFields(fn)
+		var names []string
+		for name := range nodes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fields, ok := handled[name]
+			if !ok {
+				t.Errorf("%s does not handle *%s", fn.Name.Name, name)
+				continue
+			}
+			for _, field := range structs[name].Fields.List {
+				if !isChild(field.Type) {
+					continue
+				}
+				for _, id := range field.Names {
+					if !fields[id.Name] {
+						t.Errorf("%s does not visit %s.%s", fn.Name.Name, name, id.Name)
+					}
+				}
+			}
+		}
+	}
+}
+
+// caseFields maps each type of the type switch in fn to the fields of n
+// used by its case clause.
+func caseFields(fn *ast.FuncDecl) map[string]map[string]bool {
+	out := map[string]map[string]bool{}
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		clause, ok := node.(*ast.CaseClause)
+		if !ok {
+			return true
+		}
+		used := map[string]bool{}
+		for _, stmt := range clause.Body {
+			ast.Inspect(stmt, func(node ast.Node) bool {
+				if sel, ok := node.(*ast.SelectorExpr); ok {
+					if x, ok := sel.X.(*ast.Ident); ok && x.Name == "n" {
+						used[sel.Sel.Name] = true
+					}
+				}
+				return true
+			})
+		}
+		for _, expr := range clause.List {
+			if star, ok := expr.(*ast.StarExpr); ok {
+				out[star.X.(*ast.Ident).Name] = used
+			}
+		}
+		return false
+	})
+	return out
+}
+
+func exprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.StarExpr:
+		return "*" + exprString(e.X)
+	case *ast.ArrayType:
+		return "[]" + exprString(e.Elt)
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	}
+	return ""
+}
@@ -0,0 +1,184 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Instructions is a sequence of opcodes, each followed by its big-endian
+// operands.
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpNull
+	OpTrue
+	OpFalse
+	OpPop
+
+	// OpGetLocal reads a slot of the frame depth levels up; the name is
+	// only used in errors.
+	OpGetLocal
+	OpSetLocal
+	// OpGetGlobal looks a name up from the frame depth levels up, falling
+	// back to the builtins.
+	OpGetGlobal
+	OpSetGlobal
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpLessEqual
+	OpGreater
+	OpGreaterEqual
+	OpMinus
+	OpBang
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpClosure
+	OpCall
+	OpReturn
+	// OpTailCall calls a function in place of the current frame and returns
+	// its value.
+	OpTailCall
+
+	// OpImport pushes the module at the path constant.
+	OpImport
+	// OpMember replaces a module with its export of the name constant.
+	OpMember
+)
+
+// Definition describes an opcode and the width in bytes of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:      {"OpConstant", []int{2}},
+	OpNull:          {"OpNull", []int{}},
+	OpTrue:          {"OpTrue", []int{}},
+	OpFalse:         {"OpFalse", []int{}},
+	OpPop:           {"OpPop", []int{}},
+	OpGetLocal:      {"OpGetLocal", []int{1, 2, 2}},
+	OpSetLocal:      {"OpSetLocal", []int{2}},
+	OpGetGlobal:     {"OpGetGlobal", []int{1, 2}},
+	OpSetGlobal:     {"OpSetGlobal", []int{2}},
+	OpAdd:           {"OpAdd", []int{}},
+	OpSub:           {"OpSub", []int{}},
+	OpMul:           {"OpMul", []int{}},
+	OpDiv:           {"OpDiv", []int{}},
+	OpEqual:         {"OpEqual", []int{}},
+	OpNotEqual:      {"OpNotEqual", []int{}},
+	OpLess:          {"OpLess", []int{}},
+	OpLessEqual:     {"OpLessEqual", []int{}},
+	OpGreater:       {"OpGreater", []int{}},
+	OpGreaterEqual:  {"OpGreaterEqual", []int{}},
+	OpMinus:         {"OpMinus", []int{}},
+	OpBang:          {"OpBang", []int{}},
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpClosure:       {"OpClosure", []int{2}},
+	OpCall:          {"OpCall", []int{1}},
+	OpReturn:        {"OpReturn", []int{}},
+	OpTailCall:      {"OpTailCall", []int{1}},
+	OpImport:        {"OpImport", []int{2}},
+	OpMember:        {"OpMember", []int{2}},
+}
+
+// Operators maps the infix operators to their opcode.
+var Operators = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"<":  OpLess,
+	"<=": OpLessEqual,
+	">":  OpGreater,
+	">=": OpGreaterEqual,
+}
+
+func Lookup(op Opcode) (*Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes op with its operands.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+	offset := 1
+	for i, o := range operands {
+		switch def.OperandWidths[i] {
+		case 1:
+			instruction[offset] = byte(o)
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		}
+		offset += def.OperandWidths[i]
+	}
+	return instruction
+}
+
+// ReadOperands decodes the operands of def from ins and returns them with
+// the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, w := range def.OperandWidths {
+		switch w {
+		case 1:
+			operands[i] = int(ins[offset])
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		}
+		offset += w
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// String disassembles the instructions, one per line.
+func (ins Instructions) String() string {
+	var out strings.Builder
+	for i := 0; i < len(ins); {
+		def, err := Lookup(Opcode(ins[i]))
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			break
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s", i, def.Name)
+		for _, o := range operands {
+			fmt.Fprintf(&out, " %d", o)
+		}
+		out.WriteString("\n")
+		i += 1 + read
+	}
+	return out.String()
+}
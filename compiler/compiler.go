@@ -0,0 +1,337 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/environment"
+)
+
+// Bytecode is a compiled program: the instructions of its top level and the
+// constant pool shared by all its functions.
+type Bytecode struct {
+	Main      *environment.CompiledFunction
+	Constants []environment.Object
+}
+
+// Compiler lowers a program to Bytecode. Identifiers bound by the resolver
+// compile to slot accesses; unresolved ones are looked up by name.
+type Compiler struct {
+	constants []environment.Object
+	// indexes deduplicates number, string and name constants.
+	indexes map[constantKey]int
+	fn      *environment.CompiledFunction
+	// inFunction is set while compiling a function body, where a returned
+	// call is a tail call.
+	inFunction bool
+}
+
+type constantKey struct {
+	t     environment.ObjectType
+	value string
+}
+
+func New() *Compiler {
+	return &Compiler{indexes: map[constantKey]int{}}
+}
+
+// Compile compiles program into a new Bytecode.
+func Compile(program *ast.Program) (*Bytecode, error) {
+	c := New()
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+	return c.Bytecode(), nil
+}
+
+func (c *Compiler) Compile(program *ast.Program) error {
+	c.fn = &environment.CompiledFunction{Name: "main"}
+	if err := c.block(program.Statements, program); err != nil {
+		return err
+	}
+	c.emit(program, OpReturn)
+	if len(c.constants) > math.MaxUint16+1 {
+		return fmt.Errorf("too many constants: %d", len(c.constants))
+	}
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	b := &Bytecode{Main: c.fn, Constants: c.constants}
+	b.link()
+	return b
+}
+
+// link gives every function of b the constant pool.
+func (b *Bytecode) link() {
+	b.Main.Constants = b.Constants
+	for _, obj := range b.Constants {
+		if f, ok := obj.(*environment.CompiledFunction); ok {
+			f.Constants = b.Constants
+		}
+	}
+}
+
+func (c *Compiler) emit(node ast.Node, op Opcode, operands ...int) int {
+	pos := len(c.fn.Instructions)
+	line := node.Line()
+	if n := len(c.fn.Lines); n == 0 || c.fn.Lines[n-1].Line != line {
+		c.fn.Lines = append(c.fn.Lines, environment.LineEntry{Offset: pos, Line: line})
+	}
+	c.fn.Instructions = append(c.fn.Instructions, Make(op, operands...)...)
+	return pos
+}
+
+// patch replaces the operand of the jump at pos with the current offset.
+func (c *Compiler) patch(pos int) error {
+	if len(c.fn.Instructions) > math.MaxUint16 {
+		return fmt.Errorf("function %s is too large to compile", c.fn.Name)
+	}
+	copy(c.fn.Instructions[pos:], Make(Opcode(c.fn.Instructions[pos]), len(c.fn.Instructions)))
+	return nil
+}
+
+func (c *Compiler) constant(obj environment.Object) int {
+	var key constantKey
+	switch o := obj.(type) {
+	case *environment.Number:
+		key = constantKey{environment.NUMBER, o.Value}
+	case *environment.String:
+		key = constantKey{environment.STRING, o.Value}
+	default:
+		c.constants = append(c.constants, obj)
+		return len(c.constants) - 1
+	}
+	if i, ok := c.indexes[key]; ok {
+		return i
+	}
+	c.constants = append(c.constants, obj)
+	c.indexes[key] = len(c.constants) - 1
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) name(id *ast.Identifier) int {
+	return c.constant(&environment.String{Value: id.Value})
+}
+
+// block compiles statements so that they leave the value of the last one on
+// the stack, or null when it is not an expression.
+func (c *Compiler) block(statements []ast.Statement, node ast.Node) error {
+	if len(statements) == 0 {
+		c.emit(node, OpNull)
+		return nil
+	}
+	for i, statement := range statements {
+		last := i == len(statements)-1
+		switch s := statement.(type) {
+		case *ast.ExpressionStatement:
+			if err := c.expression(s.Expression); err != nil {
+				return err
+			}
+			if !last {
+				c.emit(s, OpPop)
+			}
+			continue
+		case *ast.BlockStatement:
+			if err := c.block(s.Statements, s); err != nil {
+				return err
+			}
+			if !last {
+				c.emit(s, OpPop)
+			}
+			continue
+		case *ast.LetStatement:
+			if err := c.expression(s.Value); err != nil {
+				return err
+			}
+			c.define(s, s.Name)
+		case *ast.FunctionDefineStatement:
+			if err := c.function(s); err != nil {
+				return err
+			}
+			c.define(s, s.Name)
+		case *ast.ImportStatement:
+			path := c.constant(&environment.String{Value: s.Path.Value})
+			if s.Alias == nil && len(s.Names) == 0 {
+				c.emit(s, OpImport, path)
+				c.emit(s, OpPop)
+			}
+			if s.Alias != nil {
+				c.emit(s, OpImport, path)
+				c.define(s, s.Alias)
+			}
+			for _, name := range s.Names {
+				c.emit(s, OpImport, path)
+				c.emit(name, OpMember, c.name(name))
+				c.define(s, name)
+			}
+		case *ast.ReturnStatement:
+			if call, ok := s.Value.(*ast.FunctionCallExpression); ok && c.inFunction {
+				if err := c.call(call, OpTailCall); err != nil {
+					return err
+				}
+				break
+			}
+			if s.Value == nil {
+				c.emit(s, OpNull)
+			} else if err := c.expression(s.Value); err != nil {
+				return err
+			}
+			c.emit(s, OpReturn)
+		default:
+			return fmt.Errorf("line: %d, error: cannot compile %T", statement.Line(), statement)
+		}
+		if last {
+			c.emit(statement, OpNull)
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) define(node ast.Node, name *ast.Identifier) {
+	if name.Binding.Kind == ast.Local {
+		c.emit(node, OpSetLocal, name.Binding.Slot)
+		return
+	}
+	c.emit(node, OpSetGlobal, c.name(name))
+}
+
+func (c *Compiler) function(f *ast.FunctionDefineStatement) error {
+	params := make([]string, 0, len(f.Parameters))
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	fn := &environment.CompiledFunction{
+		Name:       f.Name.Value,
+		Parameters: len(f.Parameters),
+		Locals:     max(f.Locals, len(f.Parameters)),
+		Source:     "func(" + strings.Join(params, ", ") + ") " + f.Body.String(),
+	}
+	outer, inFunction := c.fn, c.inFunction
+	c.fn, c.inFunction = fn, true
+	// Arguments arrive in the first slots; parameters the resolver did not
+	// bind are copied to names.
+	for i, p := range f.Parameters {
+		if p.Binding.Kind != ast.Local {
+			c.emit(p, OpGetLocal, 0, i, c.name(p))
+			c.emit(p, OpSetGlobal, c.name(p))
+		}
+	}
+	var statements []ast.Statement
+	if f.Body != nil {
+		statements = f.Body.Statements
+	}
+	err := c.block(statements, f)
+	c.emit(f, OpReturn)
+	c.fn, c.inFunction = outer, inFunction
+	if err != nil {
+		return err
+	}
+	c.emit(f, OpClosure, c.constant(fn))
+	return nil
+}
+
+func (c *Compiler) expression(expression ast.Expression) error {
+	switch e := expression.(type) {
+	case *ast.Identifier:
+		switch e.Binding.Kind {
+		case ast.Local:
+			c.emit(e, OpGetLocal, e.Binding.Depth, e.Binding.Slot, c.name(e))
+		default:
+			c.emit(e, OpGetGlobal, e.Binding.Depth, c.name(e))
+		}
+	case *ast.NumberLiteral:
+		c.emit(e, OpConstant, c.constant(&environment.Number{Value: e.Value}))
+	case *ast.StringLiteral:
+		c.emit(e, OpConstant, c.constant(&environment.String{Value: e.Value}))
+	case *ast.Null:
+		c.emit(e, OpNull)
+	case *ast.Boolean:
+		if e.Value {
+			c.emit(e, OpTrue)
+		} else {
+			c.emit(e, OpFalse)
+		}
+	case *ast.PrefixExpression:
+		if err := c.expression(e.Rhs); err != nil {
+			return err
+		}
+		switch e.Op {
+		case "-":
+			c.emit(e, OpMinus)
+		case "!":
+			c.emit(e, OpBang)
+		default:
+			return fmt.Errorf("line: %d, error: unknown prefix operator %q", e.Line(), e.Op)
+		}
+	case *ast.InfixExpression:
+		op, ok := Operators[e.Op]
+		if !ok {
+			return fmt.Errorf("line: %d, error: unknown infix operator %q", e.Line(), e.Op)
+		}
+		if err := c.expression(e.Lhs); err != nil {
+			return err
+		}
+		if err := c.expression(e.Rhs); err != nil {
+			return err
+		}
+		c.emit(e, op)
+	case *ast.IfExpression:
+		if err := c.expression(e.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthy := c.emit(e, OpJumpNotTruthy, 0)
+		if err := c.block(e.Consequence.Statements, e.Consequence); err != nil {
+			return err
+		}
+		jump := c.emit(e, OpJump, 0)
+		if err := c.patch(jumpNotTruthy); err != nil {
+			return err
+		}
+		if e.Alternative == nil {
+			c.emit(e, OpNull)
+		} else if err := c.block(e.Alternative.Statements, e.Alternative); err != nil {
+			return err
+		}
+		if err := c.patch(jump); err != nil {
+			return err
+		}
+	case *ast.FunctionCallExpression:
+		return c.call(e, OpCall)
+	case *ast.MemberExpression:
+		if err := c.expression(e.Object); err != nil {
+			return err
+		}
+		c.emit(e, OpMember, c.name(e.Property))
+	default:
+		return fmt.Errorf("line: %d, error: cannot compile %T", expression.Line(), expression)
+	}
+	return nil
+}
+
+// call compiles a call with op, OpCall or OpTailCall.
+func (c *Compiler) call(e *ast.FunctionCallExpression, op Opcode) error {
+	if len(e.Arguments) > 255 {
+		return fmt.Errorf("line: %d, error: too many arguments", e.Line())
+	}
+	if err := c.expression(e.Function); err != nil {
+		return err
+	}
+	for _, a := range e.Arguments {
+		start := len(c.fn.Instructions)
+		if err := c.expression(a); err != nil {
+			return err
+		}
+		c.fn.Arguments = append(c.fn.Arguments, environment.ArgumentRange{
+			Start:  start,
+			End:    len(c.fn.Instructions),
+			Line:   a.Line(),
+			Source: a.String(),
+		})
+	}
+	pos := c.emit(e, op, len(e.Arguments))
+	c.fn.Calls = append(c.fn.Calls, environment.CallSite{Offset: pos, Span: e.Span()})
+	return nil
+}
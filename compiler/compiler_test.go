@@ -0,0 +1,115 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+	"github.com/Serein-sz/knife/resolver"
+)
+
+func compile(t *testing.T, src string) *Bytecode {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		t.Fatal(err)
+	}
+	r := resolver.New("print")
+	r.Resolve(program)
+	if err := r.Error(); err != nil {
+		t.Fatal(err)
+	}
+	bytecode, err := Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytecode
+}
+
+func TestMake(t *testing.T) {
+	ins := Instructions(append(Make(OpConstant, 65534), Make(OpGetLocal, 1, 258, 3)...))
+	expected := "0000 OpConstant 65534\n0003 OpGetLocal 1 258 3\n"
+	if ins.String() != expected {
+		t.Fatalf("expected=%q, got=%q", expected, ins.String())
+	}
+}
+
+func TestCompile(t *testing.T) {
+	bytecode := compile(t, `let a = 1
+func f(x) {
+  if (x > a) { return x }
+  -x
+}
+print(f(2), "s", 1)
+`)
+	main := `0000 OpConstant 0
+0003 OpSetGlobal 1
+0006 OpClosure 3
+0009 OpSetGlobal 4
+0012 OpGetGlobal 0 5
+0016 OpGetGlobal 0 4
+0020 OpConstant 6
+0023 OpCall 1
+0025 OpConstant 7
+0028 OpConstant 0
+0031 OpCall 3
+0033 OpReturn
+`
+	if got := Instructions(bytecode.Main.Instructions).String(); got != main {
+		t.Errorf("main: expected=\n%s\ngot=\n%s", main, got)
+	}
+	f := bytecode.Constants[3].(*environment.CompiledFunction)
+	body := `0000 OpGetLocal 0 0 2
+0006 OpGetGlobal 1 1
+0010 OpGreater
+0011 OpJumpNotTruthy 25
+0014 OpGetLocal 0 0 2
+0020 OpReturn
+0021 OpNull
+0022 OpJump 26
+0025 OpNull
+0026 OpPop
+0027 OpGetLocal 0 0 2
+0033 OpMinus
+0034 OpReturn
+`
+	if got := Instructions(f.Instructions).String(); got != body {
+		t.Errorf("f: expected=\n%s\ngot=\n%s", body, got)
+	}
+	if f.Parameters != 1 || f.Locals != 1 || f.Source != "func(x) { if (x > a) { return x }; -x }" {
+		t.Errorf("unexpected function %+v", f)
+	}
+	if f.Line(0) != 3 || f.Line(27) != 4 {
+		t.Errorf("unexpected lines %v", f.Lines)
+	}
+}
+
+func TestTailCall(t *testing.T) {
+	bytecode := compile(t, "func f(n) {\n  return f(n - 1)\n}\nreturn f(1)\n")
+	main := `0000 OpClosure 3
+0003 OpSetGlobal 0
+0006 OpGetGlobal 0 0
+0010 OpConstant 2
+0013 OpCall 1
+0015 OpReturn
+0016 OpNull
+0017 OpReturn
+`
+	if got := Instructions(bytecode.Main.Instructions).String(); got != main {
+		t.Errorf("main: expected=\n%s\ngot=\n%s", main, got)
+	}
+	f := bytecode.Constants[3].(*environment.CompiledFunction)
+	body := `0000 OpGetGlobal 1 0
+0004 OpGetLocal 0 0 1
+0010 OpConstant 2
+0013 OpSub
+0014 OpTailCall 1
+0016 OpNull
+0017 OpReturn
+`
+	if got := Instructions(f.Instructions).String(); got != body {
+		t.Errorf("f: expected=\n%s\ngot=\n%s", body, got)
+	}
+}
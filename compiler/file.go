@@ -0,0 +1,448 @@
+package compiler
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/environment"
+)
+
+// FormatVersion is the version of the .kc layout written by WriteFile. It
+// changes whenever the layout or the instruction set does.
+const FormatVersion = 4
+
+var magic = []byte("KNFC")
+
+// ErrFormat is returned by ReadFile for data that is not a .kc file of the
+// current FormatVersion.
+var ErrFormat = errors.New("not a compiled knife file")
+
+// File is the content of a .kc file: bytecode with the interpreter version
+// that compiled it and the checksum of its source.
+type File struct {
+	Version  string
+	Checksum [sha256.Size]byte
+	Bytecode *Bytecode
+}
+
+// Checksum returns the checksum of src stored in a File.
+func Checksum(src string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(src))
+}
+
+const (
+	tagNumber byte = iota + 1
+	tagString
+	tagFunction
+)
+
+// WriteFile encodes f as: magic, format version, interpreter version,
+// checksum, constant pool and main function. Integers are uvarints and
+// strings are length-prefixed.
+func WriteFile(w io.Writer, f *File) error {
+	e := &encoder{}
+	e.buf = append(e.buf, magic...)
+	e.uint(FormatVersion)
+	e.string(f.Version)
+	e.buf = append(e.buf, f.Checksum[:]...)
+	e.uint(len(f.Bytecode.Constants))
+	for _, c := range f.Bytecode.Constants {
+		if err := e.object(c); err != nil {
+			return err
+		}
+	}
+	e.function(f.Bytecode.Main)
+	_, err := w.Write(e.buf)
+	return err
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(n int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(n))
+}
+
+func (e *encoder) string(s string) {
+	e.uint(len(s))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) object(obj environment.Object) error {
+	switch o := obj.(type) {
+	case *environment.Number:
+		e.buf = append(e.buf, tagNumber)
+		e.string(o.Value)
+	case *environment.String:
+		e.buf = append(e.buf, tagString)
+		e.string(o.Value)
+	case *environment.CompiledFunction:
+		e.buf = append(e.buf, tagFunction)
+		e.function(o)
+	default:
+		return fmt.Errorf("cannot encode constant of type %s", obj.Type())
+	}
+	return nil
+}
+
+func (e *encoder) function(f *environment.CompiledFunction) {
+	e.string(f.Name)
+	e.string(string(f.Instructions))
+	e.uint(len(f.Lines))
+	for _, l := range f.Lines {
+		e.uint(l.Offset)
+		e.uint(l.Line)
+	}
+	e.uint(len(f.Calls))
+	for _, c := range f.Calls {
+		e.uint(c.Offset)
+		e.uint(c.Span.Start.Line)
+		e.uint(c.Span.Start.Column)
+		e.uint(c.Span.End.Line)
+		e.uint(c.Span.End.Column)
+	}
+	e.uint(len(f.Arguments))
+	for _, a := range f.Arguments {
+		e.uint(a.Start)
+		e.uint(a.End)
+		e.uint(a.Line)
+		e.string(a.Source)
+	}
+	e.uint(f.Parameters)
+	e.uint(f.Locals)
+	e.string(f.Source)
+}
+
+// ReadFile decodes a File written by WriteFile. It returns an error wrapping
+// ErrFormat when r does not hold a .kc file of the current FormatVersion.
+func ReadFile(r io.Reader) (*File, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(d.r, head); err != nil || string(head) != string(magic) {
+		return nil, ErrFormat
+	}
+	if v := d.uint(); d.err == nil && v != FormatVersion {
+		return nil, fmt.Errorf("%w: format version %d, expected %d", ErrFormat, v, FormatVersion)
+	}
+	f := &File{Version: d.string(), Bytecode: &Bytecode{}}
+	d.read(f.Checksum[:])
+	n := d.uint()
+	for i := 0; i < n && d.err == nil; i++ {
+		f.Bytecode.Constants = append(f.Bytecode.Constants, d.object())
+	}
+	f.Bytecode.Main = d.function()
+	if d.err == nil {
+		d.err = verify(f.Bytecode)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, d.err)
+	}
+	f.Bytecode.link()
+	return f, nil
+}
+
+// verify checks that every function only holds whole instructions whose
+// operands refer to constants of the right type, to instructions inside it
+// and to slots of the frames it runs in, and that it never pops more values
+// than it pushed, so that the VM runs bytecode read from a file without
+// indexing out of range.
+func verify(b *Bytecode) error {
+	v := &verifier{b: b, parents: map[*environment.CompiledFunction][]*environment.CompiledFunction{}}
+	functions := []*environment.CompiledFunction{b.Main}
+	for _, c := range b.Constants {
+		if f, ok := c.(*environment.CompiledFunction); ok {
+			functions = append(functions, f)
+		}
+	}
+	starts := make([]map[int]bool, len(functions))
+	for i, f := range functions {
+		var err error
+		if starts[i], err = v.instructions(f); err != nil {
+			return err
+		}
+	}
+	for i, f := range functions {
+		if err := v.frame(f, starts[i]); err != nil {
+			return fmt.Errorf("function %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+type verifier struct {
+	b *Bytecode
+	// parents maps each function to those creating closures of it, in
+	// whose frames its closures are defined.
+	parents map[*environment.CompiledFunction][]*environment.CompiledFunction
+}
+
+// locals returns the number of slots of the frames f runs in. Main runs in
+// the global environment, which has none.
+func (v *verifier) locals(f *environment.CompiledFunction) int {
+	if f == v.b.Main {
+		return 0
+	}
+	return f.Locals
+}
+
+func (v *verifier) constant(i int, want environment.ObjectType) error {
+	if i >= len(v.b.Constants) {
+		return fmt.Errorf("constant %d out of range", i)
+	}
+	if t := v.b.Constants[i].Type(); want != "" && t != want {
+		return fmt.Errorf("constant %d is %s, expected %s", i, t, want)
+	}
+	return nil
+}
+
+// instructions checks the instructions of f one after the other and
+// returns the offsets they start at.
+func (v *verifier) instructions(f *environment.CompiledFunction) (map[int]bool, error) {
+	if f != v.b.Main && f.Parameters > f.Locals {
+		return nil, fmt.Errorf("function %s: %d parameters in %d slots", f.Name, f.Parameters, f.Locals)
+	}
+	ins := Instructions(f.Instructions)
+	if len(ins) == 0 || Opcode(ins[len(ins)-1]) != OpReturn {
+		return nil, fmt.Errorf("function %s does not end with a return", f.Name)
+	}
+	starts := map[int]bool{}
+	for i := 0; i < len(ins); {
+		starts[i] = true
+		op := Opcode(ins[i])
+		def, err := Lookup(op)
+		if err != nil {
+			return nil, err
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return nil, fmt.Errorf("function %s: truncated %s", f.Name, def.Name)
+		}
+		operands, _ := ReadOperands(def, ins[i+1:])
+		switch op {
+		case OpConstant:
+			err = v.constant(operands[0], "")
+		case OpClosure:
+			err = v.constant(operands[0], environment.COMPILED_FUNC)
+			if err == nil {
+				fn := v.b.Constants[operands[0]].(*environment.CompiledFunction)
+				v.parents[fn] = append(v.parents[fn], f)
+			}
+		case OpGetGlobal:
+			err = v.constant(operands[1], environment.STRING)
+		case OpSetGlobal, OpImport, OpMember:
+			err = v.constant(operands[0], environment.STRING)
+		case OpGetLocal:
+			err = v.constant(operands[2], environment.STRING)
+			if err == nil && operands[0] == 0 && operands[1] >= v.locals(f) {
+				err = fmt.Errorf("slot %d out of range", operands[1])
+			}
+		case OpSetLocal:
+			if operands[0] >= v.locals(f) {
+				err = fmt.Errorf("slot %d out of range", operands[0])
+			}
+		case OpJump, OpJumpNotTruthy:
+			if operands[0] >= len(ins) {
+				err = fmt.Errorf("jump to %d out of range", operands[0])
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("function %s at %d: %w", f.Name, i, err)
+		}
+		i += 1 + width
+	}
+	return starts, nil
+}
+
+// frame follows every path through the instructions of f, checking that
+// jumps land on the start of an instruction, that the stack holds the
+// operands of each instruction and has the same height wherever paths
+// meet, and that the slots f reads in enclosing frames exist.
+func (v *verifier) frame(f *environment.CompiledFunction, starts map[int]bool) error {
+	ins := Instructions(f.Instructions)
+	heights := map[int]int{}
+	type path struct{ ip, height int }
+	for work := []path{{0, 0}}; len(work) > 0; {
+		ip, height := work[len(work)-1].ip, work[len(work)-1].height
+		work = work[:len(work)-1]
+		for {
+			if !starts[ip] {
+				return fmt.Errorf("jump to %d inside an instruction", ip)
+			}
+			if h, ok := heights[ip]; ok {
+				if h != height {
+					return fmt.Errorf("at %d: stack height %d, %d on another path", ip, height, h)
+				}
+				break
+			}
+			heights[ip] = height
+			op := Opcode(ins[ip])
+			def, _ := Lookup(op)
+			operands, read := ReadOperands(def, ins[ip+1:])
+			pop, push := stackEffect(op, operands)
+			if height < pop {
+				return fmt.Errorf("at %d: %s pops %d values from %d", ip, def.Name, pop, height)
+			}
+			height += push - pop
+			if op == OpGetLocal && operands[0] > 0 {
+				if err := v.outerSlot(f, operands[0], operands[1]); err != nil {
+					return fmt.Errorf("at %d: %w", ip, err)
+				}
+			}
+			if op == OpReturn {
+				break
+			}
+			switch op {
+			case OpJump:
+				ip = operands[0]
+			case OpJumpNotTruthy:
+				work = append(work, path{operands[0], height})
+				ip += 1 + read
+			default:
+				ip += 1 + read
+			}
+		}
+	}
+	return nil
+}
+
+// stackEffect returns how many values the instruction op pops and pushes.
+func stackEffect(op Opcode, operands []int) (pop, push int) {
+	switch op {
+	case OpConstant, OpNull, OpTrue, OpFalse, OpGetLocal, OpGetGlobal, OpClosure, OpImport:
+		return 0, 1
+	case OpPop, OpSetLocal, OpSetGlobal, OpJumpNotTruthy, OpReturn:
+		return 1, 0
+	case OpAdd, OpSub, OpMul, OpDiv, OpEqual, OpNotEqual,
+		OpLess, OpLessEqual, OpGreater, OpGreaterEqual:
+		return 2, 1
+	case OpMinus, OpBang, OpMember:
+		return 1, 1
+	case OpCall, OpTailCall:
+		return operands[0] + 1, 1
+	}
+	return 0, 0
+}
+
+// outerSlot checks that slot exists in the frame depth levels above the
+// frames of f, whichever function created the closure of f. Functions no
+// closure is created of never run and are not checked.
+func (v *verifier) outerSlot(f *environment.CompiledFunction, depth, slot int) error {
+	frames := []*environment.CompiledFunction{f}
+	for ; depth > 0; depth-- {
+		var outer []*environment.CompiledFunction
+		for _, fn := range frames {
+			if fn == v.b.Main {
+				return fmt.Errorf("slot %d read above the global environment", slot)
+			}
+			outer = append(outer, v.parents[fn]...)
+		}
+		frames = outer
+	}
+	for _, fn := range frames {
+		if slot >= v.locals(fn) {
+			return fmt.Errorf("slot %d out of range of %s", slot, fn.Name)
+		}
+	}
+	return nil
+}
+
+// decoder reads values until the first error, which it keeps in err.
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) read(p []byte) {
+	if d.err == nil {
+		_, d.err = io.ReadFull(d.r, p)
+	}
+}
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = err
+		return 0
+	}
+	if n > 1<<31 {
+		d.err = fmt.Errorf("value %d out of range", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.uint()
+	if d.err != nil {
+		return ""
+	}
+	// Grow as data arrives so a corrupt length cannot allocate much.
+	var b []byte
+	for len(b) < n && d.err == nil {
+		chunk := make([]byte, min(n-len(b), 4096))
+		d.read(chunk)
+		b = append(b, chunk...)
+	}
+	return string(b)
+}
+
+func (d *decoder) object() environment.Object {
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		d.err = err
+		return nil
+	}
+	switch tag {
+	case tagNumber:
+		return &environment.Number{Value: d.string()}
+	case tagString:
+		return &environment.String{Value: d.string()}
+	case tagFunction:
+		return d.function()
+	}
+	d.err = fmt.Errorf("unknown constant tag %d", tag)
+	return nil
+}
+
+func (d *decoder) function() *environment.CompiledFunction {
+	f := &environment.CompiledFunction{
+		Name:         d.string(),
+		Instructions: []byte(d.string()),
+	}
+	n := d.uint()
+	for i := 0; i < n && d.err == nil; i++ {
+		f.Lines = append(f.Lines, environment.LineEntry{Offset: d.uint(), Line: d.uint()})
+	}
+	n = d.uint()
+	for i := 0; i < n && d.err == nil; i++ {
+		site := environment.CallSite{Offset: d.uint()}
+		site.Span.Start = ast.Position{Line: d.uint(), Column: d.uint()}
+		site.Span.End = ast.Position{Line: d.uint(), Column: d.uint()}
+		f.Calls = append(f.Calls, site)
+	}
+	n = d.uint()
+	for i := 0; i < n && d.err == nil; i++ {
+		f.Arguments = append(f.Arguments, environment.ArgumentRange{
+			Start:  d.uint(),
+			End:    d.uint(),
+			Line:   d.uint(),
+			Source: d.string(),
+		})
+	}
+	f.Parameters = d.uint()
+	f.Locals = d.uint()
+	f.Source = d.string()
+	return f
+}
@@ -0,0 +1,118 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/environment"
+)
+
+func TestFileRoundTrip(t *testing.T) {
+	src := "let a = \"s\"\nfunc f(x, y) {\n if (x > 1.5) { return y }\n return f(x + 1, a)\n}\nprint(f(0, null))\n"
+	file := &File{Version: "1.2.3", Checksum: Checksum(src), Bytecode: compile(t, src)}
+	var buf bytes.Buffer
+	if err := WriteFile(&buf, file); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	decoded, err := ReadFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(file, decoded) {
+		t.Fatalf("decoded file differs:\n%+v\n%+v", file, decoded)
+	}
+
+	for _, corrupt := range [][]byte{
+		nil,
+		[]byte("KNFX"),
+		append([]byte("KNFC"), 99),
+		data[:len(data)-3],
+	} {
+		if _, err := ReadFile(bytes.NewReader(corrupt)); !errors.Is(err, ErrFormat) {
+			t.Errorf("%q: expected ErrFormat, got %v", corrupt, err)
+		}
+	}
+
+	// point the first OpConstant of main past the constant pool
+	bad := *file.Bytecode.Main
+	bad.Instructions = append([]byte{}, bad.Instructions...)
+	bad.Instructions[1], bad.Instructions[2] = 0xff, 0xff
+	buf.Reset()
+	WriteFile(&buf, &File{Bytecode: &Bytecode{Main: &bad, Constants: file.Bytecode.Constants}})
+	if _, err := ReadFile(&buf); !errors.Is(err, ErrFormat) {
+		t.Fatalf("expected ErrFormat for an out of range constant, got %v", err)
+	}
+}
+
+// roundTrip writes and reads back b, as the VM would load it from a file.
+func roundTrip(b *Bytecode) error {
+	var buf bytes.Buffer
+	if err := WriteFile(&buf, &File{Bytecode: b}); err != nil {
+		return err
+	}
+	_, err := ReadFile(&buf)
+	return err
+}
+
+func TestVerifyCompiled(t *testing.T) {
+	for _, src := range []string{
+		"let a = 1\nprint(a + 2 * 3)\n",
+		"func f(x) {\n func g(y) {\n  func h() {\n   return x + y\n  }\n  return h()\n }\n return g(2)\n}\nprint(f(1))\n",
+		"func f(n) {\n if (n < 1) { return 0 } else if (n < 2) { return 1 }\n return f(n - 1)\n}\nprint(if (f(3) == 0) { -1 } else { !true })\n",
+		"import \"./m.k\" as m\nprint(m.x)\n",
+	} {
+		if err := roundTrip(compile(t, src)); err != nil {
+			t.Errorf("%q: %v", src, err)
+		}
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	// g reads x, the slot 0 of the frame of f
+	b := compile(t, "func f(x) {\n func g() {\n  return x\n }\n return g()\n}\nprint(f(1))\n")
+	var g *environment.CompiledFunction
+	for _, c := range b.Constants {
+		if fn, ok := c.(*environment.CompiledFunction); ok && fn.Name == "g" {
+			g = fn
+		}
+	}
+	if g == nil || Opcode(g.Instructions[0]) != OpGetLocal || g.Instructions[1] != 1 {
+		t.Fatalf("expected g to start by reading an outer local:\n%s", Instructions(g.Instructions))
+	}
+	g.Instructions[2], g.Instructions[3] = 0, 99
+	if err := roundTrip(b); !errors.Is(err, ErrFormat) || !strings.Contains(err.Error(), "slot 99 out of range of f") {
+		t.Fatalf("expected an out of range outer slot to be rejected, got %v", err)
+	}
+	g.Instructions[1], g.Instructions[3] = 3, 0
+	if err := roundTrip(b); !errors.Is(err, ErrFormat) || !strings.Contains(err.Error(), "above the global environment") {
+		t.Fatalf("expected a slot above the global environment to be rejected, got %v", err)
+	}
+
+	main := func(parts ...[]byte) *Bytecode {
+		fn := &environment.CompiledFunction{Name: "main"}
+		for _, p := range parts {
+			fn.Instructions = append(fn.Instructions, p...)
+		}
+		return &Bytecode{Main: fn}
+	}
+	for name, tt := range map[string]struct {
+		b        *Bytecode
+		expected string
+	}{
+		"underflow":    {main(Make(OpNull), Make(OpAdd), Make(OpReturn)), "OpAdd pops 2 values from 1"},
+		"call":         {main(Make(OpNull), Make(OpCall, 3), Make(OpReturn)), "OpCall pops 4 values from 1"},
+		"empty return": {main(Make(OpReturn)), "OpReturn pops 1 values from 0"},
+		"mid jump":     {main(Make(OpJump, 5), Make(OpNull), Make(OpCall, 0), Make(OpReturn)), "jump to 5 inside an instruction"},
+		"heights": {main(Make(OpTrue), Make(OpJumpNotTruthy, 6), Make(OpNull), Make(OpNull), Make(OpReturn)),
+			"stack height"},
+		"main local": {main(Make(OpNull), Make(OpSetLocal, 0), Make(OpNull), Make(OpReturn)), "slot 0 out of range"},
+	} {
+		if err := roundTrip(tt.b); !errors.Is(err, ErrFormat) || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected %q, got %v", name, tt.expected, err)
+		}
+	}
+}
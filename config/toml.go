@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Table maps keys to values of type string, int64, bool or []any.
+type Table map[string]any
+
+// Document is a parsed configuration file. Keys outside of any [section]
+// live in the table named "".
+type Document map[string]Table
+
+// Parse reads the subset of TOML used by knife configuration files:
+// [section] headers, comments and key = value pairs whose values are
+// strings, integers, booleans or single-line arrays of those.
+func Parse(src string) (Document, error) {
+	doc := Document{"": Table{}}
+	section := ""
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section header", i+1)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section == "" {
+				return nil, fmt.Errorf("line %d: empty section name", i+1)
+			}
+			if _, ok := doc[section]; !ok {
+				doc[section] = Table{}
+			}
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		key = unquoteKey(strings.TrimSpace(key))
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		doc[section][key] = value
+	}
+	return doc, nil
+}
+
+func parseValue(raw string) (any, error) {
+	switch {
+	case raw == "":
+		return nil, fmt.Errorf("missing value")
+	case raw == "true":
+		return true, nil
+	case raw == "false":
+		return false, nil
+	case raw[0] == '"' || raw[0] == '\'':
+		if len(raw) < 2 || raw[len(raw)-1] != raw[0] {
+			return nil, fmt.Errorf("unterminated string %s", raw)
+		}
+		if raw[0] == '\'' {
+			return raw[1 : len(raw)-1], nil
+		}
+		return strconv.Unquote(raw)
+	case raw[0] == '[':
+		if raw[len(raw)-1] != ']' {
+			return nil, fmt.Errorf("unterminated array %s", raw)
+		}
+		var values []any
+		for _, item := range splitArray(raw[1 : len(raw)-1]) {
+			v, err := parseValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	i, err := strconv.ParseInt(strings.ReplaceAll(raw, "_", ""), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported value %s", raw)
+	}
+	return i, nil
+}
+
+func splitArray(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquoteKey(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
+
+func (t Table) String(key string) (string, bool, error) {
+	v, ok := t[key]
+	if !ok {
+		return "", false, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", true, fmt.Errorf("%s: expected a string", key)
+	}
+	return s, true, nil
+}
+
+func (t Table) Int(key string) (int, bool, error) {
+	v, ok := t[key]
+	if !ok {
+		return 0, false, nil
+	}
+	i, ok := v.(int64)
+	if !ok {
+		return 0, true, fmt.Errorf("%s: expected an integer", key)
+	}
+	return int(i), true, nil
+}
+
+func (t Table) Bool(key string) (bool, bool, error) {
+	v, ok := t[key]
+	if !ok {
+		return false, false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, true, fmt.Errorf("%s: expected a boolean", key)
+	}
+	return b, true, nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := `
+# project manifest
+name = "demo" # trailing comment
+version = '1.0.0'
+
+[fmt]
+indent = 2
+semicolons = "always"
+trailing_commas = true
+include = ["src", "lib # not a comment"]
+
+[dependencies]
+"math-lib" = "../math"
+`
+	doc, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Document{
+		"": {"name": "demo", "version": "1.0.0"},
+		"fmt": {
+			"indent":          int64(2),
+			"semicolons":      "always",
+			"trailing_commas": true,
+			"include":         []any{"src", "lib # not a comment"},
+		},
+		"dependencies": {"math-lib": "../math"},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("expected=%#v\ngot=%#v", expected, doc)
+	}
+
+	if v, ok, err := doc["fmt"].Int("indent"); v != 2 || !ok || err != nil {
+		t.Fatalf("Int: got=%d, %v, %v", v, ok, err)
+	}
+	if _, _, err := doc["fmt"].Int("semicolons"); err == nil {
+		t.Fatalf("Int: expected type error")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{"[fmt", "key", "key = ", `key = "open`, "key = [1, 2", "key = what"} {
+		if _, err := Parse(src); err == nil {
+			t.Fatalf("expected error for %q", src)
+		}
+	}
+}
@@ -0,0 +1,545 @@
+package environment
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ToObject converts a Go value into the equivalent Knife object.
+// Numbers become Number, slices and arrays become Array, maps and structs
+// become Hash and functions become Builtin.
+func ToObject(v any) (Object, error) {
+	if obj, ok := v.(Object); ok {
+		return obj, nil
+	}
+	return toObject(reflect.ValueOf(v), visiting{})
+}
+
+// visiting holds the pointers, maps and slices a value being converted is
+// inside of, to report cycles.
+type visiting map[reference]bool
+
+type reference struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// enter marks v as being converted, or fails when it already is.
+func (seen visiting) enter(v reflect.Value) (reference, error) {
+	ref := reference{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		ref.len = v.Len()
+	}
+	if seen[ref] {
+		return ref, fmt.Errorf("cannot convert a cyclic %s", v.Type())
+	}
+	seen[ref] = true
+	return ref, nil
+}
+
+func toObject(v reflect.Value, seen visiting) (Object, error) {
+	if !v.IsValid() {
+		return &Null{}, nil
+	}
+	if v.CanInterface() {
+		if obj, ok := v.Interface().(Object); ok {
+			return obj, nil
+		}
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return &Boolean{Value: v.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Number{Value: strconv.FormatInt(v.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Number{Value: strconv.FormatUint(v.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Number{Value: strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits())}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return &Null{}, nil
+		}
+		return toObject(v.Elem(), seen)
+	case reflect.Pointer:
+		if v.IsNil() {
+			return &Null{}, nil
+		}
+		ref, err := seen.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(seen, ref)
+		return toObject(v.Elem(), seen)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return &Null{}, nil
+			}
+			ref, err := seen.enter(v)
+			if err != nil {
+				return nil, err
+			}
+			defer delete(seen, ref)
+		}
+		elements := make([]Object, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, err := toObject(v.Index(i), seen)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elements = append(elements, e)
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return &Null{}, nil
+		}
+		ref, err := seen.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(seen, ref)
+		hash := &Hash{Pairs: map[HashKey]HashPair{}}
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := toObject(iter.Key(), seen)
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := toObject(iter.Value(), seen)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", key.Inspect(), err)
+			}
+			hash.Pairs[hashable.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return hash, nil
+	case reflect.Struct:
+		hash := &Hash{Pairs: map[HashKey]HashPair{}}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			value, err := toObject(v.Field(i), seen)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			key := &String{Value: name}
+			hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return hash, nil
+	case reflect.Func:
+		if v.IsNil() {
+			return &Null{}, nil
+		}
+		return newBuiltin("func", v)
+	}
+	return nil, fmt.Errorf("unsupported go type: %s", v.Type())
+}
+
+// FromObject stores the Go representation of obj into out.
+func FromObject[T any](obj Object, out *T) error {
+	return fromObject(obj, reflect.ValueOf(out).Elem(), nil)
+}
+
+// fromObject stores obj into v. Script functions are converted to Go
+// functions calling them back through caller, and cannot be when it is nil.
+func fromObject(obj Object, v reflect.Value, caller Caller) error {
+	if obj == nil {
+		obj = &Null{}
+	}
+	t := v.Type()
+	if reflect.TypeOf(obj).AssignableTo(t) && !(t.Kind() == reflect.Interface && t.NumMethod() == 0) {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+	if obj.Type() == NULL {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		return conversionError(obj, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		v.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := obj.(*Number)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		i, err := strconv.ParseInt(n.Value, 10, t.Bits())
+		if err != nil {
+			return conversionError(obj, t)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := obj.(*Number)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		u, err := strconv.ParseUint(n.Value, 10, t.Bits())
+		if err != nil {
+			return conversionError(obj, t)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		n, ok := obj.(*Number)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		f, err := strconv.ParseFloat(n.Value, t.Bits())
+		if err != nil {
+			return conversionError(obj, t)
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		v.SetString(s.Value)
+	case reflect.Pointer:
+		p := reflect.New(t.Elem())
+		if err := fromObject(obj, p.Elem(), caller); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return conversionError(obj, t)
+		}
+		native, err := toNative(obj)
+		if err != nil {
+			return err
+		}
+		if native == nil {
+			v.Set(reflect.Zero(t))
+		} else {
+			v.Set(reflect.ValueOf(native))
+		}
+	case reflect.Slice:
+		a, ok := obj.(*Array)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		s := reflect.MakeSlice(t, len(a.Elements), len(a.Elements))
+		for i, e := range a.Elements {
+			if err := fromObject(e, s.Index(i), caller); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		a, ok := obj.(*Array)
+		if !ok || len(a.Elements) != t.Len() {
+			return conversionError(obj, t)
+		}
+		for i, e := range a.Elements {
+			if err := fromObject(e, v.Index(i), caller); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+	case reflect.Map:
+		h, ok := obj.(*Hash)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		m := reflect.MakeMapWithSize(t, len(h.Pairs))
+		for _, pair := range h.Pairs {
+			key := reflect.New(t.Key()).Elem()
+			if err := fromObject(pair.Key, key, caller); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := fromObject(pair.Value, value, caller); err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		h, ok := obj.(*Hash)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			key := &String{Value: name}
+			pair, ok := h.Pairs[key.HashKey()]
+			if !ok {
+				continue
+			}
+			if err := fromObject(pair.Value, v.Field(i), caller); err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+		}
+	case reflect.Func:
+		call, err := goCallee(obj, t, caller)
+		if err != nil {
+			return err
+		}
+		v.Set(goFunc(t, call))
+	default:
+		return conversionError(obj, t)
+	}
+	return nil
+}
+
+// NewBuiltin wraps an arbitrary Go function as a Builtin. Arguments are
+// converted with FromObject when the builtin is called, so a mismatch is
+// reported as an *ArgumentError instead of a panic. A trailing error result
+// is the error of the call. A leading *CallContext parameter receives the
+// context of the call and is not a script argument.
+func NewBuiltin(name string, fn any) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("%s is not a function", name)
+	}
+	return newBuiltin(name, v)
+}
+
+func newBuiltin(name string, fn reflect.Value) (*Builtin, error) {
+	t := fn.Type()
+	numOut := t.NumOut()
+	if numOut > 2 || numOut == 2 && t.Out(1) != errorType {
+		return nil, fmt.Errorf("%s: unsupported results: %s", name, t)
+	}
+	withContext := t.NumIn() > 0 && t.In(0) == contextType
+	return &Builtin{
+		Name: name,
+		Function: func(ctx *CallContext) (Object, error) {
+			in, err := builtinArguments(t, withContext, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if withContext {
+				in[0] = reflect.ValueOf(ctx)
+			}
+			out := fn.Call(in)
+			if len(out) > 0 && t.Out(len(out)-1) == errorType {
+				if err, _ := out[len(out)-1].Interface().(error); err != nil {
+					return nil, err
+				}
+				out = out[:len(out)-1]
+			}
+			if len(out) == 0 {
+				return &Null{}, nil
+			}
+			return toObject(out[0], visiting{})
+		},
+	}, nil
+}
+
+var contextType = reflect.TypeOf((*CallContext)(nil))
+
+// noCaller is the Caller of builtins converted to Go functions, which run
+// outside of any engine.
+type noCaller struct{}
+
+func (noCaller) Call(fn Object, args ...Object) (Object, error) {
+	return nil, fmt.Errorf("cannot call %s outside of a script", fn.Inspect())
+}
+
+// builtinArguments converts the arguments of ctx for a call of a function
+// of type t, leaving room for the *CallContext first when withContext is
+// set.
+func builtinArguments(t reflect.Type, withContext bool, ctx *CallContext) ([]reflect.Value, error) {
+	args := ctx.Args
+	skip := 0
+	if withContext {
+		skip = 1
+	}
+	numIn := t.NumIn() - skip
+	if t.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, &ArgumentError{Index: -1, Message: fmt.Sprintf("expected at least %d arguments, got %d", numIn-1, len(args))}
+		}
+	} else if len(args) != numIn {
+		return nil, &ArgumentError{Index: -1, Message: fmt.Sprintf("expected %d arguments, got %d", numIn, len(args))}
+	}
+	in := make([]reflect.Value, skip+len(args))
+	for i, a := range args {
+		var pt reflect.Type
+		if t.IsVariadic() && i >= numIn-1 {
+			pt = t.In(t.NumIn() - 1).Elem()
+		} else {
+			pt = t.In(skip + i)
+		}
+		in[skip+i] = reflect.New(pt).Elem()
+		if err := fromObject(a, in[skip+i], ctx.Caller); err != nil {
+			return nil, &ArgumentError{Index: i, Message: err.Error(), Err: err}
+		}
+	}
+	return in, nil
+}
+
+// goCallee returns how a Go function of type t calls obj. Calling a script
+// can fail, so t must have a trailing error result.
+func goCallee(obj Object, t reflect.Type, caller Caller) (func(args []Object) (Object, error), error) {
+	if t.NumOut() == 0 || t.NumOut() > 2 || t.Out(t.NumOut()-1) != errorType {
+		return nil, fmt.Errorf("cannot convert %s to %s: the function must return an error last", obj.Type(), t)
+	}
+	switch obj.Type() {
+	case BUILTIN:
+		b := obj.(*Builtin)
+		if caller == nil {
+			caller = noCaller{}
+		}
+		return func(args []Object) (Object, error) {
+			res, err := b.Function(&CallContext{Caller: caller, Name: b.Name, Stdout: os.Stdout, Stderr: os.Stderr, Args: args})
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", b.Name, err)
+			}
+			return res, nil
+		}, nil
+	case FUNCTION_DEFINE, CLOSURE:
+		if caller == nil {
+			return nil, fmt.Errorf("cannot convert %s to %s outside of a script", obj.Type(), t)
+		}
+		return func(args []Object) (Object, error) {
+			return caller.Call(obj, args...)
+		}, nil
+	}
+	return nil, conversionError(obj, t)
+}
+
+// goFunc returns a Go function of type t converting its arguments to
+// objects, passing them to call and converting the result back. Failed
+// conversions are returned as errors, never panics.
+func goFunc(t reflect.Type, call func(args []Object) (Object, error)) reflect.Value {
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.New(t.Out(i)).Elem()
+		}
+		err := func() error {
+			args, err := goArguments(t, in)
+			if err != nil {
+				return err
+			}
+			res, err := call(args)
+			if err != nil {
+				return err
+			}
+			if len(out) == 2 {
+				if err := fromObject(res, out[0], nil); err != nil {
+					out[0] = reflect.New(t.Out(0)).Elem()
+					return fmt.Errorf("result: %w", err)
+				}
+			}
+			return nil
+		}()
+		if err != nil {
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+		}
+		return out
+	})
+}
+
+// goArguments converts the arguments in of a call of a Go function of type
+// t to objects.
+func goArguments(t reflect.Type, in []reflect.Value) ([]Object, error) {
+	var values []reflect.Value
+	for i, v := range in {
+		if t.IsVariadic() && i == len(in)-1 {
+			for j := 0; j < v.Len(); j++ {
+				values = append(values, v.Index(j))
+			}
+			continue
+		}
+		values = append(values, v)
+	}
+	args := make([]Object, len(values))
+	for i, v := range values {
+		obj, err := toObject(v, visiting{})
+		if err != nil {
+			return nil, &ArgumentError{Index: i, Message: err.Error(), Err: err}
+		}
+		args[i] = obj
+	}
+	return args, nil
+}
+
+func toNative(obj Object) (any, error) {
+	switch o := obj.(type) {
+	case *Null:
+		return nil, nil
+	case *Boolean:
+		return o.Value, nil
+	case *String:
+		return o.Value, nil
+	case *Number:
+		if !strings.Contains(o.Value, ".") {
+			if i, err := strconv.ParseInt(o.Value, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		f, err := strconv.ParseFloat(o.Value, 64)
+		if err != nil {
+			return nil, conversionError(obj, reflect.TypeOf(f))
+		}
+		return f, nil
+	case *Array:
+		res := make([]any, len(o.Elements))
+		for i, e := range o.Elements {
+			v, err := toNative(e)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = v
+		}
+		return res, nil
+	case *Hash:
+		res := make(map[string]any, len(o.Pairs))
+		for _, pair := range o.Pairs {
+			v, err := toNative(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			res[pair.Key.Inspect()] = v
+		}
+		return res, nil
+	}
+	return obj, nil
+}
+
+func fieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	tag := f.Tag.Get("knife")
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return f.Name, true
+}
+
+func conversionError(obj Object, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s %s to %s", obj.Type(), obj.Inspect(), t)
+}
@@ -0,0 +1,274 @@
+package environment
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/ast"
+)
+
+type point struct {
+	X     int    `knife:"x"`
+	Y     int    `knife:"y"`
+	Label string `knife:"label"`
+	Skip  string `knife:"-"`
+	note  string
+}
+
+func TestToObject(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{2.5, "2.5"},
+		{"knife", "knife"},
+		{true, "true"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{map[string]int{"b": 2, "a": 1}, "{a: 1, b: 2}"},
+		{point{X: 1, Y: 2, Label: "p", Skip: "s"}, "{label: p, x: 1, y: 2}"},
+		{&point{X: 3}, "{label: , x: 3, y: 0}"},
+	}
+	for i, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Fatalf("tests[%d] - unexpected error: %v", i, err)
+		}
+		if obj.Inspect() != tt.expected {
+			t.Fatalf("tests[%d] - expected=%q, got=%q", i, tt.expected, obj.Inspect())
+		}
+	}
+}
+
+type node struct {
+	Name string
+	Next *node
+}
+
+func TestToObjectCycles(t *testing.T) {
+	self := &node{Name: "a"}
+	self.Next = self
+	loop := map[string]any{}
+	loop["self"] = loop
+	nested := make([]any, 1)
+	nested[0] = nested
+	for i, v := range []any{self, loop, nested} {
+		if _, err := ToObject(v); err == nil || !strings.Contains(err.Error(), "cannot convert a cyclic") {
+			t.Fatalf("tests[%d] - expected a cycle error, got=%v", i, err)
+		}
+	}
+
+	shared := &node{Name: "b"}
+	obj, err := ToObject([]*node{shared, shared})
+	if err != nil {
+		t.Fatalf("unexpected error for a shared value: %v", err)
+	}
+	if obj.Inspect() != "[{Name: b, Next: null}, {Name: b, Next: null}]" {
+		t.Fatalf("unexpected object: %s", obj.Inspect())
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	var i int
+	if err := FromObject(&Number{Value: "12"}, &i); err != nil || i != 12 {
+		t.Fatalf("int: got=%d, err=%v", i, err)
+	}
+	if err := FromObject(&Number{Value: "1.5"}, &i); err == nil {
+		t.Fatalf("int: expected error converting 1.5")
+	}
+
+	var f float64
+	if err := FromObject(&Number{Value: "1.5"}, &f); err != nil || f != 1.5 {
+		t.Fatalf("float: got=%v, err=%v", f, err)
+	}
+
+	var s []string
+	arr := &Array{Elements: []Object{&String{Value: "a"}, &String{Value: "b"}}}
+	if err := FromObject(arr, &s); err != nil || !reflect.DeepEqual(s, []string{"a", "b"}) {
+		t.Fatalf("slice: got=%v, err=%v", s, err)
+	}
+
+	obj, err := ToObject(point{X: 1, Y: 2, Label: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p point
+	if err := FromObject(obj, &p); err != nil || p != (point{X: 1, Y: 2, Label: "p"}) {
+		t.Fatalf("struct: got=%+v, err=%v", p, err)
+	}
+
+	var v any
+	if err := FromObject(arr, &v); err != nil || !reflect.DeepEqual(v, []any{"a", "b"}) {
+		t.Fatalf("any: got=%v, err=%v", v, err)
+	}
+
+	var str string
+	if err := FromObject(&Number{Value: "1"}, &str); err == nil {
+		t.Fatalf("string: expected error converting NUMBER")
+	}
+}
+
+// call calls b with args outside of any engine.
+func call(b *Builtin, args ...Object) (Object, error) {
+	return b.Function(&CallContext{Name: b.Name, Args: args})
+}
+
+func TestNewBuiltin(t *testing.T) {
+	add, err := NewBuiltin("add", func(a, b int) int { return a + b })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := call(add, &Number{Value: "1"}, &Number{Value: "2"}); err != nil || res.Inspect() != "3" {
+		t.Fatalf("expected=3, got=%v (%v)", res, err)
+	}
+	var argErr *ArgumentError
+	if _, err := call(add, &Number{Value: "1"}); !errors.As(err, &argErr) || argErr.Index != -1 {
+		t.Fatalf("expected arity error, got=%v", err)
+	}
+	if _, err := call(add, &Number{Value: "1"}, &String{Value: "2"}); !errors.As(err, &argErr) || argErr.Index != 1 ||
+		err.Error() != "argument 2: cannot convert STRING 2 to int" {
+		t.Fatalf("expected type error on argument 2, got=%v", err)
+	}
+
+	join, err := NewBuiltin("join", func(sep string, parts ...string) (string, error) {
+		if len(parts) == 0 {
+			return "", errors.New("nothing to join")
+		}
+		out := parts[0]
+		for _, p := range parts[1:] {
+			out += sep + p
+		}
+		return out, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := call(join, &String{Value: "-"}, &String{Value: "a"}, &String{Value: "b"}); err != nil || res.Inspect() != "a-b" {
+		t.Fatalf("expected=a-b, got=%v (%v)", res, err)
+	}
+	if _, err := call(join, &String{Value: "-"}); err == nil || err.Error() != "nothing to join" {
+		t.Fatalf("expected error, got=%v", err)
+	}
+
+	var goAdd func(int, int) (int, error)
+	if err := FromObject(add, &goAdd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := goAdd(2, 3); err != nil || n != 5 {
+		t.Fatalf("expected=5, got=%d (%v)", n, err)
+	}
+	var goConcat func(string, string) (string, error)
+	if err := FromObject(add, &goConcat); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goConcat("a", "b"); !errors.As(err, &argErr) || argErr.Index != 0 {
+		t.Fatalf("expected argument error, got=%v", err)
+	}
+	var goAddChan func(chan int) (int, error)
+	if err := FromObject(add, &goAddChan); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goAddChan(nil); !errors.As(err, &argErr) || !strings.Contains(err.Error(), "unsupported go type") {
+		t.Fatalf("expected argument error for an unconvertible argument, got=%v", err)
+	}
+	var goAddString func(int, int) (string, error)
+	if err := FromObject(add, &goAddString); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goAddString(2, 3); err == nil || err.Error() != "result: cannot convert NUMBER 5 to string" {
+		t.Fatalf("expected result conversion error, got=%v", err)
+	}
+	var goAddNoError func(int, int) int
+	if err := FromObject(add, &goAddNoError); err == nil || !strings.Contains(err.Error(), "must return an error last") {
+		t.Fatalf("expected error converting to a function without error result, got=%v", err)
+	}
+
+	if _, err := NewBuiltin("bad", 1); err == nil {
+		t.Fatalf("expected error for non-function")
+	}
+}
+
+// echoCaller returns the inspected function and arguments instead of
+// calling them.
+type echoCaller struct{}
+
+func (echoCaller) Call(fn Object, args ...Object) (Object, error) {
+	s := fn.Inspect()
+	for _, a := range args {
+		s += " " + a.Inspect()
+	}
+	return &String{Value: s}, nil
+}
+
+func TestNewBuiltinContext(t *testing.T) {
+	apply, err := NewBuiltin("apply", func(ctx *CallContext, f Object, args ...Object) (Object, error) {
+		return ctx.Call(f, args...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &CallContext{Caller: echoCaller{}, Name: "apply", Args: []Object{&String{Value: "f"}, &Number{Value: "1"}}}
+	if res, err := apply.Function(ctx); err != nil || res.Inspect() != "f 1" {
+		t.Fatalf("expected=f 1, got=%v (%v)", res, err)
+	}
+	ctx.Args = nil
+	if _, err := apply.Function(ctx); err == nil || err.Error() != "expected at least 1 arguments, got 0" {
+		t.Fatalf("expected arity error without the context, got=%v", err)
+	}
+
+	var goApply func(Object) (Object, error)
+	if err := FromObject(apply, &goApply); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goApply(&String{Value: "f"}); err == nil || !strings.Contains(err.Error(), "outside of a script") {
+		t.Fatalf("expected an error calling back outside of a script, got=%v", err)
+	}
+}
+
+func TestNewBuiltinScriptCallback(t *testing.T) {
+	each, err := NewBuiltin("each", func(f func(int) (string, error)) (string, error) {
+		return f(1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := &Closure{Fn: &CompiledFunction{Source: "f"}}
+	ctx := &CallContext{Caller: echoCaller{}, Name: "each", Args: []Object{fn}}
+	if res, err := each.Function(ctx); err != nil || res.Inspect() != "f 1" {
+		t.Fatalf("expected=f 1, got=%v (%v)", res, err)
+	}
+
+	var goFn func(int) (string, error)
+	if err := FromObject(Object(fn), &goFn); err == nil || !strings.Contains(err.Error(), "outside of a script") {
+		t.Fatalf("expected an error converting a script function without a caller, got=%v", err)
+	}
+}
+
+func TestCallContextExpect(t *testing.T) {
+	ctx := &CallContext{Name: "f", Args: []Object{&String{Value: "a"}, &Number{Value: "1"}}}
+	if err := ctx.ExpectArgs(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.ExpectArgs(1); err == nil || err.Error() != "expected 1 arguments, got 2" {
+		t.Fatalf("expected arity error, got=%v", err)
+	}
+	if s, err := ctx.ExpectString(0); err != nil || s != "a" {
+		t.Fatalf("expected=a, got=%q (%v)", s, err)
+	}
+	if _, err := ctx.ExpectString(1); err == nil || err.Error() != "argument 2: expected STRING, got NUMBER" {
+		t.Fatalf("expected type error, got=%v", err)
+	}
+	if _, err := ctx.ExpectString(2); err == nil || err.Error() != "expected at least 3 arguments, got 2" {
+		t.Fatalf("expected arity error, got=%v", err)
+	}
+
+	err := error(&BuiltinError{Name: "f", Span: ast.Span{Start: ast.Position{Line: 3, Column: 5}}, Err: ctx.ExpectArgs(0)})
+	var argErr *ArgumentError
+	if err.Error() != "line: 3, error: f: expected 0 arguments, got 2" || !errors.As(err, &argErr) {
+		t.Fatalf("unexpected builtin error: %v", err)
+	}
+}
@@ -1,9 +1,15 @@
 package environment
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type Environment struct {
-	vars   map[string]Object
+	vars map[string]Object
+	// slots hold the locals of a function frame, indexed as assigned by
+	// the resolver.
+	slots  []Object
 	parent *Environment
 }
 
@@ -14,18 +20,72 @@ func NewEnvironment(parent *Environment) *Environment {
 	}
 }
 
-func (e *Environment) Get(id string) (Object, error) {
-	if e == nil {
-		return nil, fmt.Errorf("undefined identifier: %s\n", id)
+// NewFrame returns a function frame with size slots. Names set on a frame
+// are kept in a map created on first use.
+func NewFrame(parent *Environment, size int) *Environment {
+	return &Environment{
+		slots:  make([]Object, size),
+		parent: parent,
+	}
+}
+
+// Outer returns the environment depth levels above e, or nil when e has
+// fewer parents.
+func (e *Environment) Outer(depth int) *Environment {
+	for ; depth > 0 && e != nil; depth-- {
+		e = e.parent
 	}
-	if obj, ok := e.vars[id]; ok {
+	return e
+}
+
+// Slot returns the value of a slot, or nil when it has not been set yet.
+func (e *Environment) Slot(slot int) Object {
+	return e.slots[slot]
+}
+
+func (e *Environment) SetSlot(slot int, obj Object) {
+	e.slots[slot] = obj
+}
+
+// Lookup returns the object bound to id in e itself, without looking at
+// the parents.
+func (e *Environment) Lookup(id string) (Object, bool) {
+	obj, ok := e.vars[id]
+	return obj, ok
+}
+
+func (e *Environment) Get(id string) (Object, error) {
+	if obj, ok := e.Find(id); ok {
 		return obj, nil
 	}
-	return e.parent.Get(id)
+	return nil, fmt.Errorf("undefined identifier: %s\n", id)
+}
+
+// Find looks id up in e and its parents.
+func (e *Environment) Find(id string) (Object, bool) {
+	for ; e != nil; e = e.parent {
+		if obj, ok := e.vars[id]; ok {
+			return obj, true
+		}
+	}
+	return nil, false
 }
 
 func (e *Environment) Set(id string, obj Object) (Object, error) {
 	// TODO: do we allow repeated definition?
+	if e.vars == nil {
+		e.vars = map[string]Object{}
+	}
 	e.vars[id] = obj
 	return obj, nil
 }
+
+// Names returns the identifiers defined directly in e, sorted.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.vars))
+	for name := range e.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
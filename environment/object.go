@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"io"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/Serein-sz/knife/ast"
@@ -22,8 +25,15 @@ const (
 	BOOLEAN         = "BOOLEAN"
 	RETURN_VALUE    = "RETURN_VALUE"
 	FUNCTION_DEFINE = "FUNCTION_DEFINE"
+	COMPILED_FUNC   = "COMPILED_FUNCTION"
+	CLOSURE         = "CLOSURE"
 	BUILTIN         = "BUILTIN"
 	NULL            = "NULL"
+	ARRAY           = "ARRAY"
+	HASH            = "HASH"
+	ERROR           = "ERROR"
+	MODULE          = "MODULE"
+	REGEX           = "REGEX"
 )
 
 type HashKey struct {
@@ -96,6 +106,17 @@ func (b *Boolean) Type() ObjectType {
 	return BOOLEAN
 }
 
+func (b *Boolean) HashKey() HashKey {
+	var key uint64
+	if b.Value {
+		key = 1
+	}
+	return HashKey{
+		Type: b.Type(),
+		Key:  key,
+	}
+}
+
 type Null struct {
 }
 
@@ -124,6 +145,8 @@ type FunctionDefine struct {
 	Value      Object
 	Body       *ast.BlockStatement
 	Env        *Environment
+	// Locals is the frame size assigned by the resolver.
+	Locals int
 }
 
 func (f *FunctionDefine) Inspect() string {
@@ -134,13 +157,11 @@ func (f *FunctionDefine) Inspect() string {
 		params = append(params, p.String())
 	}
 
-	out.WriteString("fn")
+	out.WriteString("func")
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ","))
-	out.WriteString(")")
-	out.WriteString("{")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
 	out.WriteString(f.Body.String())
-	out.WriteString("}\n")
 
 	return out.String()
 }
@@ -149,15 +170,279 @@ func (f *FunctionDefine) Type() ObjectType {
 	return FUNCTION_DEFINE
 }
 
+// CompiledFunction is a function lowered to bytecode by the compiler.
+type CompiledFunction struct {
+	Name         string
+	Instructions []byte
+	// Lines maps instruction offsets to source lines.
+	Lines []LineEntry
+	// Calls records the source range of each call instruction, by offset.
+	Calls []CallSite
+	// Arguments lists the instructions of each call argument, innermost
+	// first, so errors can name the argument they came from.
+	Arguments  []ArgumentRange
+	Parameters int
+	// Locals is the frame size, parameters included.
+	Locals int
+	// Source is the function as the evaluator prints it.
+	Source string
+	// Constants is the constant pool of the bytecode the function belongs
+	// to. It is shared by all its functions and not part of the .kc format.
+	Constants []Object
+}
+
+// LineEntry records that the instructions from Offset on come from Line.
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+// CallSite records that the call instruction at Offset comes from Span.
+type CallSite struct {
+	Offset int
+	Span   ast.Span
+}
+
+// ArgumentRange spans the instructions [Start, End) computing an argument.
+type ArgumentRange struct {
+	Start, End int
+	Line       int
+	Source     string
+}
+
+func (f *CompiledFunction) Inspect() string {
+	return f.Source
+}
+
+func (f *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNC
+}
+
+// Line returns the source line of the instruction at offset.
+func (f *CompiledFunction) Line(offset int) int {
+	i := sort.Search(len(f.Lines), func(i int) bool { return f.Lines[i].Offset > offset })
+	if i == 0 {
+		return 0
+	}
+	return f.Lines[i-1].Line
+}
+
+// CallSpan returns the source range of the call instruction at offset, or
+// a zero span when it is unknown.
+func (f *CompiledFunction) CallSpan(offset int) ast.Span {
+	i := sort.Search(len(f.Calls), func(i int) bool { return f.Calls[i].Offset >= offset })
+	if i == len(f.Calls) || f.Calls[i].Offset != offset {
+		return ast.Span{}
+	}
+	return f.Calls[i].Span
+}
+
+// Closure is a CompiledFunction together with the frame it was defined in.
+type Closure struct {
+	Fn  *CompiledFunction
+	Env *Environment
+}
+
+func (c *Closure) Inspect() string {
+	return c.Fn.Inspect()
+}
+
+func (c *Closure) Type() ObjectType {
+	return CLOSURE
+}
+
+// Caller calls Knife functions back from a builtin, on the engine running
+// the script.
+type Caller interface {
+	Call(fn Object, args ...Object) (Object, error)
+}
+
+// CallContext is what a builtin is called with: the engine running the
+// script, where the call is and its arguments.
+type CallContext struct {
+	// Caller calls back the functions passed as arguments.
+	Caller
+	// Name is the name of the builtin called.
+	Name string
+	// Span is the source range of the call; it is zero for calls from Go.
+	Span ast.Span
+	// Stdout and Stderr receive what the builtin prints.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Dir is the directory relative paths are resolved against; empty
+	// means the working directory.
+	Dir string
+	// CheckPath fails unless the script may use capability on path; nil
+	// allows every path.
+	CheckPath func(capability, path string) error
+	// CheckAlloc fails unless the script may create a string or an array
+	// of size; nil allows every size.
+	CheckAlloc func(size int) error
+	Args       []Object
+}
+
+// ExpectArgs fails unless the builtin was passed n arguments.
+func (ctx *CallContext) ExpectArgs(n int) error {
+	if len(ctx.Args) != n {
+		return &ArgumentError{Index: -1, Message: fmt.Sprintf("expected %d arguments, got %d", n, len(ctx.Args))}
+	}
+	return nil
+}
+
+// ExpectString returns argument i, counted from 0, when it is a string.
+func (ctx *CallContext) ExpectString(i int) (string, error) {
+	if i >= len(ctx.Args) {
+		return "", &ArgumentError{Index: -1, Message: fmt.Sprintf("expected at least %d arguments, got %d", i+1, len(ctx.Args))}
+	}
+	s, ok := ctx.Args[i].(*String)
+	if !ok {
+		return "", &ArgumentError{Index: i, Message: fmt.Sprintf("expected %s, got %s", STRING, ctx.Args[i].Type())}
+	}
+	return s.Value, nil
+}
+
+// ArgumentError reports arguments a builtin cannot be called with. Index
+// is the argument at fault, counted from 0, or -1 when their number is
+// wrong.
+type ArgumentError struct {
+	Index   int
+	Message string
+	Err     error
+}
+
+func (e *ArgumentError) Error() string {
+	if e.Index < 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("argument %d: %s", e.Index+1, e.Message)
+}
+
+func (e *ArgumentError) Unwrap() error {
+	return e.Err
+}
+
+// BuiltinError is the error of a failed builtin call, at the position of
+// the call.
+type BuiltinError struct {
+	Name string
+	Span ast.Span
+	Err  error
+}
+
+func (e *BuiltinError) Error() string {
+	return fmt.Sprintf("line: %d, error: %s: %v", e.Span.Start.Line, e.Name, e.Err)
+}
+
+func (e *BuiltinError) Unwrap() error {
+	return e.Err
+}
+
 type Builtin struct {
-	Name     string
-	Function func(args ...Object) Object
+	Name string
+	// Capability is the permission required to call the builtin; empty
+	// means it is always available.
+	Capability string
+	Function   func(ctx *CallContext) (Object, error)
 }
 
 func (b *Builtin) Inspect() string {
-	return fmt.Sprintf("%v is a builtin\n", b.Name)
+	return fmt.Sprintf("%v is a builtin", b.Name)
 }
 
 func (b *Builtin) Type() ObjectType {
 	return BUILTIN
 }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+func (a *Array) Type() ObjectType {
+	return ARRAY
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	sort.Strings(pairs)
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (h *Hash) Type() ObjectType {
+	return HASH
+}
+
+type Error struct {
+	Message string
+}
+
+func (e *Error) Inspect() string {
+	return "error: " + e.Message
+}
+
+func (e *Error) Type() ObjectType {
+	return ERROR
+}
+
+// Module holds the exports of an imported file.
+type Module struct {
+	// Path is the file the module was loaded from.
+	Path    string
+	Exports map[string]Object
+}
+
+func (m *Module) Inspect() string {
+	return "module " + m.Path
+}
+
+func (m *Module) Type() ObjectType {
+	return MODULE
+}
+
+// Regex is a compiled regular expression.
+type Regex struct {
+	Regexp *regexp.Regexp
+	// Methods are the builtins bound to the regex, as r.find.
+	Methods map[string]Object
+}
+
+func (r *Regex) Inspect() string {
+	return "/" + r.Regexp.String() + "/"
+}
+
+func (r *Regex) Type() ObjectType {
+	return REGEX
+}
@@ -2,22 +2,231 @@ package eval
 
 import (
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Serein-sz/knife/environment"
 )
 
 var builtins = map[string]*environment.Builtin{
-	"print": {Name: "print", Function: Print},
+	"len": {Name: "len", Function: Len},
 }
 
-func Print(args ...environment.Object) environment.Object {
-	for i, a := range args {
-		fmt.Print(a.Inspect())
-		if i != len(args)-1 {
-			fmt.Print(", ")
-		} else {
-			fmt.Println()
+func init() {
+	mustRegister("assert", "", Assert)
+	mustRegister("getenv", CapEnv, os.Getenv)
+	mustRegister("now", CapTime, func() int64 { return time.Now().UnixMilli() })
+	mustRegister("get", "", Get)
+	mustRegister("push", "", Push)
+	mustRegister("array", "", NewArray)
+}
+
+// modules holds the builtins grouped under a name, as json.parse.
+var modules = map[string]*environment.Module{}
+
+// IsBuiltin reports whether name refers to a builtin or a module of
+// builtins when it is not shadowed by a script definition.
+func IsBuiltin(name string) bool {
+	_, ok := LookupBuiltin(name)
+	return ok
+}
+
+// BuiltinNames returns the names of all builtins and modules of builtins,
+// sorted.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins)+len(modules))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupBuiltin returns the builtin or the module of builtins registered
+// under name.
+func LookupBuiltin(name string) (environment.Object, bool) {
+	if b, ok := builtins[name]; ok {
+		return b, true
+	}
+	m, ok := modules[name]
+	return m, ok
+}
+
+// Builtins holds the host functions registered on one interpreter or VM.
+// Only the scripts it runs see them, before the builtins shared by all.
+type Builtins struct {
+	registered map[string]environment.Object
+}
+
+// RegisterFunc exposes a typed Go function to scripts under name. Arguments
+// are converted with environment.FromObject on every call and a mismatch is
+// reported as a runtime error.
+func (b *Builtins) RegisterFunc(name string, fn any) error {
+	return b.RegisterFuncWithCapability(name, "", fn)
+}
+
+// RegisterFuncWithCapability is like RegisterFunc, but scripts can only
+// call the builtin when the interpreter or VM was granted c.
+func (b *Builtins) RegisterFuncWithCapability(name string, c Capability, fn any) error {
+	builtin, err := environment.NewBuiltin(name, fn)
+	if err != nil {
+		return err
+	}
+	builtin.Capability = string(c)
+	b.register(name, builtin)
+	return nil
+}
+
+// RegisterBuiltin exposes fn to scripts under name. Unlike RegisterFunc,
+// fn checks its arguments itself, with the helpers of the context.
+func (b *Builtins) RegisterBuiltin(name string, c Capability, fn func(ctx *environment.CallContext) (environment.Object, error)) {
+	b.register(name, &environment.Builtin{Name: name, Capability: string(c), Function: fn})
+}
+
+// RegisterModule exposes members to scripts as name.member, the way an
+// imported module exports them. Each builtin is renamed after its member.
+func (b *Builtins) RegisterModule(name string, members map[string]*environment.Builtin) {
+	b.register(name, newModule(name, members))
+}
+
+// Lookup returns the host function or module registered under name, or
+// else the shared builtin or module of builtins.
+func (b *Builtins) Lookup(name string) (environment.Object, bool) {
+	if obj, ok := b.registered[name]; ok {
+		return obj, true
+	}
+	return LookupBuiltin(name)
+}
+
+// Names returns the names registered on b, sorted, to predeclare them to
+// the resolver together with BuiltinNames.
+func (b *Builtins) Names() []string {
+	names := make([]string, 0, len(b.registered))
+	for name := range b.registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (b *Builtins) register(name string, obj environment.Object) {
+	if b.registered == nil {
+		b.registered = map[string]environment.Object{}
+	}
+	b.registered[name] = obj
+}
+
+func newModule(name string, members map[string]*environment.Builtin) *environment.Module {
+	exports := make(map[string]environment.Object, len(members))
+	for member, b := range members {
+		b.Name = name + "." + member
+		exports[member] = b
+	}
+	return &environment.Module{Path: name, Exports: exports}
+}
+
+// registerModule adds a module to the builtins shared by all engines.
+func registerModule(name string, members map[string]*environment.Builtin) {
+	modules[name] = newModule(name, members)
+}
+
+// registerBuiltin adds fn to the builtins shared by all engines.
+func registerBuiltin(name string, c Capability, fn func(ctx *environment.CallContext) (environment.Object, error)) {
+	builtins[name] = &environment.Builtin{Name: name, Capability: string(c), Function: fn}
+}
+
+// mustBuiltin wraps fn as a builtin requiring c, for registerModule.
+func mustBuiltin(c Capability, fn any) *environment.Builtin {
+	builtin, err := environment.NewBuiltin("", fn)
+	if err != nil {
+		panic(err)
+	}
+	builtin.Capability = string(c)
+	return builtin
+}
+
+// mustRegister adds fn to the builtins shared by all engines.
+func mustRegister(name string, c Capability, fn any) {
+	builtin, err := environment.NewBuiltin(name, fn)
+	if err != nil {
+		panic(err)
+	}
+	builtin.Capability = string(c)
+	builtins[name] = builtin
+}
+
+// Assert fails the script when cond is false, optionally with a message.
+func Assert(cond bool, msg ...string) error {
+	if cond {
+		return nil
+	}
+	if len(msg) > 0 {
+		return fmt.Errorf("assertion failed: %s", strings.Join(msg, " "))
+	}
+	return fmt.Errorf("assertion failed")
+}
+
+// Len returns the number of characters of a string, elements of an array
+// or pairs of a hash.
+func Len(ctx *environment.CallContext) (environment.Object, error) {
+	if err := ctx.ExpectArgs(1); err != nil {
+		return nil, err
+	}
+	n := 0
+	switch o := ctx.Args[0].(type) {
+	case *environment.String:
+		n = utf8.RuneCountInString(o.Value)
+	case *environment.Array:
+		n = len(o.Elements)
+	case *environment.Hash:
+		n = len(o.Pairs)
+	default:
+		return nil, &environment.ArgumentError{Index: 0, Message: fmt.Sprintf("%s has no length", o.Type())}
+	}
+	return &environment.Number{Value: strconv.Itoa(n)}, nil
+}
+
+// Get returns the element of an array at an index, or the value of a hash
+// for a key, null when the hash has none.
+func Get(obj environment.Object, key environment.Object) (environment.Object, error) {
+	switch o := obj.(type) {
+	case *environment.Array:
+		var i int
+		if err := environment.FromObject(key, &i); err != nil {
+			return nil, &environment.ArgumentError{Index: 1, Message: err.Error(), Err: err}
 		}
+		if i < 0 || i >= len(o.Elements) {
+			return nil, fmt.Errorf("index %d out of range [0, %d)", i, len(o.Elements))
+		}
+		return o.Elements[i], nil
+	case *environment.Hash:
+		k, err := hashKey(key)
+		if err != nil {
+			return nil, &environment.ArgumentError{Index: 1, Message: err.Error(), Err: err}
+		}
+		if pair, ok := o.Pairs[k]; ok {
+			return pair.Value, nil
+		}
+		return NULL, nil
 	}
-	return NULL
+	return nil, &environment.ArgumentError{Index: 0, Message: fmt.Sprintf("cannot get from %s", obj.Type())}
+}
+
+// Push returns a new array holding the elements of arr followed by v.
+func Push(arr *environment.Array, v environment.Object) *environment.Array {
+	elements := make([]environment.Object, len(arr.Elements), len(arr.Elements)+1)
+	copy(elements, arr.Elements)
+	return &environment.Array{Elements: append(elements, v)}
+}
+
+// NewArray returns an array of its arguments.
+func NewArray(elements ...environment.Object) *environment.Array {
+	return &environment.Array{Elements: append([]environment.Object{}, elements...)}
 }
@@ -0,0 +1,164 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Capability names a group of builtins touching the outside world. A
+// builtin registered under a capability may only be called when the
+// Interpreter's Permissions allow it.
+type Capability string
+
+const (
+	CapFSRead  Capability = "fs-read"
+	CapFSWrite Capability = "fs-write"
+	CapEnv     Capability = "env"
+	CapExec    Capability = "exec"
+	CapNet     Capability = "net"
+	CapTime    Capability = "time"
+)
+
+var Capabilities = []Capability{CapFSRead, CapFSWrite, CapEnv, CapExec, CapNet, CapTime}
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+func ParseCapability(s string) (Capability, error) {
+	for _, c := range Capabilities {
+		if string(c) == s {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown capability: %q", s)
+}
+
+// Permissions records the capabilities granted to a script. A capability
+// granted without scopes is unrestricted; otherwise CheckPath only accepts
+// paths inside one of the scopes. Relative scopes are resolved like the
+// relative paths of the script, against the directory of the call.
+type Permissions struct {
+	granted map[Capability][]string
+}
+
+func (p *Permissions) Allow(c Capability, scopes ...string) {
+	if p.granted == nil {
+		p.granted = map[Capability][]string{}
+	}
+	cur, ok := p.granted[c]
+	if ok && cur == nil {
+		return
+	}
+	if len(scopes) == 0 {
+		p.granted[c] = nil
+		return
+	}
+	for _, s := range scopes {
+		if filepath.IsAbs(s) {
+			if real, err := realPath(s); err == nil {
+				s = real
+			}
+		}
+		cur = append(cur, filepath.Clean(s))
+	}
+	p.granted[c] = cur
+}
+
+func (p *Permissions) AllowAll() {
+	for _, c := range Capabilities {
+		p.Allow(c)
+	}
+}
+
+func (p *Permissions) Allowed(c Capability) bool {
+	_, ok := p.granted[c]
+	return ok
+}
+
+func (p *Permissions) Check(c Capability) error {
+	if !p.Allowed(c) {
+		return fmt.Errorf("%w: %s", ErrPermissionDenied, c)
+	}
+	return nil
+}
+
+// CheckPath fails unless the script may use c on path, with relative
+// scopes taken from the working directory.
+func (p *Permissions) CheckPath(c Capability, path string) error {
+	return p.checkPath(c, "", path)
+}
+
+// checkPath fails unless path lies inside one of the scopes of c, the
+// relative ones taken from dir.
+func (p *Permissions) checkPath(c Capability, dir, path string) error {
+	if err := p.Check(c); err != nil {
+		return err
+	}
+	scopes := p.granted[c]
+	if scopes == nil {
+		return nil
+	}
+	real, err := realPath(path)
+	if err != nil {
+		return fmt.Errorf("%w: %s %s", ErrPermissionDenied, c, path)
+	}
+	for _, s := range scopes {
+		if !filepath.IsAbs(s) {
+			if dir != "" {
+				s = dir + string(filepath.Separator) + s
+			}
+			if s, err = realPath(s); err != nil {
+				continue
+			}
+		}
+		if inside(real, s) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s %s", ErrPermissionDenied, c, path)
+}
+
+// inside reports whether path is dir or lies under it.
+func inside(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
+
+// realPath returns the absolute path path designates once the symbolic
+// links of its longest existing prefix are followed, so that a link in a
+// scope cannot lead out of it. The components that do not exist yet are
+// kept as they are.
+func realPath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		// not joined, which would drop the .. after a link lexically
+		path = wd + string(filepath.Separator) + path
+	}
+	rest := ""
+	for dir := path; ; {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		i := strings.LastIndex(dir, string(filepath.Separator))
+		if i <= 0 {
+			return filepath.Clean(path), nil
+		}
+		rest = filepath.Join(dir[i+1:], rest)
+		dir = dir[:i]
+	}
+}
@@ -0,0 +1,117 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCapabilityDenied(t *testing.T) {
+	t.Setenv("KNIFE_TEST", "ok")
+	err := evalWith(context.Background(), New(), `let v = getenv("KNIFE_TEST")`)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected ErrPermissionDenied, got=%v", err)
+	}
+	if !strings.Contains(err.Error(), "permission denied: env") {
+		t.Fatalf("unexpected message: %v", err)
+	}
+
+	in := New()
+	in.Permissions.Allow(CapEnv)
+	if err := evalWith(context.Background(), in, `let v = getenv("KNIFE_TEST")`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRegisterFuncWithCapability(t *testing.T) {
+	written := ""
+	in := New()
+	err := in.Builtins.RegisterFuncWithCapability("save", CapFSWrite, func(s string) { written = s })
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = evalWith(context.Background(), in, `save("data")`)
+	if err == nil || !strings.Contains(err.Error(), "permission denied: fs-write") {
+		t.Fatalf("expected permission denied, got=%v", err)
+	}
+
+	in.Permissions.AllowAll()
+	if err := evalWith(context.Background(), in, `save("data")`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != "data" {
+		t.Fatalf("expected=data, got=%q", written)
+	}
+	if IsBuiltin("save") {
+		t.Fatalf("expected save not to be a shared builtin")
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	dir := t.TempDir()
+	var p Permissions
+	p.Allow(CapFSRead, dir)
+
+	if err := p.CheckPath(CapFSRead, filepath.Join(dir, "a.txt")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.CheckPath(CapFSRead, filepath.Join(dir, "..", "b.txt")); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected ErrPermissionDenied, got=%v", err)
+	}
+	if err := p.CheckPath(CapFSWrite, filepath.Join(dir, "a.txt")); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected ErrPermissionDenied, got=%v", err)
+	}
+
+	var prefix Permissions
+	prefix.Allow(CapFSRead, filepath.Join(dir, "a"))
+	if err := prefix.CheckPath(CapFSRead, filepath.Join(dir, "a", "x")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := prefix.CheckPath(CapFSRead, filepath.Join(dir, "ab")); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected ErrPermissionDenied for a sibling sharing the prefix, got=%v", err)
+	}
+
+	p.Allow(CapFSRead)
+	if err := p.CheckPath(CapFSRead, "/anywhere"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckPathSymlink(t *testing.T) {
+	root := t.TempDir()
+	allowed, outside := filepath.Join(root, "allowed"), filepath.Join(root, "outside")
+	for _, d := range []string{filepath.Join(allowed, "sub"), filepath.Join(outside, "deep")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "deep"), filepath.Join(allowed, "link")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	if err := os.Symlink(filepath.Join(allowed, "sub"), filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	var p Permissions
+	p.Allow(CapFSWrite, allowed)
+
+	for _, path := range []string{
+		filepath.Join(allowed, "link", "secret.txt"),
+		filepath.Join(allowed, "link", "new", "file.txt"),
+		allowed + "/link/../secret.txt",
+	} {
+		if err := p.CheckPath(CapFSWrite, path); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("%s: expected ErrPermissionDenied through a link, got=%v", path, err)
+		}
+	}
+	for _, path := range []string{
+		filepath.Join(allowed, "sub", "new.txt"),
+		filepath.Join(root, "alias", "new.txt"),
+	} {
+		if err := p.CheckPath(CapFSWrite, path); err != nil {
+			t.Errorf("%s: unexpected error: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/Serein-sz/knife/environment"
+)
+
+func init() {
+	mustRegister("map", "", Map)
+	mustRegister("filter", "", Filter)
+	mustRegister("reduce", "", Reduce)
+	mustRegister("each", "", Each)
+	mustRegister("find", "", Find)
+	mustRegister("any", "", Any)
+	mustRegister("all", "", All)
+	mustRegister("sort", "", Sort)
+	mustRegister("reverse", "", Reverse)
+	mustRegister("unique", "", Unique)
+	mustRegister("zip", "", Zip)
+	mustRegister("flatten", "", Flatten)
+	mustRegister("group_by", "", GroupBy)
+	mustRegister("range", "", Range)
+}
+
+// Map returns the results of calling f on each element of arr.
+func Map(ctx *environment.CallContext, arr *environment.Array, f environment.Object) (*environment.Array, error) {
+	out := make([]environment.Object, 0, len(arr.Elements))
+	for _, e := range arr.Elements {
+		v, err := ctx.Call(f, e)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return &environment.Array{Elements: out}, nil
+}
+
+// Filter returns the elements of arr for which f returns a truthy value.
+func Filter(ctx *environment.CallContext, arr *environment.Array, f environment.Object) (*environment.Array, error) {
+	out := []environment.Object{}
+	for _, e := range arr.Elements {
+		ok, err := test(ctx, f, e)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, e)
+		}
+	}
+	return &environment.Array{Elements: out}, nil
+}
+
+// Reduce folds arr with f, called with the accumulated value and each
+// element. Without initial the first element is the initial value.
+func Reduce(ctx *environment.CallContext, arr *environment.Array, f environment.Object, initial ...environment.Object) (environment.Object, error) {
+	elements := arr.Elements
+	var acc environment.Object
+	switch {
+	case len(initial) > 1:
+		return nil, fmt.Errorf("expected at most 3 arguments, got %d", 2+len(initial))
+	case len(initial) == 1:
+		acc = initial[0]
+	case len(elements) == 0:
+		return nil, errors.New("empty array without an initial value")
+	default:
+		acc, elements = elements[0], elements[1:]
+	}
+	for _, e := range elements {
+		v, err := ctx.Call(f, acc, e)
+		if err != nil {
+			return nil, err
+		}
+		acc = v
+	}
+	return acc, nil
+}
+
+// Each calls f on each element of arr.
+func Each(ctx *environment.CallContext, arr *environment.Array, f environment.Object) error {
+	for _, e := range arr.Elements {
+		if _, err := ctx.Call(f, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find returns the first element of arr for which f returns a truthy
+// value, or null.
+func Find(ctx *environment.CallContext, arr *environment.Array, f environment.Object) (environment.Object, error) {
+	for _, e := range arr.Elements {
+		ok, err := test(ctx, f, e)
+		if err != nil || ok {
+			return e, err
+		}
+	}
+	return NULL, nil
+}
+
+// Any reports whether f returns a truthy value for some element of arr.
+func Any(ctx *environment.CallContext, arr *environment.Array, f environment.Object) (bool, error) {
+	for _, e := range arr.Elements {
+		ok, err := test(ctx, f, e)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// All reports whether f returns a truthy value for every element of arr.
+func All(ctx *environment.CallContext, arr *environment.Array, f environment.Object) (bool, error) {
+	for _, e := range arr.Elements {
+		ok, err := test(ctx, f, e)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func test(ctx *environment.CallContext, f, e environment.Object) (bool, error) {
+	v, err := ctx.Call(f, e)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// Sort returns the elements of arr in ascending order, keeping equal
+// elements in their order. less, when given, is called with two elements
+// and returns whether the first goes before the second; otherwise they are
+// compared as numbers or as strings.
+func Sort(ctx *environment.CallContext, arr *environment.Array, less ...environment.Object) (*environment.Array, error) {
+	if len(less) > 1 {
+		return nil, fmt.Errorf("expected at most 2 arguments, got %d", 1+len(less))
+	}
+	out := append([]environment.Object{}, arr.Elements...)
+	var err error
+	sort.SliceStable(out, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		if len(less) == 0 {
+			var ok bool
+			ok, err = ascending(out[i], out[j])
+			return ok
+		}
+		var v environment.Object
+		v, err = ctx.Call(less[0], out[i], out[j])
+		return err == nil && truthy(v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &environment.Array{Elements: out}, nil
+}
+
+// ascending reports whether a goes before b when both are numbers or both
+// are strings.
+func ascending(a, b environment.Object) (bool, error) {
+	if x, ok := a.(*environment.String); ok {
+		if y, ok := b.(*environment.String); ok {
+			return x.Value < y.Value, nil
+		}
+	}
+	if a.Type() != environment.NUMBER || b.Type() != environment.NUMBER {
+		return false, fmt.Errorf("cannot compare %s with %s", a.Type(), b.Type())
+	}
+	v, err := evalInfixExpression("<", a, b)
+	return err == nil && truthy(v), err
+}
+
+// Reverse returns the elements of arr in reverse order.
+func Reverse(arr *environment.Array) *environment.Array {
+	out := make([]environment.Object, len(arr.Elements))
+	for i, e := range arr.Elements {
+		out[len(out)-1-i] = e
+	}
+	return &environment.Array{Elements: out}
+}
+
+// Unique returns the elements of arr without the repeated ones, in the
+// order they first appear.
+func Unique(arr *environment.Array) (*environment.Array, error) {
+	seen := map[environment.HashKey]bool{}
+	out := []environment.Object{}
+	for _, e := range arr.Elements {
+		key, err := hashKey(e)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, e)
+		}
+	}
+	return &environment.Array{Elements: out}, nil
+}
+
+// Zip returns arrays pairing the elements of arrs at the same index, as
+// many as the shortest of them has.
+func Zip(arrs ...*environment.Array) *environment.Array {
+	n := 0
+	for i, a := range arrs {
+		if i == 0 || len(a.Elements) < n {
+			n = len(a.Elements)
+		}
+	}
+	out := make([]environment.Object, n)
+	for i := range out {
+		tuple := make([]environment.Object, len(arrs))
+		for j, a := range arrs {
+			tuple[j] = a.Elements[i]
+		}
+		out[i] = &environment.Array{Elements: tuple}
+	}
+	return &environment.Array{Elements: out}
+}
+
+// Flatten returns the elements of arr, with those that are arrays replaced
+// by their own elements.
+func Flatten(arr *environment.Array) *environment.Array {
+	out := []environment.Object{}
+	for _, e := range arr.Elements {
+		if inner, ok := e.(*environment.Array); ok {
+			out = append(out, inner.Elements...)
+		} else {
+			out = append(out, e)
+		}
+	}
+	return &environment.Array{Elements: out}
+}
+
+// GroupBy returns a hash from each value f returns for the elements of arr
+// to the array of those elements.
+func GroupBy(ctx *environment.CallContext, arr *environment.Array, f environment.Object) (*environment.Hash, error) {
+	groups := &environment.Hash{Pairs: map[environment.HashKey]environment.HashPair{}}
+	for _, e := range arr.Elements {
+		k, err := ctx.Call(f, e)
+		if err != nil {
+			return nil, err
+		}
+		key, err := hashKey(k)
+		if err != nil {
+			return nil, err
+		}
+		pair, ok := groups.Pairs[key]
+		if !ok {
+			pair = environment.HashPair{Key: k, Value: &environment.Array{}}
+		}
+		group := pair.Value.(*environment.Array)
+		group.Elements = append(group.Elements, e)
+		groups.Pairs[key] = pair
+	}
+	return groups, nil
+}
+
+func hashKey(obj environment.Object) (environment.HashKey, error) {
+	h, ok := obj.(environment.Hashable)
+	if !ok {
+		return environment.HashKey{}, fmt.Errorf("%s cannot be used as a key", obj.Type())
+	}
+	return h.HashKey(), nil
+}
+
+// Range returns the integers from start up to end, excluded, counting by
+// step. With a single argument it counts from 0 to that argument.
+func Range(ctx *environment.CallContext, bounds ...int) (*environment.Array, error) {
+	start, end, step := 0, 0, 1
+	switch len(bounds) {
+	case 1:
+		end = bounds[0]
+	case 2:
+		start, end = bounds[0], bounds[1]
+	case 3:
+		start, end, step = bounds[0], bounds[1], bounds[2]
+	default:
+		return nil, fmt.Errorf("expected 1 to 3 arguments, got %d", len(bounds))
+	}
+	if step == 0 {
+		return nil, errors.New("step must not be 0")
+	}
+	n, err := rangeLength(start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.CheckAlloc != nil {
+		if err := ctx.CheckAlloc(n); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]environment.Object, n)
+	for k, i := 0, start; k < n; k, i = k+1, i+step {
+		out[k] = &environment.Number{Value: strconv.Itoa(i)}
+	}
+	return &environment.Array{Elements: out}, nil
+}
+
+// maxRange bounds the length of the arrays range creates.
+const maxRange = math.MaxInt32
+
+// rangeLength returns the number of elements from start to end, excluded,
+// by step, computed without overflowing int.
+func rangeLength(start, end, step int) (int, error) {
+	var diff, stride uint64
+	switch {
+	case step > 0 && start < end:
+		diff, stride = uint64(end)-uint64(start), uint64(step)
+	case step < 0 && start > end:
+		diff, stride = uint64(start)-uint64(end), uint64(-(step+1))+1
+	default:
+		return 0, nil
+	}
+	n := (diff-1)/stride + 1
+	if n > maxRange {
+		return 0, fmt.Errorf("range of %d elements is too large", n)
+	}
+	return int(n), nil
+}
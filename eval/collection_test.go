@@ -0,0 +1,154 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+)
+
+const callbacks = `
+func double(x) { return x * 2 }
+func odd(x) { return x / 2 * 2 != x }
+func add(a, b) { return a + b }
+func greater(a, b) { return a > b }
+func big(x) { return x > 5 }
+`
+
+func evalValue(in *Interpreter, src string) (environment.Object, error) {
+	program := parser.New(lexer.New(callbacks + src + "\n")).ParseProgram()
+	return in.Eval(context.Background(), program, environment.NewEnvironment(nil))
+}
+
+func TestCollections(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"map(range(4), double)", "[0, 2, 4, 6]"},
+		{`map(array("ab", "c"), len)`, "[2, 1]"},
+		{"filter(range(10), odd)", "[1, 3, 5, 7, 9]"},
+		{"reduce(range(1, 5), add)", "10"},
+		{"reduce(array(), add, 0)", "0"},
+		{`reduce(array("a", "b"), add, ">")`, ">ab"},
+		{"each(range(3), double)", "null"},
+		{"find(range(10), big)", "6"},
+		{"find(range(3), big)", "null"},
+		{"any(range(10), big)", "true"},
+		{"any(array(), big)", "false"},
+		{"all(range(10), big)", "false"},
+		{"all(range(6, 9), big)", "true"},
+		{"sort(array(3, 1.5, 2, -1))", "[-1, 1.5, 2, 3]"},
+		{`sort(array("b", "c", "a"))`, "[a, b, c]"},
+		{"sort(range(5), greater)", "[4, 3, 2, 1, 0]"},
+		{"reverse(range(3))", "[2, 1, 0]"},
+		{`unique(array(1, 2, 1, "1", 2))`, "[1, 2, 1]"},
+		{`zip(range(3), array("a", "b"))`, "[[0, a], [1, b]]"},
+		{"zip()", "[]"},
+		{"flatten(array(array(1, 2), 3, array(array(4))))", "[1, 2, 3, [4]]"},
+		{"group_by(range(6), odd)", "{false: [0, 2, 4], true: [1, 3, 5]}"},
+		{"range(5)", "[0, 1, 2, 3, 4]"},
+		{"range(10, 0, -3)", "[10, 7, 4, 1]"},
+		{"range(3, 1)", "[]"},
+	}
+	for _, tt := range tests {
+		res, err := evalValue(New(), tt.src)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+			continue
+		}
+		if res.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%s, got=%s", tt.src, tt.expected, res.Inspect())
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"get(array(1, 2), 1)", "2"},
+		{"get(group_by(range(6), odd), true)", "[1, 3, 5]"},
+		{"get(group_by(range(2), odd), false)", "[0]"},
+		{"get(group_by(range(2), odd), 1)", "null"},
+		{`get(group_by(range(2), odd), "true")`, "null"},
+		{`get(json.parse('{"a": {"b": 1}}'), "a")`, "{b: 1}"},
+		{`get(json.parse("{}"), "b")`, "null"},
+	}
+	for _, tt := range tests {
+		res, err := evalValue(New(), tt.src)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.src, err)
+			continue
+		}
+		if res.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%s, got=%s", tt.src, tt.expected, res.Inspect())
+		}
+	}
+
+	errs := []struct {
+		src      string
+		expected string
+	}{
+		{"get(array(1), 1)", "get: index 1 out of range [0, 1)"},
+		{"get(group_by(range(2), odd), array())", "get: argument 2: ARRAY cannot be used as a key"},
+		{"get(1, 0)", "get: argument 1: cannot get from NUMBER"},
+	}
+	for _, tt := range errs {
+		_, err := evalValue(New(), tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error %q, got=%v", tt.src, tt.expected, err)
+		}
+	}
+}
+
+func TestCollectionErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"reduce(array(), add)", "reduce: empty array without an initial value"},
+		{`sort(array(1, "a"))`, "sort: cannot compare STRING with NUMBER"},
+		{"range(0, 1, 0)", "range: step must not be 0"},
+		{"range()", "range: expected 1 to 3 arguments, got 0"},
+		{"map(range(2), add)", "map: line: 7, error: expected 2 arguments, got 1"},
+		{"group_by(range(2), range)", "group_by: ARRAY cannot be used as a key"},
+		{"map(1, double)", "map: argument 1"},
+	}
+	for _, tt := range tests {
+		_, err := evalValue(New(), tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error %q, got=%v", tt.src, tt.expected, err)
+		}
+	}
+}
+
+func TestBuiltinErrorSpan(t *testing.T) {
+	_, err := evalValue(New(), "let n = 1\n  len(n)")
+	var builtinErr *environment.BuiltinError
+	var argErr *environment.ArgumentError
+	if !errors.As(err, &builtinErr) || !errors.As(err, &argErr) {
+		t.Fatalf("expected a typed builtin error, got=%v", err)
+	}
+	start, end := builtinErr.Span.Start, builtinErr.Span.End
+	if builtinErr.Name != "len" || start.Line != 8 || start.Column != 3 || end.Line != 8 || end.Column != 9 || argErr.Index != 0 {
+		t.Fatalf("unexpected error %#v at %v", err, builtinErr.Span)
+	}
+	if err.Error() != "line: 8, error: len: argument 1: NUMBER has no length" {
+		t.Fatalf("unexpected message: %v", err)
+	}
+}
+
+func TestCallbackLimits(t *testing.T) {
+	in := New()
+	in.Limits.MaxSteps = 1000
+	_, err := evalValue(in, "map(range(10000), double)")
+	if !errors.Is(err, ErrStepLimit) {
+		t.Fatalf("expected ErrStepLimit, got=%v", err)
+	}
+}
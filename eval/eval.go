@@ -1,7 +1,9 @@
 package eval
 
 import (
+	"context"
 	"fmt"
+	"os"
 
 	"github.com/Serein-sz/knife/ast"
 	"github.com/Serein-sz/knife/environment"
@@ -13,59 +15,91 @@ var (
 	FALSE = &environment.Boolean{Value: false}
 )
 
-func Eval(node ast.Node, env *environment.Environment) (environment.Object, error) {
+// Eval evaluates node with a new Interpreter using the default limits.
+func Eval(ctx context.Context, node ast.Node, env *environment.Environment) (environment.Object, error) {
+	return New().Eval(ctx, node, env)
+}
+
+func (in *Interpreter) eval(node ast.Node, env *environment.Environment) (environment.Object, error) {
+	if err := in.step(); err != nil {
+		return nil, err
+	}
 	switch node := (node).(type) {
 	case *ast.Program:
-		return evalProgram(node.Statements, env)
+		return in.evalProgram(node.Statements, env)
 	case *ast.BlockStatement:
-		return evalBlockStatements(node.Statements, env)
+		return in.evalBlockStatements(node.Statements, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return in.eval(node.Expression, env)
 	case *ast.LetStatement:
-		return evalLetStatement(node, env)
+		return in.evalLetStatement(node, env)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return in.evalIdentifier(node, env)
 	case *ast.Null:
 		return NULL, nil
+	case *ast.Boolean:
+		return nativeBoolean(node.Value), nil
+	case *ast.IfExpression:
+		return in.evalIfExpression(node, env)
+	case *ast.PrefixExpression:
+		rhs, err := in.eval(node.Rhs, env)
+		if err != nil {
+			return nil, err
+		}
+		return evalPrefixExpression(node.Op, rhs)
 	case *ast.NumberLiteral:
 		return &environment.Number{Value: node.Value}, nil
 	case *ast.StringLiteral:
-		return &environment.String{Value: node.Value}, nil
+		return in.alloc(&environment.String{Value: node.Value})
 	case *ast.FunctionDefineStatement:
 		return evalFunctionDefineStatement(node, env)
+	case *ast.ImportStatement:
+		return in.evalImportStatement(node, env)
+	case *ast.MemberExpression:
+		obj, err := in.eval(node.Object, env)
+		if err != nil {
+			return nil, err
+		}
+		return Member(obj, node.Property.Value, node.Line())
 	case *ast.ReturnStatement:
-		value, err := Eval(node.Value, env)
+		if call, ok := node.Value.(*ast.FunctionCallExpression); ok && in.depth > 0 {
+			return in.evalTailCall(call, env)
+		}
+		value, err := in.eval(node.Value, env)
 		return &environment.ReturnValue{Value: value}, err
 	case *ast.FunctionCallExpression:
-		function, err := Eval(node.Function, env)
+		function, err := in.eval(node.Function, env)
 		if err != nil {
 			return nil, err
 		}
-		args, err := evalExpressions(node.Arguments, env)
+		args, err := in.evalExpressions(node.Arguments, env)
 		if err != nil {
 			return nil, err
 		}
-		return evalFunctionCallExpression(function, args)
+		return in.evalFunctionCallExpression(node, function, args)
 	case *ast.InfixExpression:
-		lhs, err := Eval(node.Lhs, env)
+		lhs, err := in.eval(node.Lhs, env)
 		if err != nil {
 			return nil, err
 		}
-		rhs, err := Eval(node.Rhs, env)
+		rhs, err := in.eval(node.Rhs, env)
 		if err != nil {
 			return nil, err
 		}
 		res, err := evalInfixExpression(node.Op, lhs, rhs)
-		return res, err
+		if err != nil {
+			return nil, err
+		}
+		return in.alloc(res)
 	}
 	return nil, fmt.Errorf("line: %d, error: unsupported object type: %T\n", node.Line(), node)
 }
 
-func evalBlockStatements(statements []ast.Statement, env *environment.Environment) (environment.Object, error) {
+func (in *Interpreter) evalBlockStatements(statements []ast.Statement, env *environment.Environment) (environment.Object, error) {
 	var res environment.Object
 	var err error
 	for _, s := range statements {
-		res, err = Eval(s, env)
+		res, err = in.eval(s, env)
 		if err != nil {
 			return nil, err
 		}
@@ -78,22 +112,35 @@ func evalBlockStatements(statements []ast.Statement, env *environment.Environmen
 
 func evalInfixExpression(op string, lhs environment.Object, rhs environment.Object) (environment.Object, error) {
 	lType, rType := lhs.Type(), rhs.Type()
-	if lType == environment.NUMBER && rType == environment.NUMBER {
+	switch {
+	case lType == environment.NUMBER && rType == environment.NUMBER:
 		l, r := lhs.(*environment.Number), rhs.(*environment.Number)
 		return evalInfixNumber(op, l, r)
-	}
-	if lType == environment.NULL || rType == environment.NULL {
-		if lhs.Type() == environment.NULL && rhs.Type() != environment.NULL {
-			return FALSE, nil
-		}
-		if lhs.Type() != environment.NULL && rhs.Type() == environment.NULL {
-			return FALSE, nil
-		}
-		return TRUE, nil
+	case lType == environment.STRING && rType == environment.STRING:
+		l, r := lhs.(*environment.String), rhs.(*environment.String)
+		return evalInfixString(op, l, r)
+	case op == "==":
+		return nativeBoolean(equal(lhs, rhs)), nil
+	case op == "!=":
+		return nativeBoolean(!equal(lhs, rhs)), nil
 	}
 	return nil, fmt.Errorf("illegal operands for %q, lhs: %q, rhs: %q\n", op, lhs.Inspect(), rhs.Inspect())
 }
 
+// equal compares values of different types, null and booleans.
+func equal(lhs, rhs environment.Object) bool {
+	if lhs.Type() != rhs.Type() {
+		return false
+	}
+	switch l := lhs.(type) {
+	case *environment.Null:
+		return true
+	case *environment.Boolean:
+		return l.Value == rhs.(*environment.Boolean).Value
+	}
+	return lhs == rhs
+}
+
 func evalInfixNumber(op string, l *environment.Number, r *environment.Number) (environment.Object, error) {
 	switch op {
 	case "+":
@@ -109,18 +156,82 @@ func evalInfixNumber(op string, l *environment.Number, r *environment.Number) (e
 		number, err := DivideNumberStrings(l.Value, r.Value)
 		return &environment.Number{Value: number}, err
 	case "==":
-		return &environment.Boolean{Value: l.Value == r.Value}, nil
+		return nativeBoolean(l.Value == r.Value), nil
+	case "!=":
+		return nativeBoolean(l.Value != r.Value), nil
+	case "<", "<=", ">", ">=":
+		c, err := CompareNumbers(l.Value, r.Value)
+		if err != nil {
+			return nil, err
+		}
+		return nativeBoolean(op == "<" && c < 0 || op == "<=" && c <= 0 || op == ">" && c > 0 || op == ">=" && c >= 0), nil
+	}
+	return nil, fmt.Errorf("unsupported infix operator for numbers: %q %s %q\n", l.Inspect(), op, r.Inspect())
+}
+
+func evalInfixString(op string, l *environment.String, r *environment.String) (environment.Object, error) {
+	switch op {
+	case "+":
+		return &environment.String{Value: l.Value + r.Value}, nil
+	case "==":
+		return nativeBoolean(l.Value == r.Value), nil
 	case "!=":
-		return &environment.Boolean{Value: l.Value != r.Value}, nil
+		return nativeBoolean(l.Value != r.Value), nil
 	}
 	return nil, fmt.Errorf("unsupported infix operator for strings: %q %s %q\n", l.Inspect(), op, r.Inspect())
 }
 
-func evalProgram(statements []ast.Statement, env *environment.Environment) (environment.Object, error) {
+func evalPrefixExpression(op string, rhs environment.Object) (environment.Object, error) {
+	switch op {
+	case "!":
+		return nativeBoolean(!truthy(rhs)), nil
+	case "-":
+		if n, ok := rhs.(*environment.Number); ok {
+			number, err := SubtractNumberStrings("0", n.Value)
+			return &environment.Number{Value: number}, err
+		}
+	}
+	return nil, fmt.Errorf("illegal operand for prefix %q: %q\n", op, rhs.Inspect())
+}
+
+func (in *Interpreter) evalIfExpression(node *ast.IfExpression, env *environment.Environment) (environment.Object, error) {
+	condition, err := in.eval(node.Condition, env)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(condition) {
+		return in.eval(node.Consequence, env)
+	}
+	if node.Alternative != nil {
+		return in.eval(node.Alternative, env)
+	}
+	return NULL, nil
+}
+
+// truthy reports whether obj counts as true in a condition: everything but
+// false and null does.
+func truthy(obj environment.Object) bool {
+	switch obj := obj.(type) {
+	case *environment.Boolean:
+		return obj.Value
+	case *environment.Null, nil:
+		return false
+	}
+	return true
+}
+
+func nativeBoolean(b bool) *environment.Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
+func (in *Interpreter) evalProgram(statements []ast.Statement, env *environment.Environment) (environment.Object, error) {
 	var result environment.Object
 	var err error
 	for _, statement := range statements {
-		result, err = Eval(statement, env)
+		result, err = in.eval(statement, env)
 		if err != nil {
 			return nil, err
 		}
@@ -131,25 +242,44 @@ func evalProgram(statements []ast.Statement, env *environment.Environment) (envi
 	return result, nil
 }
 
-func evalIdentifier(node *ast.Identifier, env *environment.Environment) (environment.Object, error) {
-	if obj, err := env.Get(node.Value); err == nil {
-		return obj, nil
+func (in *Interpreter) evalIdentifier(node *ast.Identifier, env *environment.Environment) (environment.Object, error) {
+	switch node.Binding.Kind {
+	case ast.Local:
+		if obj := env.Outer(node.Binding.Depth).Slot(node.Binding.Slot); obj != nil {
+			return obj, nil
+		}
+	case ast.Global:
+		if obj, ok := env.Outer(node.Binding.Depth).Find(node.Value); ok {
+			return obj, nil
+		}
+	default:
+		if obj, ok := env.Find(node.Value); ok {
+			return obj, nil
+		}
 	}
 
-	bti, ok := builtins[node.Value]
-	if ok {
-		return bti, nil
+	if obj, ok := in.Builtins.Lookup(node.Value); ok {
+		return obj, nil
 	}
 
 	return nil, fmt.Errorf("line: %d, error: undefined identifier: %s\n", node.Line(), node.Value)
 }
 
-func evalLetStatement(node *ast.LetStatement, env *environment.Environment) (environment.Object, error) {
-	obj, err := Eval(node.Value, env)
+// define binds name in env, in the slot the resolver assigned to it if any.
+func define(name *ast.Identifier, obj environment.Object, env *environment.Environment) {
+	if name.Binding.Kind == ast.Local {
+		env.SetSlot(name.Binding.Slot, obj)
+		return
+	}
+	env.Set(name.Value, obj)
+}
+
+func (in *Interpreter) evalLetStatement(node *ast.LetStatement, env *environment.Environment) (environment.Object, error) {
+	obj, err := in.eval(node.Value, env)
 	if err != nil {
 		return nil, err
 	}
-	env.Set(node.Name.Value, obj)
+	define(node.Name, obj, env)
 	return nil, nil
 }
 
@@ -160,40 +290,169 @@ func evalFunctionDefineStatement(node *ast.FunctionDefineStatement, env *environ
 		Parameters: params,
 		Body:       body,
 		Env:        env,
+		Locals:     node.Locals,
 	}
-	return env.Set(node.Name.Value, functionDefine)
+	define(node.Name, functionDefine, env)
+	return functionDefine, nil
 }
 
-func evalExpressions(args []ast.Expression, env *environment.Environment) ([]environment.Object, error) {
+func (in *Interpreter) evalExpressions(args []ast.Expression, env *environment.Environment) ([]environment.Object, error) {
 	var res = make([]environment.Object, 0, len(args))
 	for _, a := range args {
-		v, err := Eval(a, env)
+		v, err := in.eval(a, env)
 		if err != nil {
-			return nil, fmt.Errorf("line: %d, error: passing exp error: [%v]%v", a.Line(), a, err)
+			return nil, fmt.Errorf("line: %d, error: passing exp error: [%v]%w", a.Line(), a, err)
 		}
 		res = append(res, v)
 	}
 	return res, nil
 }
 
-func evalFunctionCallExpression(function environment.Object, args []environment.Object) (environment.Object, error) {
+func (in *Interpreter) evalFunctionCallExpression(node ast.Node, function environment.Object, args []environment.Object) (environment.Object, error) {
 	switch f := function.(type) {
 	case *environment.FunctionDefine:
-		newEnv := environment.NewEnvironment(f.Env)
-		for i, p := range f.Parameters {
-			newEnv.Set(p.Value, args[i])
+		if err := in.enter(node); err != nil {
+			return nil, err
 		}
+		defer in.leave()
 
-		val, err := Eval(f.Body, newEnv)
+		// Calls in tail position come back as a tailCall and run in this
+		// loop, so they use neither Go stack nor call depth.
+		for {
+			if len(args) != len(f.Parameters) {
+				return nil, fmt.Errorf("line: %d, error: expected %d arguments, got %d\n", node.Line(), len(f.Parameters), len(args))
+			}
+			newEnv := environment.NewFrame(f.Env, f.Locals)
+			for i, p := range f.Parameters {
+				define(p, args[i], newEnv)
+			}
+
+			val, err := in.eval(f.Body, newEnv)
+			if err != nil {
+				return nil, err
+			}
+			if v, ok := val.(*environment.ReturnValue); ok {
+				val = v.Value
+			}
+			if tc, ok := val.(*tailCall); ok {
+				node, f, args = tc.node, tc.fn, tc.args
+				continue
+			}
+			if val == nil {
+				// the body ended with a definition
+				return NULL, nil
+			}
+			return val, nil
+		}
+	case *environment.Builtin:
+		res, err := CallBuiltin(f, &environment.CallContext{
+			Caller:     caller{in, node},
+			Span:       CallSpan(node),
+			Stdout:     in.Stdout,
+			Stderr:     in.Stderr,
+			Dir:        in.Dir,
+			CheckAlloc: in.Limits.CheckSize,
+			Args:       args,
+		}, &in.Permissions)
 		if err != nil {
 			return nil, err
 		}
-		if v, ok := val.(*environment.ReturnValue); ok {
-			return v.Value, nil
-		}
-		return val, nil
-	case *environment.Builtin:
-		return f.Function(args...), nil
+		return in.alloc(res)
 	}
 	return NULL, fmt.Errorf("%v is not callable", function.Inspect())
 }
+
+// tailCall is returned by `return f(...)` inside a function, for the call
+// of the enclosing function to run f in its place.
+type tailCall struct {
+	node ast.Node
+	fn   *environment.FunctionDefine
+	args []environment.Object
+}
+
+func (tc *tailCall) Inspect() string {
+	return "tail call"
+}
+
+func (tc *tailCall) Type() environment.ObjectType {
+	return environment.RETURN_VALUE
+}
+
+func (in *Interpreter) evalTailCall(call *ast.FunctionCallExpression, env *environment.Environment) (environment.Object, error) {
+	function, err := in.eval(call.Function, env)
+	if err != nil {
+		return nil, err
+	}
+	args, err := in.evalExpressions(call.Arguments, env)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := function.(*environment.FunctionDefine); ok {
+		return &environment.ReturnValue{Value: &tailCall{node: call, fn: f, args: args}}, nil
+	}
+	value, err := in.evalFunctionCallExpression(call, function, args)
+	return &environment.ReturnValue{Value: value}, err
+}
+
+// Infix applies the binary operator op, as the evaluator does.
+func Infix(op string, lhs, rhs environment.Object) (environment.Object, error) {
+	return evalInfixExpression(op, lhs, rhs)
+}
+
+// Prefix applies the unary operator op, as the evaluator does.
+func Prefix(op string, rhs environment.Object) (environment.Object, error) {
+	return evalPrefixExpression(op, rhs)
+}
+
+// Truthy reports whether obj counts as true in a condition.
+func Truthy(obj environment.Object) bool {
+	return truthy(obj)
+}
+
+// CallBuiltin calls b with ctx once perms allow it. Its errors are
+// *environment.BuiltinError, at ctx.Span. Nil writers in ctx are replaced
+// by os.Stdout and os.Stderr, and paths are checked against perms.
+func CallBuiltin(b *environment.Builtin, ctx *environment.CallContext, perms *Permissions) (environment.Object, error) {
+	ctx.Name = b.Name
+	ctx.CheckPath = func(c, path string) error {
+		return perms.checkPath(Capability(c), ctx.Dir, path)
+	}
+	if ctx.Stdout == nil {
+		ctx.Stdout = os.Stdout
+	}
+	if ctx.Stderr == nil {
+		ctx.Stderr = os.Stderr
+	}
+	if b.Capability != "" {
+		if err := perms.Check(Capability(b.Capability)); err != nil {
+			return nil, &environment.BuiltinError{Name: b.Name, Span: ctx.Span, Err: err}
+		}
+	}
+	res, err := b.Function(ctx)
+	if err != nil {
+		return nil, &environment.BuiltinError{Name: b.Name, Span: ctx.Span, Err: err}
+	}
+	return res, nil
+}
+
+// CallSpan returns the source range of node, a call, falling back to its
+// line when the call has no positions.
+func CallSpan(node ast.Node) ast.Span {
+	if call, ok := node.(*ast.FunctionCallExpression); ok {
+		if span := call.Span(); span.Start.Line != 0 {
+			return span
+		}
+	}
+	return ast.Span{Start: ast.Position{Line: node.Line()}}
+}
+
+// caller calls back into the interpreter from a builtin, as if node, the
+// call of the builtin, called the function.
+type caller struct {
+	in   *Interpreter
+	node ast.Node
+}
+
+func (c caller) Call(fn environment.Object, args ...environment.Object) (environment.Object, error) {
+	return c.in.evalFunctionCallExpression(c.node, fn, args)
+}
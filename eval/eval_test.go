@@ -1,6 +1,7 @@
 package eval
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
@@ -24,7 +25,7 @@ func TestEval(t *testing.T) {
 		io.WriteString(os.Stderr, err.Error())
 	}
 	env := environment.NewEnvironment(nil)
-	_, err = Eval(program, env)
+	_, err = Eval(context.Background(), program, env)
 	if err != nil {
 		t.Fatalf("eval err: %v", err)
 	}
@@ -45,3 +46,46 @@ func ReadFile(filename string) (string, error) {
 	// 确保使用UTF-8编码和LF换行符
 	return string(content), nil
 }
+
+func TestRegisterFunc(t *testing.T) {
+	in := New()
+	err := in.Builtins.RegisterFunc("repeat", func(s string, n int) string {
+		return strings.Repeat(s, n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := environment.NewEnvironment(nil)
+
+	program := parser.New(lexer.New(`let s = repeat("ab", 3)`)).ParseProgram()
+	if _, err = in.Eval(context.Background(), program, env); err != nil {
+		t.Fatalf("eval err: %v", err)
+	}
+	s, _ := env.Get("s")
+	if s.Inspect() != "ababab" {
+		t.Fatalf("expected=ababab, got=%s", s.Inspect())
+	}
+
+	program = parser.New(lexer.New(`repeat(3, "ab")`)).ParseProgram()
+	if _, err = in.Eval(context.Background(), program, env); err == nil {
+		t.Fatalf("expected argument type error")
+	}
+
+	program = parser.New(lexer.New(`repeat("ab", 3)`)).ParseProgram()
+	if _, err = New().Eval(context.Background(), program, environment.NewEnvironment(nil)); err == nil ||
+		!strings.Contains(err.Error(), "undefined identifier: repeat") {
+		t.Fatalf("expected repeat to be undefined in another interpreter, got=%v", err)
+	}
+	if IsBuiltin("repeat") {
+		t.Fatalf("expected repeat not to be a shared builtin")
+	}
+
+	in.Builtins.RegisterFunc("len", func(s string) int { return -1 })
+	program = parser.New(lexer.New(`len("ab")`)).ParseProgram()
+	if res, err := in.Eval(context.Background(), program, env); err != nil || res.Inspect() != "-1" {
+		t.Fatalf("expected the registered len to come first, got=%v (%v)", res, err)
+	}
+	if res, err := New().Eval(context.Background(), program, env); err != nil || res.Inspect() != "2" {
+		t.Fatalf("expected the shared len, got=%v (%v)", res, err)
+	}
+}
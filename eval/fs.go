@@ -0,0 +1,215 @@
+package eval
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Serein-sz/knife/environment"
+)
+
+func init() {
+	registerModule("fs", map[string]*environment.Builtin{
+		"read":   mustBuiltin(CapFSRead, FSRead),
+		"write":  mustBuiltin(CapFSWrite, FSWrite),
+		"append": mustBuiltin(CapFSWrite, FSAppend),
+		"exists": mustBuiltin(CapFSRead, FSExists),
+		"list":   mustBuiltin(CapFSRead, FSList),
+		"mkdir":  mustBuiltin(CapFSWrite, FSMkdir),
+		"remove": mustBuiltin(CapFSWrite, FSRemove),
+		"stat":   mustBuiltin(CapFSRead, FSStat),
+		"lines":  mustBuiltin(CapFSRead, FSLines),
+	})
+}
+
+// scriptPath resolves path against ctx.Dir and checks that the script may
+// use c on it.
+func scriptPath(ctx *environment.CallContext, c Capability, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(ctx.Dir, path)
+	}
+	if ctx.CheckPath != nil {
+		if err := ctx.CheckPath(string(c), path); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// pathError names path as the script wrote it in err, which still
+// satisfies errors.Is(err, fs.ErrNotExist) and the like.
+func pathError(err error, path string) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{Op: pe.Op, Path: path, Err: pe.Err}
+	}
+	return err
+}
+
+// FSRead returns the content of the file at path.
+func FSRead(ctx *environment.CallContext, path string) (string, error) {
+	abs, err := scriptPath(ctx, CapFSRead, path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", pathError(err, path)
+	}
+	return string(data), nil
+}
+
+// FSWrite replaces the content of the file at path with data, creating
+// the file if needed.
+func FSWrite(ctx *environment.CallContext, path, data string) error {
+	abs, err := scriptPath(ctx, CapFSWrite, path)
+	if err != nil {
+		return err
+	}
+	return pathError(os.WriteFile(abs, []byte(data), 0644), path)
+}
+
+// FSAppend adds data at the end of the file at path, creating the file
+// if needed.
+func FSAppend(ctx *environment.CallContext, path, data string) error {
+	abs, err := scriptPath(ctx, CapFSWrite, path)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(abs, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return pathError(err, path)
+	}
+	if _, err := f.WriteString(data); err != nil {
+		f.Close()
+		return pathError(err, path)
+	}
+	return pathError(f.Close(), path)
+}
+
+// FSExists reports whether there is a file or a directory at path.
+func FSExists(ctx *environment.CallContext, path string) (bool, error) {
+	abs, err := scriptPath(ctx, CapFSRead, path)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(abs)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, pathError(err, path)
+}
+
+// FSList returns the names of the entries of the directory at path,
+// sorted.
+func FSList(ctx *environment.CallContext, path string) ([]string, error) {
+	abs, err := scriptPath(ctx, CapFSRead, path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return nil, pathError(err, path)
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// FSMkdir creates the directory at path along with its missing parents.
+func FSMkdir(ctx *environment.CallContext, path string) error {
+	abs, err := scriptPath(ctx, CapFSWrite, path)
+	if err != nil {
+		return err
+	}
+	return pathError(os.MkdirAll(abs, 0755), path)
+}
+
+// FSRemove removes the file or the empty directory at path.
+func FSRemove(ctx *environment.CallContext, path string) error {
+	abs, err := scriptPath(ctx, CapFSWrite, path)
+	if err != nil {
+		return err
+	}
+	return pathError(os.Remove(abs), path)
+}
+
+// FileInfo is what FSStat returns, as a hash.
+type FileInfo struct {
+	Name  string `knife:"name"`
+	Size  int64  `knife:"size"`
+	IsDir bool   `knife:"is_dir"`
+	Mode  string `knife:"mode"`
+	// ModTime is in milliseconds since the Unix epoch, as now returns.
+	ModTime int64 `knife:"mod_time"`
+}
+
+// FSStat describes the file or the directory at path.
+func FSStat(ctx *environment.CallContext, path string) (FileInfo, error) {
+	abs, err := scriptPath(ctx, CapFSRead, path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return FileInfo{}, pathError(err, path)
+	}
+	return FileInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		IsDir:   info.IsDir(),
+		Mode:    info.Mode().String(),
+		ModTime: info.ModTime().UnixMilli(),
+	}, nil
+}
+
+// FSLines returns the lines of the file at path, without their line
+// endings. With f, it calls f on each line as it is read instead, so that
+// large files are not held in memory, and returns null.
+func FSLines(ctx *environment.CallContext, path string, f ...environment.Object) (environment.Object, error) {
+	if len(f) > 1 {
+		return nil, &environment.ArgumentError{Index: -1, Message: fmt.Sprintf("expected at most 2 arguments, got %d", 1+len(f))}
+	}
+	abs, err := scriptPath(ctx, CapFSRead, path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(abs)
+	if err != nil {
+		return nil, pathError(err, path)
+	}
+	defer file.Close()
+	lines := []environment.Object{}
+	r := bufio.NewReader(file)
+	for {
+		text, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, pathError(err, path)
+		}
+		if text == "" && err == io.EOF {
+			break
+		}
+		line := &environment.String{Value: strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")}
+		if len(f) == 0 {
+			lines = append(lines, line)
+		} else if _, err := ctx.Call(f[0], line); err != nil {
+			return nil, err
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(f) == 1 {
+		return NULL, nil
+	}
+	return &environment.Array{Elements: lines}, nil
+}
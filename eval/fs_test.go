@@ -0,0 +1,99 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+)
+
+// fsInterpreter returns an interpreter resolving paths in a new directory
+// holding in.txt, allowed to read it all and to write under out.
+func fsInterpreter(t *testing.T) *Interpreter {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("a\nb\r\n\nc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	in := New()
+	in.Dir = dir
+	in.Permissions.Allow(CapFSRead)
+	in.Permissions.Allow(CapFSWrite, filepath.Join(dir, "out"))
+	return in
+}
+
+func TestFS(t *testing.T) {
+	in := fsInterpreter(t)
+	src := strings.Join([]string{
+		`func check(v, expected) { assert(json.stringify(v) == expected, json.stringify(v)) }`,
+		`func shout(l) { print(l + "!") }`,
+		`check(fs.lines("in.txt"), '["a","b","","c"]')`,
+		`check(fs.lines("in.txt", shout), "null")`,
+		`check(fs.exists("in.txt"), "true")`,
+		`check(fs.exists("out"), "false")`,
+		`fs.mkdir("out/sub")`,
+		`fs.write("out/sub/f.txt", "1")`,
+		`fs.append("out/sub/f.txt", "2")`,
+		`fs.append("out/sub/g.txt", "new")`,
+		`check(fs.read("out/sub/f.txt"), '"12"')`,
+		`check(fs.list("out/sub"), '["f.txt","g.txt"]')`,
+		`fs.remove("out/sub/g.txt")`,
+		`check(fs.list("out/sub"), '["f.txt"]')`,
+	}, "\n")
+	var out strings.Builder
+	in.Stdout = &out
+	if err := evalWith(context.Background(), in, src); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "a!\nb!\n!\nc!\n" {
+		t.Fatalf("unexpected lines: %q", out.String())
+	}
+
+	program := parser.New(lexer.New(`fs.stat("out/sub/f.txt")`)).ParseProgram()
+	res, err := in.Eval(context.Background(), program, environment.NewEnvironment(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info FileInfo
+	if err := environment.FromObject(res, &info); err != nil || info.Name != "f.txt" || info.Size != 2 || info.IsDir || info.ModTime == 0 {
+		t.Fatalf("unexpected stat %s (%v)", res.Inspect(), err)
+	}
+}
+
+func TestFSErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`fs.read("missing.txt")`, "line: 1, error: fs.read: open missing.txt: no such file or directory"},
+		{`fs.write("in.txt", "x")`, "fs.write: permission denied: fs-write"},
+		{`fs.mkdir("out/../elsewhere")`, "fs.mkdir: permission denied: fs-write"},
+		{`fs.remove("out")`, "fs.remove: remove out: no such file or directory"},
+		{`fs.list("in.txt")`, "fs.list: open in.txt: not a directory"},
+		{`fs.write("out", 1)`, "fs.write: argument 2: cannot convert NUMBER 1 to string"},
+		{`fs.lines("in.txt", len, len)`, "fs.lines: expected at most 2 arguments, got 3"},
+		{"func bad(l) { return -l }\nfs.lines(\"in.txt\", bad)", `illegal operand for prefix "-"`},
+	}
+	for _, tt := range tests {
+		err := evalWith(context.Background(), fsInterpreter(t), tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error %q, got=%v", tt.src, tt.expected, err)
+		}
+	}
+
+	err := evalWith(context.Background(), fsInterpreter(t), `fs.read("missing.txt")`)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got=%v", err)
+	}
+	err = evalWith(context.Background(), New(), `fs.exists("in.txt")`)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected ErrPermissionDenied without fs-read, got=%v", err)
+	}
+}
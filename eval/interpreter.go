@@ -0,0 +1,69 @@
+package eval
+
+import (
+	"context"
+	"io"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/environment"
+)
+
+type Interpreter struct {
+	Limits      Limits
+	Permissions Permissions
+	// Importer loads the modules of import statements; without one they
+	// fail.
+	Importer Importer
+	// Stdout and Stderr receive what scripts print; nil means os.Stdout
+	// and os.Stderr.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Dir is the directory the fs builtins resolve relative paths
+	// against; empty means the working directory.
+	Dir string
+	// Builtins holds the host functions only this interpreter exposes.
+	Builtins Builtins
+
+	done  <-chan struct{}
+	ctx   context.Context
+	steps int
+	depth int
+	// running counts the Evals in progress, so that modules evaluated
+	// while importing share the limits of the program importing them.
+	running int
+}
+
+func New() *Interpreter {
+	return &Interpreter{Limits: Limits{MaxDepth: DefaultMaxDepth}}
+}
+
+// Eval evaluates node in env. It stops with an error wrapping ctx.Err()
+// once ctx is done, or with ErrStepLimit, ErrDepthLimit or ErrAllocLimit
+// when one of the configured limits is exceeded.
+func (in *Interpreter) Eval(ctx context.Context, node ast.Node, env *environment.Environment) (environment.Object, error) {
+	if in.running == 0 {
+		in.ctx = ctx
+		in.done = ctx.Done()
+		in.steps = 0
+		in.depth = 0
+	}
+	in.running++
+	defer func() { in.running-- }()
+	return in.eval(node, env)
+}
+
+// Call invokes a Knife function or builtin with args, as a call expression
+// in a script would.
+func (in *Interpreter) Call(ctx context.Context, fn environment.Object, args ...environment.Object) (environment.Object, error) {
+	in.ctx = ctx
+	in.done = ctx.Done()
+	return in.evalFunctionCallExpression(callSite{}, fn, args)
+}
+
+// callSite stands in for the call expression when a function is called
+// from Go.
+type callSite struct{}
+
+func (callSite) Line() int            { return 0 }
+func (callSite) TokenLiteral() string { return "" }
+func (callSite) String() string       { return "" }
@@ -0,0 +1,211 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/Serein-sz/knife/environment"
+)
+
+func init() {
+	registerModule("json", map[string]*environment.Builtin{
+		"parse":     mustBuiltin("", ParseJSON),
+		"stringify": mustBuiltin("", StringifyJSON),
+	})
+}
+
+// ParseJSON returns the value s holds: objects become hashes with string
+// keys, arrays arrays and numbers numbers, integers keeping all their
+// digits. Numbers with an exponent are written out in full, which counts
+// against the allocation limit of ctx.
+func ParseJSON(ctx *environment.CallContext, s string) (environment.Object, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, jsonError(s, dec, err)
+	}
+	rest := s[dec.InputOffset():]
+	if trimmed := strings.TrimLeft(rest, " \t\r\n"); trimmed != "" {
+		offset := len(s) - len(trimmed)
+		return nil, fmt.Errorf("invalid JSON at %s: unexpected data after the value", jsonPosition(s, int64(offset)))
+	}
+	return fromJSON(ctx, v)
+}
+
+func fromJSON(ctx *environment.CallContext, v any) (environment.Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		return nativeBoolean(v), nil
+	case string:
+		return &environment.String{Value: v}, nil
+	case json.Number:
+		n, err := jsonNumber(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		return &environment.Number{Value: n}, nil
+	case []any:
+		elements := make([]environment.Object, len(v))
+		for i, e := range v {
+			obj, err := fromJSON(ctx, e)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = obj
+		}
+		return &environment.Array{Elements: elements}, nil
+	case map[string]any:
+		hash := &environment.Hash{Pairs: make(map[environment.HashKey]environment.HashPair, len(v))}
+		for k, e := range v {
+			obj, err := fromJSON(ctx, e)
+			if err != nil {
+				return nil, err
+			}
+			key := &environment.String{Value: k}
+			hash.Pairs[key.HashKey()] = environment.HashPair{Key: key, Value: obj}
+		}
+		return hash, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON value %v", v)
+}
+
+// maxJSONExponent bounds the exponents json.parse writes out, a little
+// beyond the range of float64.
+const maxJSONExponent = 400
+
+// jsonNumber returns n as numbers are written in Knife, without exponent.
+func jsonNumber(ctx *environment.CallContext, n json.Number) (string, error) {
+	s := string(n)
+	i := strings.IndexAny(s, "eE")
+	if i < 0 {
+		return s, nil
+	}
+	exp, err := strconv.Atoi(s[i+1:])
+	if err != nil || exp > maxJSONExponent || exp < -maxJSONExponent {
+		return "", fmt.Errorf("number %s is out of range, its exponent must be within ±%d", s, maxJSONExponent)
+	}
+	if ctx.CheckAlloc != nil {
+		if err := ctx.CheckAlloc(i + max(exp, -exp)); err != nil {
+			return "", err
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return "", fmt.Errorf("invalid number %s", s)
+	}
+	if r.IsInt() {
+		return r.Num().String(), nil
+	}
+	prec, _ := r.FloatPrec()
+	return r.FloatString(prec), nil
+}
+
+func jsonError(s string, dec *json.Decoder, err error) error {
+	var syntax *json.SyntaxError
+	switch {
+	case errors.As(err, &syntax):
+		// Offset counts the byte at fault
+		return fmt.Errorf("invalid JSON at %s: %s", jsonPosition(s, syntax.Offset-1), syntax.Error())
+	case err == io.EOF, err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("invalid JSON at %s: unexpected end of input", jsonPosition(s, int64(len(s))))
+	}
+	return fmt.Errorf("invalid JSON at %s: %v", jsonPosition(s, dec.InputOffset()), err)
+}
+
+// jsonPosition returns the line and column of the byte at offset in s.
+func jsonPosition(s string, offset int64) string {
+	before := s[:min(int(offset), len(s))]
+	line := strings.Count(before, "\n") + 1
+	column := len(before) - strings.LastIndex(before, "\n")
+	return fmt.Sprintf("line %d, column %d", line, column)
+}
+
+// StringifyJSON returns the JSON text of v, on a single line or, with an
+// indent, with the members of objects and arrays on their own lines
+// indented by that many spaces. Object keys are sorted.
+func StringifyJSON(v environment.Object, indent ...int) (string, error) {
+	if len(indent) > 1 {
+		return "", fmt.Errorf("expected at most 2 arguments, got %d", 1+len(indent))
+	}
+	native, err := toJSON(v, map[environment.Object]bool{})
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if len(indent) == 1 && indent[0] > 0 {
+		enc.SetIndent("", strings.Repeat(" ", indent[0]))
+	}
+	if err := enc.Encode(native); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// toJSON returns the Go value encoding/json writes as obj. visiting holds
+// the arrays and hashes obj is inside of, to report cycles.
+func toJSON(obj environment.Object, visiting map[environment.Object]bool) (any, error) {
+	switch o := obj.(type) {
+	case *environment.Null:
+		return nil, nil
+	case *environment.Boolean:
+		return o.Value, nil
+	case *environment.String:
+		return o.Value, nil
+	case *environment.Number:
+		if !json.Valid([]byte(o.Value)) {
+			return nil, fmt.Errorf("cannot encode number %s", o.Value)
+		}
+		return json.Number(o.Value), nil
+	case *environment.Array:
+		if visiting[o] {
+			return nil, errors.New("cannot encode a cyclic structure")
+		}
+		visiting[o] = true
+		defer delete(visiting, o)
+		out := make([]any, len(o.Elements))
+		for i, e := range o.Elements {
+			v, err := toJSON(e, visiting)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	case *environment.Hash:
+		if visiting[o] {
+			return nil, errors.New("cannot encode a cyclic structure")
+		}
+		visiting[o] = true
+		defer delete(visiting, o)
+		out := make(map[string]any, len(o.Pairs))
+		for _, pair := range o.Pairs {
+			var key string
+			switch k := pair.Key.(type) {
+			case *environment.String:
+				key = k.Value
+			case *environment.Number, *environment.Boolean:
+				key = k.Inspect()
+			default:
+				return nil, fmt.Errorf("cannot encode %s as an object key", pair.Key.Type())
+			}
+			v, err := toJSON(pair.Value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = v
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot encode %s", obj.Type())
+}
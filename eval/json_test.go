@@ -0,0 +1,106 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/environment"
+)
+
+// TestJSONCorpus parses every file of testdata/json, written as
+// StringifyJSON writes it, and expects to get the same text back, also
+// after a round trip through the indented form.
+func TestJSONCorpus(t *testing.T) {
+	files, err := filepath.Glob("testdata/json/*.json")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no corpus: %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := strings.TrimSuffix(string(data), "\n")
+		v, err := ParseJSON(&environment.CallContext{}, src)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if out, err := StringifyJSON(v); err != nil || out != src {
+			t.Errorf("%s: expected %s, got %s (%v)", file, src, out, err)
+			continue
+		}
+		indented, err := StringifyJSON(v, 2)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		v, err = ParseJSON(&environment.CallContext{}, indented)
+		if err != nil {
+			t.Errorf("%s: parsing the indented form: %v", file, err)
+			continue
+		}
+		if out, _ := StringifyJSON(v); out != src {
+			t.Errorf("%s: expected %s after the indented form, got %s", file, src, out)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`json.parse(" [1e3, 2.5E-2, -1E+2] ")`, "[1000, 0.025, -100]"},
+		{`json.parse('{"a": {"b": [true]}}')`, "{a: {b: [true]}}"},
+		{`json.stringify(json.parse("123456789012345678901234567890"))`, "123456789012345678901234567890"},
+		{`json.stringify(array(1, "a", null, array()), 1)`, "[\n 1,\n \"a\",\n null,\n []\n]"},
+		{`json.stringify(array())`, "[]"},
+	}
+	for _, tt := range tests {
+		res, err := evalValue(New(), tt.src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if res.Inspect() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.src, tt.expected, res.Inspect())
+		}
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`json.parse('{"a": }')`, `json.parse: invalid JSON at line 1, column 7: invalid character '}' looking for beginning of value`},
+		{`json.parse('[1,')`, "json.parse: invalid JSON at line 1, column 4: unexpected end of input"},
+		{`json.parse('{}  {}')`, "json.parse: invalid JSON at line 1, column 5: unexpected data after the value"},
+		{`json.parse(1)`, "json.parse: argument 1: cannot convert NUMBER 1 to string"},
+		{"json.stringify(len)", "json.stringify: cannot encode BUILTIN"},
+		{"json.stringify(array(double))", "json.stringify: cannot encode FUNCTION"},
+		{"json.stringify(1, 2, 3)", "json.stringify: expected at most 2 arguments, got 3"},
+		{"json.nothing(1)", "json does not export nothing"},
+		{`json.parse("1e999999")`, "json.parse: number 1e999999 is out of range, its exponent must be within ±400"},
+		{`json.parse("[1E-401]")`, "json.parse: number 1E-401 is out of range"},
+	}
+	for _, tt := range tests {
+		_, err := evalValue(New(), tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error %q, got=%v", tt.src, tt.expected, err)
+		}
+	}
+
+	cyclic := &environment.Array{}
+	cyclic.Elements = []environment.Object{&environment.Array{Elements: []environment.Object{cyclic}}}
+	if _, err := StringifyJSON(cyclic); err == nil || err.Error() != "cannot encode a cyclic structure" {
+		t.Fatalf("expected a cycle error, got=%v", err)
+	}
+	shared := &environment.Array{}
+	if out, err := StringifyJSON(&environment.Array{Elements: []environment.Object{shared, shared}}); err != nil || out != "[[],[]]" {
+		t.Fatalf("expected a shared array to be encoded twice, got %s (%v)", out, err)
+	}
+}
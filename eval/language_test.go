@@ -0,0 +1,108 @@
+package eval
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+)
+
+// evalSource returns the inspected result of src.
+func evalSource(t *testing.T, src string) string {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		t.Fatalf("%q: %v", src, err)
+	}
+	res, err := Eval(context.Background(), program, environment.NewEnvironment(nil))
+	if err != nil {
+		t.Fatalf("%q: %v", src, err)
+	}
+	return res.Inspect()
+}
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"10 - 2 - 3", "5"},
+		{"100 / 10 / 2", "5"},
+		{"2 * 3 + 4", "10"},
+		{"2 + 3 * 4", "14"},
+		{"(1 + 2) * 3", "9"},
+		{"10 - (2 - 3)", "11"},
+		{"1 + 1 <= 2", "true"},
+		{"3 >= 1 + 2", "true"},
+		{"1 < 2 == 2 > 1", "true"},
+	}
+	for _, tt := range tests {
+		if got := evalSource(t, tt.src); got != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.src, tt.expected, got)
+		}
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"1 < 2", "true"},
+		{"2.5 >= 3", "false"},
+		{"-3 + 1", "-2"},
+		{"!null", "true"},
+		{"!0", "false"},
+		{`"a" + "b" == "ab"`, "true"},
+		{"true != false", "true"},
+		{"null != null", "false"},
+		{"null == 0", "false"},
+		{"null != false", "true"},
+		{"1 == \"1\"", "false"},
+		{"if (1 > 2) { 1 } else if (2 > 1) { 2 } else { 3 }", "2"},
+		{"if (false) { 1 }", "null"},
+		{"func f(n) {\n if (n < 1) {\n return 0\n }\n return n + f(n - 1)\n}\nf(4)", "10"},
+	}
+	for _, tt := range tests {
+		if got := evalSource(t, tt.src); got != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.src, tt.expected, got)
+		}
+	}
+}
+
+func TestArity(t *testing.T) {
+	program := parser.New(lexer.New("func f(a, b) {\n return a\n}\nf(1)")).ParseProgram()
+	_, err := Eval(context.Background(), program, environment.NewEnvironment(nil))
+	if err == nil || err.Error() != "line: 4, error: expected 2 arguments, got 1\n" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestInspectFunctions(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"func f(x, y) {\n return x + y\n}\nf", "func(x, y) { return x + y }"},
+		{"len", "len is a builtin"},
+	}
+	for _, tt := range tests {
+		if got := evalSource(t, tt.src); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.src, tt.expected, got)
+		}
+	}
+}
+
+func TestNullOperands(t *testing.T) {
+	for _, src := range []string{"null < 1", "1 >= null", "null + 1", "-null"} {
+		program := parser.New(lexer.New(src)).ParseProgram()
+		_, err := Eval(context.Background(), program, environment.NewEnvironment(nil))
+		if err == nil || !strings.Contains(err.Error(), "illegal operand") {
+			t.Errorf("%q: expected an illegal operand error, got=%v", src, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/environment"
+)
+
+// DefaultMaxDepth keeps deeply recursive scripts well below the size at
+// which the Go runtime aborts the process with a stack overflow.
+const DefaultMaxDepth = 10000
+
+var (
+	ErrStepLimit  = errors.New("step limit exceeded")
+	ErrDepthLimit = errors.New("call depth limit exceeded")
+	ErrAllocLimit = errors.New("allocation limit exceeded")
+)
+
+// Limits bounds the resources a single Eval call may use. A zero value
+// disables the corresponding check.
+type Limits struct {
+	// MaxSteps is the number of nodes that may be evaluated.
+	MaxSteps int
+	// MaxDepth is the number of nested function calls.
+	MaxDepth int
+	// MaxAlloc is the largest string length or array size a script may create.
+	MaxAlloc int
+}
+
+func (in *Interpreter) step() error {
+	select {
+	case <-in.done:
+		return fmt.Errorf("execution stopped: %w", in.ctx.Err())
+	default:
+	}
+	in.steps++
+	if in.Limits.MaxSteps > 0 && in.steps > in.Limits.MaxSteps {
+		return fmt.Errorf("%w: %d", ErrStepLimit, in.Limits.MaxSteps)
+	}
+	return nil
+}
+
+func (in *Interpreter) enter(node ast.Node) error {
+	if in.Limits.MaxDepth > 0 && in.depth >= in.Limits.MaxDepth {
+		return fmt.Errorf("line: %d, error: %w: %d", node.Line(), ErrDepthLimit, in.Limits.MaxDepth)
+	}
+	in.depth++
+	return nil
+}
+
+func (in *Interpreter) leave() {
+	in.depth--
+}
+
+func (in *Interpreter) alloc(obj environment.Object) (environment.Object, error) {
+	if err := in.Limits.CheckAlloc(obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// CheckAlloc returns an error wrapping ErrAllocLimit when obj is larger
+// than MaxAlloc.
+func (l Limits) CheckAlloc(obj environment.Object) error {
+	if l.MaxAlloc <= 0 {
+		return nil
+	}
+	var size int
+	switch o := obj.(type) {
+	case *environment.String:
+		size = len(o.Value)
+	case *environment.Array:
+		size = len(o.Elements)
+	case *environment.Hash:
+		size = len(o.Pairs)
+	}
+	return l.CheckSize(size)
+}
+
+// CheckSize is CheckAlloc for a string, an array or a hash of size, before
+// it is created.
+func (l Limits) CheckSize(size int) error {
+	if l.MaxAlloc > 0 && size > l.MaxAlloc {
+		return fmt.Errorf("%w: %d > %d", ErrAllocLimit, size, l.MaxAlloc)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+)
+
+func evalWith(ctx context.Context, in *Interpreter, src string) error {
+	program := parser.New(lexer.New(src + "\n")).ParseProgram()
+	_, err := in.Eval(ctx, program, environment.NewEnvironment(nil))
+	return err
+}
+
+func TestDepthLimit(t *testing.T) {
+	in := New()
+	in.Limits.MaxDepth = 100
+	err := evalWith(context.Background(), in, "func f() { return f() + 1 }\nf()")
+	if !errors.Is(err, ErrDepthLimit) {
+		t.Fatalf("expected ErrDepthLimit, got=%v", err)
+	}
+}
+
+func TestDefaultDepthLimit(t *testing.T) {
+	err := evalWith(context.Background(), New(), "func f() { return f() + 1 }\nf()")
+	if !errors.Is(err, ErrDepthLimit) {
+		t.Fatalf("expected ErrDepthLimit, got=%v", err)
+	}
+}
+
+const loopSource = `
+func loop(n) {
+  if (n == 0) { return 0 }
+  return loop(n - 1)
+}
+func even(n) {
+  if (n == 0) { return true }
+  return odd(n - 1)
+}
+func odd(n) {
+  if (n == 0) { return false }
+  return even(n - 1)
+}
+`
+
+func TestTailCall(t *testing.T) {
+	n := "10000000"
+	if testing.Short() {
+		n = "100000"
+	}
+	in := New()
+	in.Limits.MaxDepth = 100
+	program := parseProgram(t, loopSource+"loop("+n+")", true)
+	res, err := in.Eval(context.Background(), program, environment.NewEnvironment(nil))
+	if err != nil || res.Inspect() != "0" {
+		t.Fatalf("expected 0, got %v, %v", res, err)
+	}
+	for _, resolve := range []bool{false, true} {
+		program := parseProgram(t, loopSource+"even(10001)", resolve)
+		res, err := in.Eval(context.Background(), program, environment.NewEnvironment(nil))
+		if err != nil || res.Inspect() != "false" {
+			t.Fatalf("even (resolved: %v): expected false, got %v, %v", resolve, res, err)
+		}
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	in := New()
+	in.Limits.MaxSteps = 10
+	err := evalWith(context.Background(), in, "let a = 1\nlet b = a + 1\nlet c = b + 1\nlet d = c + 1\nlet e = d + 1")
+	if !errors.Is(err, ErrStepLimit) {
+		t.Fatalf("expected ErrStepLimit, got=%v", err)
+	}
+
+	in.Limits.MaxSteps = 1000
+	if err := evalWith(context.Background(), in, "let a = 1\nlet b = a + 1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAllocLimit(t *testing.T) {
+	in := New()
+	in.Builtins.RegisterFunc("big", func(n int) string { return strings.Repeat("x", n) })
+	in.Limits.MaxAlloc = 16
+	if err := evalWith(context.Background(), in, `let s = big(8)`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := evalWith(context.Background(), in, `let s = big(64)`)
+	if !errors.Is(err, ErrAllocLimit) {
+		t.Fatalf("expected ErrAllocLimit, got=%v", err)
+	}
+	err = evalWith(context.Background(), in, `let s = "this literal is far too long"`)
+	if !errors.Is(err, ErrAllocLimit) {
+		t.Fatalf("expected ErrAllocLimit, got=%v", err)
+	}
+	err = evalWith(context.Background(), in, "func double(s, n) {\n if (n == 0) { return s }\n return double(s + s, n - 1)\n}\ndouble(\"ab\", 10)")
+	if !errors.Is(err, ErrAllocLimit) {
+		t.Fatalf("expected ErrAllocLimit building a string by concatenation, got=%v", err)
+	}
+	err = evalWith(context.Background(), in, `range(17)`)
+	if !errors.Is(err, ErrAllocLimit) {
+		t.Fatalf("expected ErrAllocLimit from range, got=%v", err)
+	}
+	if err := evalWith(context.Background(), in, `json.parse("1e3")`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = evalWith(context.Background(), in, `json.parse("[1, 1e300]")`)
+	if !errors.Is(err, ErrAllocLimit) {
+		t.Fatalf("expected ErrAllocLimit writing out an exponent, got=%v", err)
+	}
+}
+
+func TestRangeLength(t *testing.T) {
+	tests := []struct {
+		start, end, step int
+		expected         int
+	}{
+		{0, 10, 1, 10},
+		{0, 10, 3, 4},
+		{10, 0, -3, 4},
+		{0, 10, -1, 0},
+		{math.MaxInt - 2, math.MaxInt, math.MaxInt, 1},
+		{math.MinInt + 2, math.MinInt, math.MinInt, 1},
+		{math.MaxInt - 5, math.MaxInt, 2, 3},
+	}
+	for _, tt := range tests {
+		n, err := rangeLength(tt.start, tt.end, tt.step)
+		if err != nil || n != tt.expected {
+			t.Errorf("rangeLength(%d, %d, %d): expected=%d, got=%d (%v)", tt.start, tt.end, tt.step, tt.expected, n, err)
+		}
+	}
+	if _, err := rangeLength(math.MinInt, math.MaxInt, 1); err == nil {
+		t.Fatalf("expected an error for a range too large")
+	}
+	arr, err := Range(&environment.CallContext{}, math.MaxInt-5, math.MaxInt, 2)
+	if err != nil || arr.Inspect() != "[9223372036854775802, 9223372036854775804, 9223372036854775806]" {
+		t.Fatalf("unexpected range near the largest int: %v (%v)", arr, err)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := evalWith(ctx, New(), "let a = 1")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got=%v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	in := New()
+	in.Limits.MaxDepth = 0
+	src := "func f(n) { return f(n + 1) }\nf(0)"
+	err = evalWith(ctx, in, src)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got=%v", err)
+	}
+}
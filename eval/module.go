@@ -0,0 +1,86 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/environment"
+)
+
+// Importer loads the modules a program imports. Paths are passed as they
+// are written in the import statement; the importer resolves them against
+// the file being run and evaluates each file once.
+type Importer interface {
+	Import(path string) (*environment.Module, error)
+}
+
+// Import loads the module at path for an import statement on line.
+func Import(importer Importer, line int, path string) (*environment.Module, error) {
+	if importer == nil {
+		return nil, fmt.Errorf("line: %d, error: cannot import %q: imports are not enabled\n", line, path)
+	}
+	m, err := importer.Import(path)
+	if err != nil {
+		return nil, fmt.Errorf("line: %d, error: import %q: %w", line, path, err)
+	}
+	return m, nil
+}
+
+// Member returns the export name of obj, or its method name for a regex,
+// as obj.name does.
+func Member(obj environment.Object, name string, line int) (environment.Object, error) {
+	switch o := obj.(type) {
+	case *environment.Module:
+		value, ok := o.Exports[name]
+		if !ok {
+			return nil, fmt.Errorf("line: %d, error: %s does not export %s\n", line, o.Path, name)
+		}
+		return value, nil
+	case *environment.Regex:
+		if method, ok := o.Methods[name]; ok {
+			return method, nil
+		}
+	}
+	return nil, fmt.Errorf("line: %d, error: %s has no member %s\n", line, obj.Type(), name)
+}
+
+// Exports returns the values of the names program exports, once it has
+// run in env.
+func Exports(program *ast.Program, env *environment.Environment) map[string]environment.Object {
+	exports := map[string]environment.Object{}
+	for _, s := range program.Statements {
+		var name string
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			if s.Exported {
+				name = s.Name.Value
+			}
+		case *ast.FunctionDefineStatement:
+			if s.Exported {
+				name = s.Name.Value
+			}
+		}
+		if value, ok := env.Lookup(name); name != "" && ok {
+			exports[name] = value
+		}
+	}
+	return exports
+}
+
+func (in *Interpreter) evalImportStatement(node *ast.ImportStatement, env *environment.Environment) (environment.Object, error) {
+	m, err := Import(in.Importer, node.Line(), node.Path.Value)
+	if err != nil {
+		return nil, err
+	}
+	if node.Alias != nil {
+		define(node.Alias, m, env)
+	}
+	for _, name := range node.Names {
+		value, err := Member(m, name.Value, name.Line())
+		if err != nil {
+			return nil, err
+		}
+		define(name, value, env)
+	}
+	return nil, nil
+}
@@ -1,6 +1,7 @@
 package eval
 
 import (
+	"cmp"
 	"fmt"
 	"strconv"
 	"strings"
@@ -117,3 +118,29 @@ func CalculateNumbers(num1, num2, op string) (string, error) {
 	}
 	return strconv.Itoa(result), nil
 }
+
+// CompareNumbers 比较两个字符串数字的大小，支持整数和浮点数
+// 参数: num1, num2 - 要比较的数字字符串
+// 返回: num1 小于、等于、大于 num2 时分别为 -1、0、1，以及可能的错误
+func CompareNumbers(num1, num2 string) (int, error) {
+	if !strings.Contains(num1, ".") && !strings.Contains(num2, ".") {
+		i1, err := strconv.Atoi(num1)
+		if err != nil {
+			return 0, fmt.Errorf("无法解析第一个数字: %v", err)
+		}
+		i2, err := strconv.Atoi(num2)
+		if err != nil {
+			return 0, fmt.Errorf("无法解析第二个数字: %v", err)
+		}
+		return cmp.Compare(i1, i2), nil
+	}
+	f1, err := strconv.ParseFloat(num1, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无法解析第一个数字: %v", err)
+	}
+	f2, err := strconv.ParseFloat(num2, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无法解析第二个数字: %v", err)
+	}
+	return cmp.Compare(f1, f2), nil
+}
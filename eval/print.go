@@ -0,0 +1,86 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/Serein-sz/knife/environment"
+)
+
+func init() {
+	registerBuiltin("print", "", Print)
+	registerBuiltin("println", "", Println)
+	registerBuiltin("printf", "", Printf)
+	registerBuiltin("eprint", "", Eprint)
+}
+
+// Print writes its arguments to ctx.Stdout, separated by commas, and a
+// newline.
+func Print(ctx *environment.CallContext) (environment.Object, error) {
+	return writeLine(ctx.Stdout, ctx.Args, ", ")
+}
+
+// Println writes its arguments to ctx.Stdout, separated by spaces, and a
+// newline.
+func Println(ctx *environment.CallContext) (environment.Object, error) {
+	return writeLine(ctx.Stdout, ctx.Args, " ")
+}
+
+// Eprint is Print writing to ctx.Stderr.
+func Eprint(ctx *environment.CallContext) (environment.Object, error) {
+	return writeLine(ctx.Stderr, ctx.Args, ", ")
+}
+
+func writeLine(w io.Writer, args []environment.Object, sep string) (environment.Object, error) {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = a.Inspect()
+	}
+	if _, err := io.WriteString(w, strings.Join(parts, sep)+"\n"); err != nil {
+		return nil, err
+	}
+	return NULL, nil
+}
+
+// Printf writes its arguments to ctx.Stdout formatted by the first one,
+// with the verbs of Go's fmt package: numbers are formatted as integers
+// or floats, strings and booleans as themselves and other values as they
+// are printed.
+func Printf(ctx *environment.CallContext) (environment.Object, error) {
+	format, err := ctx.ExpectString(0)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]any, len(ctx.Args)-1)
+	for i, a := range ctx.Args[1:] {
+		args[i] = formatArg(a)
+	}
+	if _, err := fmt.Fprintf(ctx.Stdout, format, args...); err != nil {
+		return nil, err
+	}
+	return NULL, nil
+}
+
+// formatArg returns the Go value obj is formatted as by Printf.
+func formatArg(obj environment.Object) any {
+	switch o := obj.(type) {
+	case *environment.Number:
+		if i, err := strconv.ParseInt(o.Value, 10, 64); err == nil {
+			return i
+		}
+		if i, ok := new(big.Int).SetString(o.Value, 10); ok {
+			return i
+		}
+		if f, err := strconv.ParseFloat(o.Value, 64); err == nil {
+			return f
+		}
+	case *environment.String:
+		return o.Value
+	case *environment.Boolean:
+		return o.Value
+	}
+	return obj.Inspect()
+}
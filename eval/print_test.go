@@ -0,0 +1,58 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Serein-sz/knife/environment"
+)
+
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		src    string
+		stdout string
+		stderr string
+	}{
+		{"print()", "\n", ""},
+		{`print(1, "a", array(2))`, "1, a, [2]\n", ""},
+		{`println(1, "a", array(2))`, "1 a [2]\n", ""},
+		{`eprint("e", 1)`, "", "e, 1\n"},
+		{`printf("%d|%5.2f|%s|%q|%v|%t|%x", 42, 1.5, "s", "q", array(1), true, 255)`, "42| 1.50|s|\"q\"|[1]|true|ff", ""},
+		{`printf("%d %v", 123456789012345678901234567890, null)`, "123456789012345678901234567890 null", ""},
+		{`printf("%d")`, "%!d(MISSING)", ""},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		in := New()
+		in.Stdout, in.Stderr = &stdout, &stderr
+		if err := evalWith(context.Background(), in, tt.src); err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+			t.Errorf("%s: expected %q and %q, got %q and %q", tt.src, tt.stdout, tt.stderr, stdout.String(), stderr.String())
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestPrintErrors(t *testing.T) {
+	in := New()
+	in.Stdout = failingWriter{}
+	err := evalWith(context.Background(), in, "print(1)")
+	if err == nil || err.Error() != "line: 1, error: print: disk full" {
+		t.Fatalf("expected the write error, got=%v", err)
+	}
+	err = evalWith(context.Background(), New(), "printf(1)")
+	var argErr *environment.ArgumentError
+	if !errors.As(err, &argErr) || err.Error() != "line: 1, error: printf: argument 1: expected STRING, got NUMBER" {
+		t.Fatalf("expected an argument error, got=%v", err)
+	}
+}
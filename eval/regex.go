@@ -0,0 +1,220 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/Serein-sz/knife/environment"
+)
+
+func init() {
+	registerBuiltin("re", "", Re)
+}
+
+// maxCachedRegexes bounds the regexes Re keeps compiled; the cache is
+// emptied once it is full.
+const maxCachedRegexes = 1024
+
+var regexCache = struct {
+	sync.Mutex
+	m map[string]*environment.Regex
+}{m: map[string]*environment.Regex{}}
+
+// Re returns the regex of its argument, a pattern in the syntax of Go's
+// regexp package. Patterns are compiled once and the same regex is
+// returned for the same pattern.
+func Re(ctx *environment.CallContext) (environment.Object, error) {
+	if err := ctx.ExpectArgs(1); err != nil {
+		return nil, err
+	}
+	pattern, err := ctx.ExpectString(0)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Lock()
+	defer regexCache.Unlock()
+	if r, ok := regexCache.m[pattern]; ok {
+		return r, nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, &environment.ArgumentError{Index: 0, Message: err.Error(), Err: err}
+	}
+	if len(regexCache.m) >= maxCachedRegexes {
+		clear(regexCache.m)
+	}
+	r := newRegex(compiled)
+	regexCache.m[pattern] = r
+	return r, nil
+}
+
+type regexMethod func(re *regexp.Regexp, ctx *environment.CallContext) (environment.Object, error)
+
+var regexMethods = map[string]regexMethod{
+	"match":    regexMatch,
+	"find":     regexFind,
+	"find_all": regexFindAll,
+	"replace":  regexReplace,
+	"split":    regexSplit,
+}
+
+func newRegex(re *regexp.Regexp) *environment.Regex {
+	methods := make(map[string]environment.Object, len(regexMethods))
+	for name, m := range regexMethods {
+		methods[name] = &environment.Builtin{
+			Name: "regex." + name,
+			Function: func(ctx *environment.CallContext) (environment.Object, error) {
+				return m(re, ctx)
+			},
+		}
+	}
+	return &environment.Regex{Regexp: re, Methods: methods}
+}
+
+// regexMatch reports whether s contains a match: r.match(s).
+func regexMatch(re *regexp.Regexp, ctx *environment.CallContext) (environment.Object, error) {
+	if err := ctx.ExpectArgs(1); err != nil {
+		return nil, err
+	}
+	s, err := ctx.ExpectString(0)
+	if err != nil {
+		return nil, err
+	}
+	return nativeBoolean(re.MatchString(s)), nil
+}
+
+// regexFind returns the first match in s, or null: r.find(s).
+func regexFind(re *regexp.Regexp, ctx *environment.CallContext) (environment.Object, error) {
+	if err := ctx.ExpectArgs(1); err != nil {
+		return nil, err
+	}
+	s, err := ctx.ExpectString(0)
+	if err != nil {
+		return nil, err
+	}
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return NULL, nil
+	}
+	return matchHash(re, s, loc), nil
+}
+
+// regexFindAll returns the matches in s, at most n of them when n is
+// given: r.find_all(s, n?).
+func regexFindAll(re *regexp.Regexp, ctx *environment.CallContext) (environment.Object, error) {
+	s, n, err := stringAndLimit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches := []environment.Object{}
+	for _, loc := range re.FindAllStringSubmatchIndex(s, n) {
+		matches = append(matches, matchHash(re, s, loc))
+	}
+	return &environment.Array{Elements: matches}, nil
+}
+
+// regexSplit returns the parts of s between the matches, at most n of them
+// when n is given: r.split(s, n?).
+func regexSplit(re *regexp.Regexp, ctx *environment.CallContext) (environment.Object, error) {
+	s, n, err := stringAndLimit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	parts := re.Split(s, n)
+	elements := make([]environment.Object, len(parts))
+	for i, p := range parts {
+		elements[i] = &environment.String{Value: p}
+	}
+	return &environment.Array{Elements: elements}, nil
+}
+
+// stringAndLimit returns the arguments of find_all and split: a string and
+// an optional count, -1 when missing.
+func stringAndLimit(ctx *environment.CallContext) (string, int, error) {
+	if len(ctx.Args) != 1 && len(ctx.Args) != 2 {
+		return "", 0, &environment.ArgumentError{Index: -1, Message: fmt.Sprintf("expected 1 or 2 arguments, got %d", len(ctx.Args))}
+	}
+	s, err := ctx.ExpectString(0)
+	if err != nil {
+		return "", 0, err
+	}
+	n := -1
+	if len(ctx.Args) == 2 {
+		if err := environment.FromObject(ctx.Args[1], &n); err != nil {
+			return "", 0, &environment.ArgumentError{Index: 1, Message: err.Error(), Err: err}
+		}
+	}
+	return s, n, nil
+}
+
+// regexReplace replaces the matches in s: r.replace(s, repl). A string
+// repl may refer to groups as $1 or ${name}; otherwise repl is called with
+// each match and returns its replacement.
+func regexReplace(re *regexp.Regexp, ctx *environment.CallContext) (environment.Object, error) {
+	if err := ctx.ExpectArgs(2); err != nil {
+		return nil, err
+	}
+	s, err := ctx.ExpectString(0)
+	if err != nil {
+		return nil, err
+	}
+	if repl, ok := ctx.Args[1].(*environment.String); ok {
+		return &environment.String{Value: re.ReplaceAllString(s, repl.Value)}, nil
+	}
+	var out strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		v, err := ctx.Call(ctx.Args[1], matchHash(re, s, loc))
+		if err != nil {
+			return nil, err
+		}
+		repl, ok := v.(*environment.String)
+		if !ok {
+			return nil, fmt.Errorf("replacement must be a %s, got %s", environment.STRING, v.Type())
+		}
+		out.WriteString(s[last:loc[0]])
+		out.WriteString(repl.Value)
+		last = loc[1]
+	}
+	out.WriteString(s[last:])
+	return &environment.String{Value: out.String()}, nil
+}
+
+// matchHash describes the match of re in s at loc: its text, the index of
+// its first character, the array of its groups, null when they did not
+// take part in the match, and the hash of its named groups.
+func matchHash(re *regexp.Regexp, s string, loc []int) *environment.Hash {
+	group := func(i int) environment.Object {
+		if loc[2*i] < 0 {
+			return NULL
+		}
+		return &environment.String{Value: s[loc[2*i]:loc[2*i+1]]}
+	}
+	groups := make([]environment.Object, re.NumSubexp())
+	named := &environment.Hash{Pairs: map[environment.HashKey]environment.HashPair{}}
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		groups[i-1] = group(i)
+		if name != "" {
+			key := &environment.String{Value: name}
+			named.Pairs[key.HashKey()] = environment.HashPair{Key: key, Value: groups[i-1]}
+		}
+	}
+	hash := &environment.Hash{Pairs: map[environment.HashKey]environment.HashPair{}}
+	for name, value := range map[string]environment.Object{
+		"text":   group(0),
+		"index":  &environment.Number{Value: strconv.Itoa(utf8.RuneCountInString(s[:loc[0]]))},
+		"groups": &environment.Array{Elements: groups},
+		"named":  named,
+	} {
+		key := &environment.String{Value: name}
+		hash.Pairs[key.HashKey()] = environment.HashPair{Key: key, Value: value}
+	}
+	return hash
+}
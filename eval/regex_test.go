@@ -0,0 +1,68 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+)
+
+const logLine = `let log = "INFO 200 ok, WARN 404 missing, ERROR 500"
+let r = re("(?P<level>[A-Z]+) (?P<code>[0-9]+)(x)?")
+func code(m) { return get(get(m, "named"), "code") + "!" }
+func number(m) { return 1 }
+`
+
+func TestRegex(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"r", "/(?P<level>[A-Z]+) (?P<code>[0-9]+)(x)?/"},
+		{"r.match(log)", "true"},
+		{`r.match("info")`, "false"},
+		{"r.find(log)", "{groups: [INFO, 200, null], index: 0, named: {code: 200, level: INFO}, text: INFO 200}"},
+		{`get(re("é+").find("aéé"), "index")`, "1"},
+		{`r.find("")`, "null"},
+		{"len(r.find_all(log))", "3"},
+		{`get(get(r.find_all(log, 2), 1), "text")`, "WARN 404"},
+		{`re("a").find_all("bbb")`, "[]"},
+		{`r.replace(log, "${code}:$level")`, "200:INFO ok, 404:WARN missing, 500:ERROR"},
+		{"r.replace(log, code)", "200! ok, 404! missing, 500!"},
+		{`re(",\s*").split(log)`, "[INFO 200 ok, WARN 404 missing, ERROR 500]"},
+		{`len(re(",").split(log, 2))`, "2"},
+		{`re("a+") == re("a+")`, "true"},
+		{"json.stringify(get(r.find(log), \"named\"))", `{"code":"200","level":"INFO"}`},
+	}
+	for _, tt := range tests {
+		res, err := evalValue(New(), logLine+tt.src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if res.Inspect() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.src, tt.expected, res.Inspect())
+		}
+	}
+}
+
+func TestRegexErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`re("(a")`, "re: argument 1: error parsing regexp: missing closing ): `(a`"},
+		{"re(1)", "re: argument 1: expected STRING, got NUMBER"},
+		{"r.match(1)", "regex.match: argument 1: expected STRING, got NUMBER"},
+		{"r.find()", "regex.find: expected 1 arguments, got 0"},
+		{`r.split(log, "a")`, "regex.split: argument 2: cannot convert STRING a to int"},
+		{"r.find_all()", "regex.find_all: expected 1 or 2 arguments, got 0"},
+		{"r.replace(log, number)", "regex.replace: replacement must be a STRING, got NUMBER"},
+		{"r.nothing", "REGEX has no member nothing"},
+		{`get(log, 0)`, "get: argument 1: cannot get from STRING"},
+	}
+	for _, tt := range tests {
+		_, err := evalValue(New(), logLine+tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error %q, got=%v", tt.src, tt.expected, err)
+		}
+	}
+}
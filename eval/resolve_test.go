@@ -0,0 +1,89 @@
+package eval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+	"github.com/Serein-sz/knife/resolver"
+)
+
+const fibSource = `
+func fib(n) {
+  if (n < 2) {
+    return n
+  }
+  return fib(n - 1) + fib(n - 2)
+}
+`
+
+func parseProgram(t testing.TB, src string, resolve bool) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if resolve {
+		r := resolver.New(BuiltinNames()...)
+		r.Resolve(program)
+		if err := r.Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return program
+}
+
+func TestResolvedEval(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{fibSource + "fib(10)", "55"},
+		{"func f(x) {\n let y = x * 2\n func g() {\n return x + y\n }\n return g()\n}\nf(2)", "6"},
+		{"let a = 1\nfunc f() {\n let b = a + 1\n return b\n}\nlet a = 5\nf()", "6"},
+		{"func f(a, b) {\n let c = a - b\n if (c > 0) {\n return c\n }\n return -c\n}\nf(2, 5)", "3"},
+	}
+	for _, resolve := range []bool{false, true} {
+		for _, tt := range tests {
+			program := parseProgram(t, tt.src, resolve)
+			res, err := Eval(context.Background(), program, environment.NewEnvironment(nil))
+			if err != nil {
+				t.Fatalf("%q (resolved: %v): %v", tt.src, resolve, err)
+			}
+			if got := res.Inspect(); got != tt.expected {
+				t.Errorf("%q (resolved: %v): expected %s, got %s", tt.src, resolve, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestResolvedArity(t *testing.T) {
+	program := parseProgram(t, "func f(a, b) {\n return a\n}\nf(1)", true)
+	_, err := Eval(context.Background(), program, environment.NewEnvironment(nil))
+	if err == nil || err.Error() != "line: 4, error: expected 2 arguments, got 1\n" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// BenchmarkFib25 compares looking names up through the environment maps
+// with the slot-indexed frames assigned by the resolver.
+func BenchmarkFib25(b *testing.B) {
+	for _, bm := range []struct {
+		name    string
+		resolve bool
+	}{{"unresolved", false}, {"resolved", true}} {
+		b.Run(bm.name, func(b *testing.B) {
+			program := parseProgram(b, fibSource+"fib(25)", bm.resolve)
+			in := New()
+			for i := 0; i < b.N; i++ {
+				if _, err := in.Eval(context.Background(), program, environment.NewEnvironment(nil)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
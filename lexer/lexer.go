@@ -1,13 +1,19 @@
 package lexer
 
-import "github.com/Serein-sz/knife/token"
+import (
+	"strings"
+
+	"github.com/Serein-sz/knife/token"
+)
 
 type Lexer struct {
 	src          string
 	line         int
+	lineStart    int
 	position     int
 	readPosition int
 	ch           byte
+	comments     []token.Token
 }
 
 func New(src string) *Lexer {
@@ -20,10 +26,16 @@ func New(src string) *Lexer {
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
+	for l.ch == '/' && l.peekChar() == '/' {
+		column := l.column()
+		l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: l.readComment(), Line: l.line, Column: column})
+		l.skipWhitespace()
+	}
+	column := l.column()
 	switch l.ch {
-	case '"':
+	case '"', '\'':
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Literal = l.readString(l.ch)
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -93,18 +105,20 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
-			tok.Line = l.line
+			tok.Line, tok.Column = l.line, column
 			return tok
+		} else if l.ch == '.' && isLetter(l.peekChar()) {
+			tok = token.Token{Type: token.DOT, Literal: string(l.ch)}
 		} else if isDigit(l.ch) {
 			tok.Type = token.NUMBER
 			tok.Literal = l.readNumber()
-			tok.Line = l.line
+			tok.Line, tok.Column = l.line, column
 			return tok
 		} else {
 			tok = token.Token{Type: token.ILLEGAL, Literal: string(l.ch)}
 		}
 	}
-	tok.Line = l.line
+	tok.Line, tok.Column = l.line, column
 	l.readChar()
 	return tok
 }
@@ -117,21 +131,31 @@ func (l *Lexer) readIdentifier() string {
 	return l.src[position:l.position]
 }
 
-func (l *Lexer) readString() string {
+// Comments returns the line comments skipped so far, in source order.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+func (l *Lexer) readString(quote byte) string {
 	pos := l.position + 1
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
+		if l.ch == quote || l.ch == 0 {
 			break
 		}
 	}
 	return l.src[pos:l.position]
 }
 
-func (l *Lexer) readNumber() string {
-	if l.readPosition >= len(l.src) {
-		l.ch = 0
+func (l *Lexer) readComment() string {
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
 	}
+	return strings.TrimRight(l.src[position:l.position], "\r")
+}
+
+func (l *Lexer) readNumber() string {
 	position := l.position
 	for isDigit(l.ch) {
 		l.readChar()
@@ -157,10 +181,16 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// column is the 1-based byte column of the current character.
+func (l *Lexer) column() int {
+	return l.position - l.lineStart + 1
+}
+
 func (l *Lexer) skipWhitespace() {
 	for isWhitespace(l.ch) {
 		if l.ch == '\n' || l.ch == '\r' {
 			l.line++
+			l.lineStart = l.position + 1
 		}
 		l.readChar()
 	}
@@ -134,3 +134,80 @@ func ReadFile(filename string) (string, error) {
 	// 确保使用UTF-8编码和LF换行符
 	return string(content), nil
 }
+
+func TestCommentsAndQuotes(t *testing.T) {
+	src := "// leading\nlet a = 'single' // trailing\nlet b = a / 2\n"
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "a"},
+		{token.ASSIGN, "="},
+		{token.STRING, "single"},
+		{token.LET, "let"},
+		{token.IDENT, "b"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "a"},
+		{token.SLASH, "/"},
+		{token.NUMBER, "2"},
+		{token.EOF, ""},
+	}
+	l := New(src)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected=%s %q, got=%s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+	comments := l.Comments()
+	if len(comments) != 2 {
+		t.Fatalf("expected 2 comments, got %d", len(comments))
+	}
+	if comments[0].Literal != "// leading" || comments[0].Line != 1 {
+		t.Fatalf("unexpected comment: %+v", comments[0])
+	}
+	if comments[1].Literal != "// trailing" || comments[1].Line != 2 {
+		t.Fatalf("unexpected comment: %+v", comments[1])
+	}
+}
+
+func TestColumns(t *testing.T) {
+	l := New("let a = 1\n  print(\"x\") // c\n")
+	expected := [][2]int{{1, 1}, {1, 5}, {1, 7}, {1, 9}, {2, 3}, {2, 8}, {2, 9}, {2, 12}, {3, 1}}
+	for i, pos := range expected {
+		tok := l.NextToken()
+		if tok.Line != pos[0] || tok.Column != pos[1] {
+			t.Fatalf("tests[%d] %q - expected %d:%d, got %d:%d", i, tok.Literal, pos[0], pos[1], tok.Line, tok.Column)
+		}
+	}
+	if c := l.Comments()[0]; c.Line != 2 || c.Column != 14 {
+		t.Fatalf("unexpected comment position %d:%d", c.Line, c.Column)
+	}
+}
+
+// A number ending the input used to lex as an empty literal when it was a
+// single digit, so that `let a = 7` without a final newline lost its value.
+func TestNumberAtEOF(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"7", "7"},
+		{"let a = 7", "7"},
+		{"let a = 42", "42"},
+	}
+	for i, tt := range tests {
+		l := New(tt.src)
+		tok := l.NextToken()
+		for tok.Type != token.NUMBER && tok.Type != token.EOF {
+			tok = l.NextToken()
+		}
+		if tok.Type != token.NUMBER || tok.Literal != tt.expected {
+			t.Fatalf("tests[%d] - expected NUMBER %q, got %s %q", i, tt.expected, tok.Type, tok.Literal)
+		}
+		if tok = l.NextToken(); tok.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after the number, got %s %q", i, tok.Type, tok.Literal)
+		}
+	}
+}
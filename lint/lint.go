@@ -0,0 +1,179 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	// SeverityOff disables a rule.
+	SeverityOff Severity = "off"
+)
+
+// Diagnostic is a single problem reported by a rule.
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s (%s)", d.File, d.Line, d.Severity, d.Message, d.Rule)
+}
+
+// Rule inspects a program and reports its findings on the pass.
+type Rule interface {
+	Name() string
+	Description() string
+	// Severity is the severity used when the configuration does not
+	// override it.
+	Severity() Severity
+	Check(pass *Pass)
+}
+
+var registry = map[string]Rule{}
+
+// Register makes a rule available to every Linter. It panics when a rule
+// with the same name is already registered.
+func Register(rule Rule) {
+	if _, ok := registry[rule.Name()]; ok {
+		panic("lint: rule registered twice: " + rule.Name())
+	}
+	registry[rule.Name()] = rule
+}
+
+// Rules returns the registered rules sorted by name.
+func Rules() []Rule {
+	rules := make([]Rule, 0, len(registry))
+	for _, r := range registry {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name() < rules[j].Name() })
+	return rules
+}
+
+// Config overrides the severity of rules by name. Rules that are not
+// mentioned keep their default severity.
+type Config struct {
+	Rules map[string]Severity
+}
+
+// Pass carries the program being linted and the scope information shared
+// by the rules.
+type Pass struct {
+	Program *ast.Program
+	Scopes  *Scopes
+
+	rule        Rule
+	diagnostics []Diagnostic
+}
+
+// Report records a diagnostic for the running rule at the line of node.
+func (p *Pass) Report(node ast.Node, format string, a ...any) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Line:    node.Line(),
+		Rule:    p.rule.Name(),
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+type Linter struct {
+	rules    []Rule
+	severity map[string]Severity
+}
+
+// New returns a Linter running every registered rule that cfg does not
+// turn off. Unknown rule names in cfg are an error.
+func New(cfg Config) (*Linter, error) {
+	l := &Linter{severity: map[string]Severity{}}
+	for name, severity := range cfg.Rules {
+		if _, ok := registry[name]; !ok {
+			return nil, fmt.Errorf("unknown lint rule: %s", name)
+		}
+		switch severity {
+		case SeverityError, SeverityWarning, SeverityOff:
+		default:
+			return nil, fmt.Errorf("%s: unknown severity %q", name, severity)
+		}
+	}
+	for _, r := range Rules() {
+		severity := r.Severity()
+		if s, ok := cfg.Rules[r.Name()]; ok {
+			severity = s
+		}
+		if severity == SeverityOff {
+			continue
+		}
+		l.rules = append(l.rules, r)
+		l.severity[r.Name()] = severity
+	}
+	return l, nil
+}
+
+// Lint runs the rules over program and returns the diagnostics that are not
+// suppressed by knife-lint comments, ordered by line.
+func (l *Linter) Lint(file string, program *ast.Program) []Diagnostic {
+	scopes := analyze(program)
+	suppressions := parseSuppressions(program.Comments)
+	var diagnostics []Diagnostic
+	for _, r := range l.rules {
+		pass := &Pass{Program: program, Scopes: scopes, rule: r}
+		r.Check(pass)
+		for _, d := range pass.diagnostics {
+			if suppressions.suppressed(d.Rule, d.Line) {
+				continue
+			}
+			d.File = file
+			d.Severity = l.severity[r.Name()]
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool { return diagnostics[i].Line < diagnostics[j].Line })
+	return diagnostics
+}
+
+// LintSource parses src and lints it. Syntax errors are reported as
+// diagnostics of the "syntax" rule, at most one per line, and stop the
+// other rules from running.
+func (l *Linter) LintSource(file, src string) []Diagnostic {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		diagnostics := make([]Diagnostic, 0, len(errs))
+		for _, msg := range errs {
+			d := syntaxDiagnostic(file, msg)
+			if n := len(diagnostics); n > 0 && diagnostics[n-1].Line == d.Line {
+				continue
+			}
+			diagnostics = append(diagnostics, d)
+		}
+		return diagnostics
+	}
+	return l.Lint(file, program)
+}
+
+// syntaxDiagnostic converts a parser message of the form
+// "line: N, error: ..." into a diagnostic.
+func syntaxDiagnostic(file, msg string) Diagnostic {
+	d := Diagnostic{File: file, Rule: "syntax", Severity: SeverityError, Message: msg}
+	if rest, ok := strings.CutPrefix(msg, "line: "); ok {
+		if n, text, ok := strings.Cut(rest, ", error: "); ok {
+			if line, err := strconv.Atoi(n); err == nil {
+				d.Line, d.Message = line, text
+			}
+		}
+	}
+	return d
+}
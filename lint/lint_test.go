@@ -0,0 +1,138 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func lintSource(t *testing.T, cfg Config, src string) []string {
+	t.Helper()
+	l, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, d := range l.LintSource("test.k", src) {
+		out = append(out, fmt.Sprintf("%d %s", d.Line, d.Rule))
+	}
+	return out
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected []string
+	}{
+		{"clean", "func add(a, b) {\n return a + b\n}\nprint(add(1, 2))\n", nil},
+		{"unused variable", "let a = 1\nlet b = 2\nprint(b)\n", []string{"1 unused-variable"}},
+		{"unused parameter", "func f(a, b) {\n return a\n}\nf(1, 2)\n", []string{"1 unused-parameter"}},
+		{"shadowed name", "let x = 1\nfunc f(x) {\n return x\n}\nf(x)\n", []string{"2 shadowed-name"}},
+		{"shadowed builtin", "func f(print) {\n return print\n}\nf(1)\n", []string{"1 shadowed-name"}},
+		{"unreachable", "func f() {\n return 1\n print(2)\n}\nf()\n", []string{"3 unreachable-code"}},
+		{"undefined call", "foo(1)\n", []string{"1 undefined-call"}},
+		{"call before definition", "f()\nfunc f() {}\n", []string{"1 undefined-call"}},
+		{"later global used in body", "func f() {\n return g\n}\nlet g = 1\nf()\n", nil},
+		{"wrong arity", "func f(a) {\n return a\n}\nf(1, 2)\n", []string{"4 wrong-arity"}},
+		{"self comparison", "let a = 1\nprint(a == a)\n", []string{"2 self-comparison"}},
+		{"calls may differ", "func f() {\n return 1\n}\nprint(f() == f())\n", nil},
+		{"null on the left", "let a = 1\nprint(null == a)\n", []string{"2 null-comparison"}},
+		{"ordering with null", "let a = 1\nprint(a < null)\n", []string{"2 null-comparison"}},
+		{"syntax error", "print(1 +)\n", []string{"1 syntax"}},
+		{"unused import", "import \"./a.k\" as a\nimport { b, c } from \"./b.k\"\nprint(c)\n", []string{"1 unused-variable", "2 unused-variable"}},
+		{"exported", "import \"./a.k\" as a\nexport let b = a.x\nexport func f() {}\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lintSource(t, Config{}, tt.src)
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Fatalf("expected=%v, got=%v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNullComparisonMessages(t *testing.T) {
+	l, _ := New(Config{})
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"let a = 1\nprint(a < null)\n", "ordering comparison with null fails at runtime, use == null or != null"},
+		{"print(null == null)\n", "null == null is constant"},
+		{"let a = 1\nprint(null != a)\n", "write a != null instead of null != a"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, d := range l.LintSource("test.k", tt.src) {
+			if d.Rule == "null-comparison" {
+				got = append(got, d.Message)
+			}
+		}
+		if len(got) != 1 || got[0] != tt.expected {
+			t.Errorf("%q: expected %q, got=%q", tt.src, tt.expected, got)
+		}
+	}
+}
+
+func TestConfigAndSuppressions(t *testing.T) {
+	src := "let a = 1\nlet b = 2 // knife-lint: disable-line unused-variable\n// knife-lint: disable-next-line\nlet c = 3\nfoo()\n"
+	got := lintSource(t, Config{}, src)
+	if fmt.Sprint(got) != "[1 unused-variable 5 undefined-call]" {
+		t.Fatalf("unexpected diagnostics: %v", got)
+	}
+	got = lintSource(t, Config{Rules: map[string]Severity{"unused-variable": SeverityOff}}, src)
+	if fmt.Sprint(got) != "[5 undefined-call]" {
+		t.Fatalf("unexpected diagnostics: %v", got)
+	}
+	got = lintSource(t, Config{}, "// knife-lint: disable-file undefined-call\n"+src)
+	if fmt.Sprint(got) != "[2 unused-variable]" {
+		t.Fatalf("unexpected diagnostics: %v", got)
+	}
+	if _, err := New(Config{Rules: map[string]Severity{"no-such-rule": SeverityOff}}); err == nil {
+		t.Fatalf("expected unknown rule to be rejected")
+	}
+}
+
+func TestOutput(t *testing.T) {
+	l, _ := New(Config{Rules: map[string]Severity{"unused-variable": SeverityError}})
+	diagnostics := l.LintSource("a.k", "let a = 1\n")
+
+	var out bytes.Buffer
+	WriteText(&out, diagnostics)
+	if expected := "a.k:1: error: a is assigned but never used (unused-variable)\n"; out.String() != expected {
+		t.Fatalf("expected=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	WriteJSON(&out, diagnostics)
+	var decoded []Diagnostic
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0] != diagnostics[0] {
+		t.Fatalf("unexpected json %s: %v", out.String(), err)
+	}
+
+	out.Reset()
+	WriteSARIF(&out, diagnostics, "test")
+	var sarif struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Results []struct {
+				RuleID string `json:"ruleId"`
+				Level  string `json:"level"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &sarif); err != nil {
+		t.Fatal(err)
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != 1 ||
+		sarif.Runs[0].Results[0].RuleID != "unused-variable" || sarif.Runs[0].Results[0].Level != "error" {
+		t.Fatalf("unexpected sarif:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `"startLine": 1`) {
+		t.Fatalf("missing region:\n%s", out.String())
+	}
+}
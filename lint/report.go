@@ -0,0 +1,91 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+func WriteText(w io.Writer, diagnostics []Diagnostic) error {
+	for _, d := range diagnostics {
+		if _, err := fmt.Fprintln(w, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func WriteJSON(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diagnostics)
+}
+
+// WriteSARIF writes the diagnostics as a SARIF 2.1.0 log with a single run,
+// listing every registered rule.
+func WriteSARIF(w io.Writer, diagnostics []Diagnostic, version string) error {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type rule struct {
+		ID               string  `json:"id"`
+		ShortDescription message `json:"shortDescription"`
+	}
+	type region struct {
+		StartLine int `json:"startLine"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region region `json:"region"`
+		} `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+
+	rules := []rule{{ID: "syntax", ShortDescription: message{"syntax errors"}}}
+	for _, r := range Rules() {
+		rules = append(rules, rule{ID: r.Name(), ShortDescription: message{r.Description()}})
+	}
+	results := make([]result, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		var loc location
+		loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(d.File)
+		loc.PhysicalLocation.Region.StartLine = max(d.Line, 1)
+		results = append(results, result{
+			RuleID:    d.Rule,
+			Level:     string(d.Severity),
+			Message:   message{d.Message},
+			Locations: []location{loc},
+		})
+	}
+
+	log := map[string]any{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": []any{map[string]any{
+			"tool": map[string]any{
+				"driver": map[string]any{
+					"name":           "knife-lint",
+					"version":        version,
+					"informationUri": "https://github.com/Serein-sz/knife",
+					"rules":          rules,
+				},
+			},
+			"results": results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
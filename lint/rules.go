@@ -0,0 +1,233 @@
+package lint
+
+import (
+	"github.com/Serein-sz/knife/ast"
+)
+
+func init() {
+	Register(unusedVariable{})
+	Register(unusedParameter{})
+	Register(shadowedName{})
+	Register(unreachableCode{})
+	Register(undefinedCall{})
+	Register(wrongArity{})
+	Register(selfComparison{})
+	Register(nullComparison{})
+}
+
+type unusedVariable struct{}
+
+func (unusedVariable) Name() string        { return "unused-variable" }
+func (unusedVariable) Description() string { return "let bindings and imports that are never read" }
+func (unusedVariable) Severity() Severity  { return SeverityWarning }
+
+func (unusedVariable) Check(pass *Pass) {
+	eachBinding(pass.Scopes.Root, func(b *Binding) {
+		if len(b.Uses) > 0 || b.Exported {
+			return
+		}
+		switch b.Kind {
+		case LetBinding:
+			pass.Report(b.Ident, "%s is assigned but never used", b.Name)
+		case ImportBinding:
+			pass.Report(b.Ident, "%s is imported but never used", b.Name)
+		}
+	})
+}
+
+type unusedParameter struct{}
+
+func (unusedParameter) Name() string        { return "unused-parameter" }
+func (unusedParameter) Description() string { return "function parameters that are never read" }
+func (unusedParameter) Severity() Severity  { return SeverityWarning }
+
+func (unusedParameter) Check(pass *Pass) {
+	eachBinding(pass.Scopes.Root, func(b *Binding) {
+		if b.Kind == ParamBinding && len(b.Uses) == 0 {
+			pass.Report(b.Ident, "parameter %s of %s is never used", b.Name, b.Scope.Func.Name.Value)
+		}
+	})
+}
+
+type shadowedName struct{}
+
+func (shadowedName) Name() string { return "shadowed-name" }
+func (shadowedName) Description() string {
+	return "names that hide a binding of an enclosing scope or a builtin"
+}
+func (shadowedName) Severity() Severity { return SeverityWarning }
+
+func (shadowedName) Check(pass *Pass) {
+	eachBinding(pass.Scopes.Root, func(b *Binding) {
+		switch {
+		case b.Shadows != nil:
+			pass.Report(b.Ident, "%s shadows the %s declared on line %d", b.Name, b.Shadows.Kind, b.Shadows.Ident.Line())
+		case b.ShadowsBuiltin:
+			pass.Report(b.Ident, "%s shadows the builtin function %s", b.Name, b.Name)
+		}
+	})
+}
+
+type unreachableCode struct{}
+
+func (unreachableCode) Name() string        { return "unreachable-code" }
+func (unreachableCode) Description() string { return "statements following a return" }
+func (unreachableCode) Severity() Severity  { return SeverityWarning }
+
+func (unreachableCode) Check(pass *Pass) {
+	check := func(statements []ast.Statement) {
+		for i, s := range statements {
+			if _, ok := s.(*ast.ReturnStatement); ok && i+1 < len(statements) {
+				pass.Report(statements[i+1], "unreachable code after return on line %d", s.Line())
+				return
+			}
+		}
+	}
+	check(pass.Program.Statements)
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		if block, ok := node.(*ast.BlockStatement); ok {
+			check(block.Statements)
+		}
+		return true
+	})
+}
+
+type undefinedCall struct{}
+
+func (undefinedCall) Name() string { return "undefined-call" }
+func (undefinedCall) Description() string {
+	return "calls to names that are neither defined nor builtin"
+}
+func (undefinedCall) Severity() Severity { return SeverityError }
+
+func (undefinedCall) Check(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		call, ok := node.(*ast.FunctionCallExpression)
+		if !ok {
+			return true
+		}
+		if id, ok := call.Function.(*ast.Identifier); ok && !pass.Scopes.Defined(id) {
+			pass.Report(call, "call to undefined function %s", id.Value)
+		}
+		return true
+	})
+}
+
+type wrongArity struct{}
+
+func (wrongArity) Name() string { return "wrong-arity" }
+func (wrongArity) Description() string {
+	return "calls to defined functions with the wrong number of arguments"
+}
+func (wrongArity) Severity() Severity { return SeverityError }
+
+func (wrongArity) Check(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		call, ok := node.(*ast.FunctionCallExpression)
+		if !ok {
+			return true
+		}
+		id, ok := call.Function.(*ast.Identifier)
+		if !ok {
+			return true
+		}
+		b := pass.Scopes.Binding(id)
+		if b == nil || b.Kind != FuncBinding {
+			return true
+		}
+		if want, got := len(b.Func.Parameters), len(call.Arguments); want != got {
+			pass.Report(call, "%s expects %d argument(s) but is called with %d", id.Value, want, got)
+		}
+		return true
+	})
+}
+
+type selfComparison struct{}
+
+func (selfComparison) Name() string { return "self-comparison" }
+func (selfComparison) Description() string {
+	return "comparisons whose operands are the same expression"
+}
+func (selfComparison) Severity() Severity { return SeverityWarning }
+
+func (selfComparison) Check(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		infix, ok := node.(*ast.InfixExpression)
+		if !ok || !isComparison(infix.Op) || hasCall(infix) {
+			return true
+		}
+		if infix.Lhs.String() == infix.Rhs.String() {
+			pass.Report(infix, "%s is compared with itself", infix.Lhs)
+		}
+		return true
+	})
+}
+
+type nullComparison struct{}
+
+func (nullComparison) Name() string { return "null-comparison" }
+func (nullComparison) Description() string {
+	return "comparisons with null that can be written more clearly"
+}
+func (nullComparison) Severity() Severity { return SeverityWarning }
+
+func (nullComparison) Check(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		infix, ok := node.(*ast.InfixExpression)
+		if !ok || !isComparison(infix.Op) {
+			return true
+		}
+		_, lhsNull := infix.Lhs.(*ast.Null)
+		_, rhsNull := infix.Rhs.(*ast.Null)
+		switch {
+		case !lhsNull && !rhsNull:
+		case infix.Op != "==" && infix.Op != "!=":
+			pass.Report(infix, "ordering comparison with null fails at runtime, use == null or != null")
+		case lhsNull && rhsNull:
+			pass.Report(infix, "null %s null is constant", infix.Op)
+		case lhsNull:
+			pass.Report(infix, "write %s %s null instead of null %s %s", infix.Rhs, infix.Op, infix.Op, infix.Rhs)
+		}
+		return true
+	})
+}
+
+func (k BindingKind) String() string {
+	switch k {
+	case ParamBinding:
+		return "parameter"
+	case FuncBinding:
+		return "function"
+	case ImportBinding:
+		return "import"
+	}
+	return "variable"
+}
+
+func eachBinding(scope *Scope, fn func(b *Binding)) {
+	for _, b := range scope.Bindings {
+		fn(b)
+	}
+	for _, child := range scope.Children {
+		eachBinding(child, fn)
+	}
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+func hasCall(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FunctionCallExpression); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,183 @@
+package lint
+
+import (
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/eval"
+	"github.com/Serein-sz/knife/stdlib"
+)
+
+type BindingKind int
+
+const (
+	LetBinding BindingKind = iota
+	ParamBinding
+	FuncBinding
+	ImportBinding
+)
+
+// Binding is a name introduced by let, a function parameter, a function
+// definition or an import.
+type Binding struct {
+	Name  string
+	Kind  BindingKind
+	Ident *ast.Identifier
+	// Func is the definition of a FuncBinding.
+	Func  *ast.FunctionDefineStatement
+	Scope *Scope
+	Uses  []*ast.Identifier
+	// Shadows is the binding of an enclosing scope hidden by this one.
+	Shadows *Binding
+	// ShadowsBuiltin is set when the binding hides a builtin function.
+	ShadowsBuiltin bool
+	// Exported is set for a let or func the module exports.
+	Exported bool
+}
+
+// Scope is the program or the body of a function. Blocks do not open a
+// scope of their own, matching the evaluator.
+type Scope struct {
+	Parent *Scope
+	// Func is nil for the program scope.
+	Func     *ast.FunctionDefineStatement
+	Bindings []*Binding
+	Children []*Scope
+
+	current map[string]*Binding
+}
+
+// isBuiltin reports whether name is a builtin or defined by the prelude.
+func isBuiltin(name string) bool {
+	return eval.IsBuiltin(name) || stdlib.Defines(name)
+}
+
+func (s *Scope) lookup(name string) *Binding {
+	for ; s != nil; s = s.Parent {
+		if b, ok := s.current[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// Scopes is the result of resolving every identifier of a program.
+type Scopes struct {
+	Root     *Scope
+	resolved map[*ast.Identifier]*Binding
+	builtin  map[*ast.Identifier]bool
+}
+
+// Binding returns the binding an identifier refers to, or nil when it
+// refers to a builtin or to nothing at all.
+func (s *Scopes) Binding(id *ast.Identifier) *Binding {
+	return s.resolved[id]
+}
+
+// Defined reports whether id refers to a binding or to a builtin.
+func (s *Scopes) Defined(id *ast.Identifier) bool {
+	return s.resolved[id] != nil || s.builtin[id]
+}
+
+// analyze resolves the identifiers of program. Statements of a scope are
+// visited in order, so a name used before its let is undefined; function
+// bodies are visited once their enclosing scope is complete, since they
+// only run when called.
+func analyze(program *ast.Program) *Scopes {
+	s := &Scopes{
+		Root:     &Scope{current: map[string]*Binding{}},
+		resolved: map[*ast.Identifier]*Binding{},
+		builtin:  map[*ast.Identifier]bool{},
+	}
+	s.scope(s.Root, program.Statements)
+	return s
+}
+
+func (s *Scopes) scope(scope *Scope, statements []ast.Statement) {
+	var functions []*ast.FunctionDefineStatement
+	s.statements(scope, statements, &functions)
+	for _, f := range functions {
+		inner := &Scope{Parent: scope, Func: f, current: map[string]*Binding{}}
+		scope.Children = append(scope.Children, inner)
+		for _, param := range f.Parameters {
+			s.declare(inner, param, ParamBinding, nil)
+		}
+		if f.Body != nil {
+			s.scope(inner, f.Body.Statements)
+		}
+	}
+}
+
+// statements resolves statements in order and collects the functions they
+// define, whose bodies are resolved later.
+func (s *Scopes) statements(scope *Scope, statements []ast.Statement, functions *[]*ast.FunctionDefineStatement) {
+	for _, statement := range statements {
+		switch st := statement.(type) {
+		case *ast.LetStatement:
+			s.expression(scope, st.Value, functions)
+			if b := s.declare(scope, st.Name, LetBinding, nil); b != nil {
+				b.Exported = st.Exported
+			}
+		case *ast.FunctionDefineStatement:
+			if b := s.declare(scope, st.Name, FuncBinding, st); b != nil {
+				b.Exported = st.Exported
+			}
+			*functions = append(*functions, st)
+		case *ast.ImportStatement:
+			s.declare(scope, st.Alias, ImportBinding, nil)
+			for _, name := range st.Names {
+				s.declare(scope, name, ImportBinding, nil)
+			}
+		case *ast.ReturnStatement:
+			s.expression(scope, st.Value, functions)
+		case *ast.ExpressionStatement:
+			s.expression(scope, st.Expression, functions)
+		case *ast.BlockStatement:
+			s.statements(scope, st.Statements, functions)
+		}
+	}
+}
+
+func (s *Scopes) declare(scope *Scope, id *ast.Identifier, kind BindingKind, f *ast.FunctionDefineStatement) *Binding {
+	if id == nil {
+		return nil
+	}
+	b := &Binding{Name: id.Value, Kind: kind, Ident: id, Func: f, Scope: scope}
+	if _, redeclared := scope.current[id.Value]; !redeclared {
+		b.Shadows = scope.Parent.lookup(id.Value)
+		b.ShadowsBuiltin = b.Shadows == nil && isBuiltin(id.Value)
+	}
+	scope.Bindings = append(scope.Bindings, b)
+	scope.current[id.Value] = b
+	return b
+}
+
+func (s *Scopes) expression(scope *Scope, expression ast.Expression, functions *[]*ast.FunctionDefineStatement) {
+	switch e := expression.(type) {
+	case *ast.Identifier:
+		if b := scope.lookup(e.Value); b != nil {
+			b.Uses = append(b.Uses, e)
+			s.resolved[e] = b
+		} else if isBuiltin(e.Value) {
+			s.builtin[e] = true
+		}
+	case *ast.PrefixExpression:
+		s.expression(scope, e.Rhs, functions)
+	case *ast.InfixExpression:
+		s.expression(scope, e.Lhs, functions)
+		s.expression(scope, e.Rhs, functions)
+	case *ast.FunctionCallExpression:
+		s.expression(scope, e.Function, functions)
+		for _, a := range e.Arguments {
+			s.expression(scope, a, functions)
+		}
+	case *ast.MemberExpression:
+		s.expression(scope, e.Object, functions)
+	case *ast.IfExpression:
+		s.expression(scope, e.Condition, functions)
+		if e.Consequence != nil {
+			s.statements(scope, e.Consequence.Statements, functions)
+		}
+		if e.Alternative != nil {
+			s.statements(scope, e.Alternative.Statements, functions)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package lint
+
+import (
+	"strings"
+
+	"github.com/Serein-sz/knife/ast"
+)
+
+const directive = "knife-lint:"
+
+// suppressions holds the rules silenced by comments such as
+//
+//	let x = 1 // knife-lint: disable-line unused-variable
+//	// knife-lint: disable-next-line
+//	// knife-lint: disable-file shadowed-name, self-comparison
+//
+// An empty rule list silences every rule.
+type suppressions struct {
+	file  map[string]bool
+	lines map[int]map[string]bool
+}
+
+func parseSuppressions(comments []*ast.Comment) suppressions {
+	s := suppressions{file: map[string]bool{}, lines: map[int]map[string]bool{}}
+	for _, c := range comments {
+		text, ok := strings.CutPrefix(strings.TrimSpace(c.Text()), directive)
+		if !ok {
+			continue
+		}
+		kind, list, _ := strings.Cut(strings.TrimSpace(text), " ")
+		rules := map[string]bool{}
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				rules[name] = true
+			}
+		}
+		if len(rules) == 0 {
+			rules["*"] = true
+		}
+		switch kind {
+		case "disable-line":
+			s.add(c.Line(), rules)
+		case "disable-next-line":
+			s.add(c.Line()+1, rules)
+		case "disable-file":
+			for name := range rules {
+				s.file[name] = true
+			}
+		}
+	}
+	return s
+}
+
+func (s suppressions) add(line int, rules map[string]bool) {
+	if s.lines[line] == nil {
+		s.lines[line] = map[string]bool{}
+	}
+	for name := range rules {
+		s.lines[line][name] = true
+	}
+}
+
+func (s suppressions) suppressed(rule string, line int) bool {
+	return s.file["*"] || s.file[rule] || s.lines[line]["*"] || s.lines[line][rule]
+}
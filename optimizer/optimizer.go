@@ -0,0 +1,183 @@
+// Package optimizer simplifies a program before it runs: operations on
+// literals are folded with the semantics of the evaluator, branches whose
+// condition is a literal are replaced by the branch taken, and statements
+// that can never run or whose value is unused are removed. Operations that
+// fail, such as a division by zero, are kept so the error is still raised
+// at run time. Printing a function shows its optimized body.
+//
+// It keeps identifier bindings intact, so it may run before or after the
+// resolver; blocks of an if share the scope around them, which makes
+// splicing the branch taken into its parent safe.
+package optimizer
+
+import (
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/eval"
+	"github.com/Serein-sz/knife/token"
+)
+
+// Optimize rewrites program in place and returns it.
+func Optimize(program *ast.Program) *ast.Program {
+	ast.Rewrite(program, optimize)
+	return program
+}
+
+func optimize(node ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.Program:
+		n.Statements = statements(n.Statements)
+	case *ast.BlockStatement:
+		n.Statements = statements(n.Statements)
+	case *ast.PrefixExpression:
+		if rhs, ok := constant(n.Rhs); ok {
+			if res, err := eval.Prefix(n.Op, rhs); err == nil {
+				return literal(n.Token, res)
+			}
+		}
+	case *ast.InfixExpression:
+		lhs, ok := constant(n.Lhs)
+		rhs, ok2 := constant(n.Rhs)
+		if ok && ok2 {
+			if res, err := eval.Infix(n.Op, lhs, rhs); err == nil {
+				return literal(literalToken(n.Lhs), res)
+			}
+		}
+	case *ast.IfExpression:
+		// As an expression, an if folds only when the branch taken is a
+		// single expression; statement-level ifs are spliced by statements.
+		block, ok := branch(n)
+		if !ok {
+			break
+		}
+		if block == nil || len(block.Statements) == 0 {
+			return null(n.Token)
+		}
+		if s, ok := block.Statements[0].(*ast.ExpressionStatement); ok && len(block.Statements) == 1 {
+			return s.Expression
+		}
+	}
+	return node
+}
+
+// statements splices the branch taken by ifs with a literal condition,
+// drops what follows a return and literals whose value is discarded. The
+// last statement is kept when its value may be the value of the block.
+func statements(list []ast.Statement) []ast.Statement {
+	out := make([]ast.Statement, 0, len(list))
+	for i, s := range list {
+		last := i == len(list)-1
+		if es, ok := s.(*ast.ExpressionStatement); ok {
+			if ifx, ok := es.Expression.(*ast.IfExpression); ok {
+				if block, ok := branch(ifx); ok {
+					var inner []ast.Statement
+					if block != nil {
+						inner = block.Statements
+					}
+					if len(inner) == 0 && last {
+						inner = []ast.Statement{nullStatement(es)}
+					}
+					out = append(out, inner...)
+					if returns(inner) {
+						break
+					}
+					continue
+				}
+			}
+			if _, ok := constant(es.Expression); ok && !last {
+				continue
+			}
+		}
+		out = append(out, s)
+		if _, ok := s.(*ast.ReturnStatement); ok {
+			break
+		}
+	}
+	return out
+}
+
+// branch returns the block an if with a literal condition runs, nil when it
+// runs none, and false when the condition is not a literal.
+func branch(n *ast.IfExpression) (*ast.BlockStatement, bool) {
+	cond, ok := constant(n.Condition)
+	if !ok {
+		return nil, false
+	}
+	if eval.Truthy(cond) {
+		return n.Consequence, true
+	}
+	return n.Alternative, true
+}
+
+func returns(list []ast.Statement) bool {
+	if len(list) == 0 {
+		return false
+	}
+	_, ok := list[len(list)-1].(*ast.ReturnStatement)
+	return ok
+}
+
+func nullStatement(s *ast.ExpressionStatement) *ast.ExpressionStatement {
+	n := null(s.Token)
+	return &ast.ExpressionStatement{Token: n.Token, Expression: n}
+}
+
+func null(tok token.Token) *ast.Null {
+	return &ast.Null{
+		Token: token.Token{Line: tok.Line, Column: tok.Column, Type: token.NULL, Literal: "null"},
+		Value: "null",
+	}
+}
+
+// constant returns the value of a literal expression.
+func constant(e ast.Expression) (environment.Object, bool) {
+	switch e := e.(type) {
+	case *ast.NumberLiteral:
+		return &environment.Number{Value: e.Value}, true
+	case *ast.StringLiteral:
+		return &environment.String{Value: e.Value}, true
+	case *ast.Boolean:
+		if e.Value {
+			return eval.TRUE, true
+		}
+		return eval.FALSE, true
+	case *ast.Null:
+		return eval.NULL, true
+	}
+	return nil, false
+}
+
+// literalToken returns the token of a literal expression.
+func literalToken(e ast.Expression) token.Token {
+	switch e := e.(type) {
+	case *ast.NumberLiteral:
+		return e.Token
+	case *ast.StringLiteral:
+		return e.Token
+	case *ast.Boolean:
+		return e.Token
+	case *ast.Null:
+		return e.Token
+	}
+	return token.Token{}
+}
+
+// literal returns the literal for obj, positioned at tok.
+func literal(tok token.Token, obj environment.Object) ast.Expression {
+	at := token.Token{Line: tok.Line, Column: tok.Column}
+	switch o := obj.(type) {
+	case *environment.Number:
+		at.Type, at.Literal = token.NUMBER, o.Value
+		return &ast.NumberLiteral{Token: at, Value: o.Value}
+	case *environment.String:
+		at.Type, at.Literal = token.STRING, o.Value
+		return &ast.StringLiteral{Token: at, Value: o.Value}
+	case *environment.Boolean:
+		at.Type, at.Literal = token.FALSE, "false"
+		if o.Value {
+			at.Type, at.Literal = token.TRUE, "true"
+		}
+		return &ast.Boolean{Token: at, Value: o.Value}
+	}
+	return null(tok)
+}
@@ -0,0 +1,143 @@
+package optimizer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/eval"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+)
+
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		t.Fatalf("%q: %v", src, err)
+	}
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"print(1 + 2 * 3)", "print(7)"},
+		{"print(1.5 * 2, 7 / 2, -(1 - 3))", "print(3, 3, 2)"},
+		{`print("a" + "b" + "c")`, `print("abc")`},
+		{"print(!true, 1 < 2, null == null, \"a\" != \"a\")", "print(false, true, true, false)"},
+		{"print(x + 1 * 2)", "print(x + 2)"},
+		// errors are left for the runtime to report
+		{"print(1 / 0, \"a\" - 1)", "print(1 / 0, \"a\" - 1)"},
+		{"if (false) { print(1) }\nprint(2)", "print(2)"},
+		{"if (1 > 2) { print(1) } else { let a = 3\nprint(a) }", "let a = 3\nprint(a)"},
+		{"let a = if (true) { 1 } else { 2 }", "let a = 1"},
+		{"let a = if (null) { 1 }", "let a = null"},
+		{"func f() {\n return 1\n print(2)\n}", "func f() { return 1 }"},
+		{"func f() {\n if (true) { return 1 }\n print(2)\n}", "func f() { return 1 }"},
+		{"func f() {\n 1\n 2\n}", "func f() { 2 }"},
+		{"func f() {\n print(1)\n if (false) { 2 }\n}", "func f() { print(1); null }"},
+	}
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.src))
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.src, tt.expected, got)
+		}
+	}
+}
+
+// run evaluates src, optimized or not, and returns what it prints, its
+// value and its error.
+func run(t *testing.T, src string, optimize bool) string {
+	t.Helper()
+	program := parse(t, src)
+	if optimize {
+		Optimize(program)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	res, err := eval.Eval(context.Background(), program, environment.NewEnvironment(nil))
+	os.Stdout = stdout
+	w.Close()
+	printed := <-out
+	value := "<nil>"
+	switch res.(type) {
+	case nil:
+	case *environment.FunctionDefine:
+		// its body is printed optimized
+		value = "func"
+	default:
+		value = res.Inspect()
+	}
+	return fmt.Sprintf("output: %q, value: %s, failed: %v", printed, value, err != nil)
+}
+
+func TestDifferentialCorpus(t *testing.T) {
+	err := filepath.Walk("../example", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".k") {
+			return err
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if p := parser.New(lexer.New(string(src))); p.ParseProgram() != nil && p.Error() != nil {
+			return nil
+		}
+		if plain, optimized := run(t, string(src), false), run(t, string(src), true); plain != optimized {
+			t.Errorf("%s:\nplain:     %s\noptimized: %s", path, plain, optimized)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDifferentialRandom compares random expressions over literals, in and
+// out of functions, with and without optimization.
+func TestDifferentialRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	operands := []string{"0", "1", "2", "-3", "0.5", "2.25", `"a"`, `""`, "true", "false", "null", "x"}
+	ops := []string{"+", "-", "*", "/", "==", "!=", "<", "<=", ">", ">="}
+	var expr func(depth int) string
+	expr = func(depth int) string {
+		if depth == 0 {
+			return operands[r.Intn(len(operands))]
+		}
+		switch r.Intn(5) {
+		case 0:
+			return []string{"!", "-"}[r.Intn(2)] + "(" + expr(depth-1) + ")"
+		case 1:
+			return "if (" + expr(depth-1) + ") { " + expr(depth-1) + " } else { " + expr(depth-1) + " }"
+		default:
+			return "(" + expr(depth-1) + " " + ops[r.Intn(len(ops))] + " " + expr(depth-1) + ")"
+		}
+	}
+	for i := 0; i < 500; i++ {
+		e := expr(r.Intn(4))
+		src := fmt.Sprintf("let x = %d\nfunc f() {\n if (%s) { return %s }\n %s\n}\nprint(f())\n%s", r.Intn(3), expr(1), e, expr(2), e)
+		if plain, optimized := run(t, src, false), run(t, src, true); plain != optimized {
+			t.Fatalf("%s\nplain:     %s\noptimized: %s", src, plain, optimized)
+		}
+	}
+}
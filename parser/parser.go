@@ -27,13 +27,16 @@ var precedences = map[token.TokenType]int{
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESS_GREATER,
+	token.LE:       LESS_GREATER,
 	token.GT:       LESS_GREATER,
+	token.GE:       LESS_GREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.ASTERISK: PRODUCT,
 	token.SLASH:    PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
 type (
@@ -58,8 +61,13 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixHandlerFuncMap[token.IDENT] = p.parseIdentifier
 	p.prefixHandlerFuncMap[token.NULL] = p.parseNull
 	p.prefixHandlerFuncMap[token.BANG] = p.parsePrefixExpression
+	p.prefixHandlerFuncMap[token.MINUS] = p.parsePrefixExpression
+	p.prefixHandlerFuncMap[token.TRUE] = p.parseBoolean
+	p.prefixHandlerFuncMap[token.FALSE] = p.parseBoolean
+	p.prefixHandlerFuncMap[token.IF] = p.parseIfExpression
 	p.prefixHandlerFuncMap[token.NUMBER] = p.parseNumberLiteral
 	p.prefixHandlerFuncMap[token.STRING] = p.parseStringLiteral
+	p.prefixHandlerFuncMap[token.LPAREN] = p.parseGroupedExpression
 	p.infixHandlerFuncMap[token.PLUS] = p.parseInfixExpression
 	p.infixHandlerFuncMap[token.MINUS] = p.parseInfixExpression
 	p.infixHandlerFuncMap[token.ASTERISK] = p.parseInfixExpression
@@ -71,6 +79,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.infixHandlerFuncMap[token.LE] = p.parseInfixExpression
 	p.infixHandlerFuncMap[token.GT] = p.parseInfixExpression
 	p.infixHandlerFuncMap[token.GE] = p.parseInfixExpression
+	p.infixHandlerFuncMap[token.DOT] = p.parseMemberExpression
 
 	p.nextToken()
 	p.nextToken()
@@ -89,6 +98,11 @@ func (p *Parser) Error() error {
 	return fmt.Errorf("parser error: %v", s)
 }
 
+// Errors returns each parse error message, in the order they were found.
+func (p *Parser) Errors() []string {
+	return p.errors
+}
+
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
@@ -97,13 +111,16 @@ func (p *Parser) nextToken() {
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
-	for p.peekToken.Type != token.EOF {
+	for !p.curTokenTypeIs(token.EOF) {
 		statement := p.parseStatement()
 		if statement != nil {
 			program.Statements = append(program.Statements, statement)
 		}
 		p.nextToken()
 	}
+	for _, c := range p.l.Comments() {
+		program.Comments = append(program.Comments, &ast.Comment{Token: c})
+	}
 	return program
 }
 
@@ -115,6 +132,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseFunctionDefineStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -157,6 +178,9 @@ func (p *Parser) parseFunctionDefineParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{p.parseIdentifier().(*ast.Identifier)}
 	for p.peekTokenTypeIs(token.COMMA) {
 		p.nextToken()
+		if p.peekTokenTypeIs(token.RPAREN) { // trailing comma
+			break
+		}
 		p.nextToken()
 		identifiers = append(identifiers, p.parseIdentifier().(*ast.Identifier))
 	}
@@ -170,12 +194,17 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	blockStatement := &ast.BlockStatement{Token: p.curToken}
 	p.nextToken()
 	for !p.curTokenTypeIs(token.RBRACE) && !p.curTokenTypeIs(token.EOF) {
+		if p.curTokenTypeIs(token.IMPORT) || p.curTokenTypeIs(token.EXPORT) {
+			msg := fmt.Sprintf("line: %d, error: %s is only allowed at the top level", p.curToken.Line, p.curToken.Literal)
+			p.errors = append(p.errors, msg)
+		}
 		statement := p.parseStatement()
 		if statement != nil {
 			blockStatement.Statements = append(blockStatement.Statements, statement)
 		}
 		p.nextToken()
 	}
+	blockStatement.RBrace = p.curToken
 	return blockStatement
 }
 
@@ -189,12 +218,91 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return returnStatement
 }
 
+// parseImportStatement parses `import "path" [as name]` and
+// `import { name, ... } from "path"`; as and from are not reserved.
+func (p *Parser) parseImportStatement() ast.Statement {
+	importStatement := &ast.ImportStatement{Token: p.curToken}
+	if p.peekTokenTypeIs(token.LBRACE) {
+		p.nextToken()
+		importStatement.Names = []*ast.Identifier{}
+		for !p.peekTokenTypeIs(token.RBRACE) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			importStatement.Names = append(importStatement.Names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+			if !p.peekTokenTypeIs(token.COMMA) {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+		if len(importStatement.Names) == 0 {
+			p.errors = append(p.errors, fmt.Sprintf("line: %d, error: expected names to import", p.curToken.Line))
+			return nil
+		}
+		if !p.expectWord("from") {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	importStatement.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	if importStatement.Names == nil && p.peekTokenTypeIs(token.IDENT) && p.peekToken.Literal == "as" {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		importStatement.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+	if p.peekTokenTypeIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return importStatement
+}
+
+// parseExportStatement parses a let or func marked with export.
+func (p *Parser) parseExportStatement() ast.Statement {
+	switch p.peekToken.Type {
+	case token.LET:
+		p.nextToken()
+		letStatement := p.parseLetStatement()
+		if letStatement == nil {
+			return nil
+		}
+		letStatement.Exported = true
+		return letStatement
+	case token.FUNCTION:
+		p.nextToken()
+		statement := p.parseFunctionDefineStatement()
+		if statement == nil {
+			return nil
+		}
+		statement.(*ast.FunctionDefineStatement).Exported = true
+		return statement
+	}
+	p.errors = append(p.errors, fmt.Sprintf("line: %d, error: expected let or func after export, but got %s", p.curToken.Line, p.peekToken.Type))
+	return nil
+}
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	memberExpression := &ast.MemberExpression{Token: p.curToken, Object: object}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	memberExpression.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return memberExpression
+}
+
 func (p *Parser) parseFunctionCallExpression(lhs ast.Expression) ast.Expression {
 	functionCallExpression := &ast.FunctionCallExpression{
 		Token:    p.curToken,
 		Function: lhs,
 	}
 	functionCallExpression.Arguments = p.parseExpressionList(token.RPAREN)
+	functionCallExpression.RParen = p.curToken
 	return functionCallExpression
 }
 
@@ -208,22 +316,26 @@ func (p *Parser) parseExpressionList(close token.TokenType) []ast.Expression {
 	expressions := []ast.Expression{expression}
 	for p.peekTokenTypeIs(token.COMMA) {
 		p.nextToken()
+		if p.peekTokenTypeIs(close) { // trailing comma
+			break
+		}
 		p.nextToken()
 		expressions = append(expressions, p.parseExpression(LOWEST))
 	}
 	if !p.expectPeek(close) {
 		return nil
 	}
-	if p.peekTokenTypeIs(token.SEMICOLON) {
-		p.nextToken()
-	}
 	return expressions
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	expressionStatement := &ast.ExpressionStatement{
-		Token:      p.curToken,
-		Expression: p.parseExpression(LOWEST),
+	expressionStatement := &ast.ExpressionStatement{Token: p.curToken}
+	if p.curTokenTypeIs(token.IF) {
+		// An if statement ends with its last block, so a next line starting
+		// with an operator, such as -x, is a statement of its own.
+		expressionStatement.Expression = p.parseIfExpression()
+	} else {
+		expressionStatement.Expression = p.parseExpression(LOWEST)
 	}
 	if p.peekTokenTypeIs(token.SEMICOLON) {
 		p.nextToken()
@@ -242,6 +354,9 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 	p.nextToken()
 	letStatement.Value = p.parseExpression(LOWEST)
+	if p.peekTokenTypeIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 	return letStatement
 }
 
@@ -253,7 +368,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		return nil
 	}
 	lhs := prefixHandler()
-	if !p.peekTokenTypeIs(token.SEMICOLON) && precedence <= p.peekPrecedence() {
+	for !p.peekTokenTypeIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infixHandler, ok := p.infixHandlerFuncMap[p.peekToken.Type]
 		if !ok {
 			return lhs
@@ -291,6 +406,51 @@ func (p *Parser) parseInfixExpression(lhs ast.Expression) ast.Expression {
 	return infixExpression
 }
 
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.nextToken()
+	expression := p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.curToken, Value: p.curTokenTypeIs(token.TRUE)}
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+	ifExpression := &ast.IfExpression{Token: p.curToken}
+	p.nextToken()
+	ifExpression.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	ifExpression.Consequence = p.parseBlockStatement()
+	if !p.peekTokenTypeIs(token.ELSE) {
+		return ifExpression
+	}
+	p.nextToken()
+	if p.peekTokenTypeIs(token.IF) {
+		// else if: a block holding the nested if
+		p.nextToken()
+		block := &ast.BlockStatement{Token: p.curToken}
+		nested := p.parseIfExpression()
+		if nested == nil {
+			return nil
+		}
+		block.Statements = []ast.Statement{&ast.ExpressionStatement{Token: block.Token, Expression: nested}}
+		block.RBrace = p.curToken
+		ifExpression.Alternative = block
+		return ifExpression
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	ifExpression.Alternative = p.parseBlockStatement()
+	return ifExpression
+}
+
 func (p *Parser) parseNumberLiteral() ast.Expression {
 	return &ast.NumberLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -311,6 +471,15 @@ func (p *Parser) parseNull() ast.Expression {
 	return &ast.Null{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// Precedence returns the binding power of an infix operator, so tools that
+// print expressions can tell where parentheses are required.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 func (p *Parser) curPrecedence() int {
 	if p, ok := precedences[p.curToken.Type]; ok {
 		return p
@@ -343,6 +512,16 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
+// expectWord is expectPeek for a contextual keyword, lexed as an identifier.
+func (p *Parser) expectWord(word string) bool {
+	if p.peekTokenTypeIs(token.IDENT) && p.peekToken.Literal == word {
+		p.nextToken()
+		return true
+	}
+	p.errors = append(p.errors, fmt.Sprintf("line: %d, error: expected next token to be %s, but got %s", p.curToken.Line, word, p.peekToken.Type))
+	return false
+}
+
 func (p *Parser) peekError(t token.TokenType) {
 	p.errors = append(p.errors, fmt.Sprintf("line: %d, error: expected next token to be %s, but got %s", p.curToken.Line, t, p.peekToken.Type))
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/Serein-sz/knife/ast"
 	"github.com/Serein-sz/knife/lexer"
 )
 
@@ -34,3 +35,127 @@ func ReadFile(filename string) (string, error) {
 	// 确保使用UTF-8编码和LF换行符
 	return string(content), nil
 }
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "1 + (2 * 3)"},
+		{"1 * 2 + 3", "(1 * 2) + 3"},
+		{"(1 + 2) * 3", "(1 + 2) * 3"},
+		{"1 - 2 - 3", "(1 - 2) - 3"},
+		{"1 + 1 == 2", "(1 + 1) == 2"},
+		{"a <= b", "a <= b"},
+		{"f(1) + g(2)", "f(1) + g(2)"},
+	}
+	for i, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if err := p.Error(); err != nil {
+			t.Fatalf("tests[%d] - parse error: %v", i, err)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("tests[%d] - expected 1 statement, got %d", i, len(program.Statements))
+		}
+		got := parenthesize(program.Statements[0].(*ast.ExpressionStatement).Expression)
+		if got != tt.expected {
+			t.Fatalf("tests[%d] - expected=%q, got=%q", i, tt.expected, got)
+		}
+	}
+}
+
+// parenthesize prints nested infix expressions in parentheses so the shape
+// of the tree is visible.
+func parenthesize(e ast.Expression) string {
+	infix, ok := e.(*ast.InfixExpression)
+	if !ok {
+		return e.String()
+	}
+	lhs, rhs := parenthesize(infix.Lhs), parenthesize(infix.Rhs)
+	if _, ok := infix.Lhs.(*ast.InfixExpression); ok {
+		lhs = "(" + lhs + ")"
+	}
+	if _, ok := infix.Rhs.(*ast.InfixExpression); ok {
+		rhs = "(" + rhs + ")"
+	}
+	return lhs + " " + infix.Op + " " + rhs
+}
+
+func TestSemicolons(t *testing.T) {
+	p := New(lexer.New("let a = f(1);\nprint(a);\nreturn a;\n"))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(program.Statements))
+	}
+	call := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionCallExpression)
+	if call.RParen.Literal != ")" || call.RParen.Column != 12 {
+		t.Fatalf("unexpected closing parenthesis %+v", call.RParen)
+	}
+}
+
+func TestIfStatementEndsAtBlock(t *testing.T) {
+	p := New(lexer.New("if (a) { 1 }\n-x\nlet y = if (a) { 1 } else { 2 } + 3"))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"if (a) { 1 }", "-x", "let y = if (a) { 1 } else { 2 } + 3"}
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("expected %d statements, got %d", len(expected), len(program.Statements))
+	}
+	for i, s := range program.Statements {
+		if s.String() != expected[i] {
+			t.Errorf("statements[%d] - expected=%q, got=%q", i, expected[i], s.String())
+		}
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	src := "import \"./lib/math.k\" as m\nimport { add, sub, } from \"lib/math\";\nimport \"./setup.k\"\n" +
+		"export let from = m.ten\nexport func f(as) {\n return m.add(as, 1).x\n}\n"
+	p := New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`import "./lib/math.k" as m`,
+		`import { add, sub } from "lib/math"`,
+		`import "./setup.k"`,
+		"export let from = m.ten",
+		"export func f(as) { return m.add(as, 1).x }",
+	}
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("expected %d statements, got %d", len(expected), len(program.Statements))
+	}
+	for i, s := range program.Statements {
+		if s.String() != expected[i] {
+			t.Errorf("statements[%d] - expected=%q, got=%q", i, expected[i], s.String())
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"func f() {\n import \"./a.k\"\n}", "line: 2, error: import is only allowed at the top level"},
+		{"if (a) {\n export let b = 1\n}", "line: 2, error: export is only allowed at the top level"},
+		{"export print(1)", "line: 1, error: expected let or func after export, but got IDENT"},
+		{"import { a } \"./a.k\"", "line: 1, error: expected next token to be from, but got STRING"},
+		{"import {} from \"./a.k\"", "line: 1, error: expected names to import"},
+		{"import a", "line: 1, error: expected next token to be STRING, but got IDENT"},
+	}
+	for i, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("tests[%d] - expected %q, got %q", i, tt.expected, p.Errors())
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package printer
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Doc is a document in the style of Wadler's "prettier printer": text glued
+// together with line breaks that a Group renders either all flat, on one
+// line, or all broken, depending on whether the flat layout fits.
+type Doc interface {
+	isDoc()
+}
+
+type text string
+
+type line struct {
+	// flat is printed instead of the line break when the enclosing group
+	// fits on one line.
+	flat string
+	hard bool
+}
+
+type concat []Doc
+
+type nest struct {
+	indent int
+	doc    Doc
+}
+
+type group struct {
+	doc Doc
+}
+
+type ifBreak struct {
+	broken Doc
+	flat   Doc
+}
+
+func (text) isDoc()    {}
+func (line) isDoc()    {}
+func (concat) isDoc()  {}
+func (nest) isDoc()    {}
+func (group) isDoc()   {}
+func (ifBreak) isDoc() {}
+
+func Text(s string) Doc {
+	return text(s)
+}
+
+// Line is a space in flat mode and a newline otherwise.
+func Line() Doc {
+	return line{flat: " "}
+}
+
+// SoftLine disappears in flat mode and is a newline otherwise.
+func SoftLine() Doc {
+	return line{}
+}
+
+// HardLine always breaks, and forces every enclosing group to break.
+func HardLine() Doc {
+	return line{hard: true}
+}
+
+func Concat(docs ...Doc) Doc {
+	return concat(docs)
+}
+
+// Nest indents every line break inside doc by indent more columns.
+func Nest(indent int, doc Doc) Doc {
+	return nest{indent: indent, doc: doc}
+}
+
+func Group(doc Doc) Doc {
+	return group{doc: doc}
+}
+
+// IfBreak renders broken when the enclosing group is broken, flat otherwise.
+func IfBreak(broken, flat Doc) Doc {
+	return ifBreak{broken: broken, flat: flat}
+}
+
+// Join places sep between each of docs.
+func Join(sep Doc, docs []Doc) Doc {
+	out := make(concat, 0, 2*len(docs))
+	for i, d := range docs {
+		if i > 0 {
+			out = append(out, sep)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+type command struct {
+	indent int
+	flat   bool
+	doc    Doc
+}
+
+// Render lays doc out, breaking groups that do not fit within width columns.
+func Render(doc Doc, width int) string {
+	var out strings.Builder
+	col := 0
+	pendingIndent := 0
+	stack := []command{{doc: doc}}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.doc.(type) {
+		case nil:
+		case text:
+			if d == "" {
+				continue
+			}
+			if pendingIndent > 0 {
+				out.WriteString(strings.Repeat(" ", pendingIndent))
+				col += pendingIndent
+				pendingIndent = 0
+			}
+			out.WriteString(string(d))
+			col += utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{c.indent, c.flat, d[i]})
+			}
+		case nest:
+			stack = append(stack, command{c.indent + d.indent, c.flat, d.doc})
+		case group:
+			flat := c.flat || fits(width-col-pendingIndent, command{c.indent, true, d.doc}, stack)
+			stack = append(stack, command{c.indent, flat, d.doc})
+		case ifBreak:
+			if c.flat {
+				stack = append(stack, command{c.indent, c.flat, d.flat})
+			} else {
+				stack = append(stack, command{c.indent, c.flat, d.broken})
+			}
+		case line:
+			if c.flat && !d.hard {
+				stack = append(stack, command{c.indent, c.flat, text(d.flat)})
+				continue
+			}
+			out.WriteString("\n")
+			col = 0
+			pendingIndent = c.indent
+		}
+	}
+	return out.String()
+}
+
+// fits reports whether next, followed by the rest of the document up to
+// its first line break, fits in width columns.
+func fits(width int, next command, rest []command) bool {
+	stack := []command{next}
+	restIndex := len(rest) - 1
+	for width >= 0 {
+		if len(stack) == 0 {
+			if restIndex < 0 {
+				return true
+			}
+			stack = append(stack, rest[restIndex])
+			restIndex--
+			continue
+		}
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.doc.(type) {
+		case text:
+			width -= utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{c.indent, c.flat, d[i]})
+			}
+		case nest:
+			stack = append(stack, command{c.indent + d.indent, c.flat, d.doc})
+		case group:
+			stack = append(stack, command{c.indent, c.flat, d.doc})
+		case ifBreak:
+			if c.flat {
+				stack = append(stack, command{c.indent, c.flat, d.flat})
+			} else {
+				stack = append(stack, command{c.indent, c.flat, d.broken})
+			}
+		case line:
+			if !c.flat {
+				return true
+			}
+			if d.hard {
+				return false
+			}
+			width -= len(d.flat)
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package printer
+
+import (
+	"strings"
+
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+)
+
+const (
+	directiveOff = "knife-fmt: off"
+	directiveOn  = "knife-fmt: on"
+)
+
+// Format parses and prints src. Lines from a "// knife-fmt: off" comment up
+// to the matching "// knife-fmt: on" comment are copied verbatim; the code
+// around such a region has to be made of complete statements.
+func Format(src string, cfg Config) (string, error) {
+	var out strings.Builder
+	for _, r := range splitRegions(src) {
+		if r.verbatim {
+			out.WriteString(r.src)
+			continue
+		}
+		if strings.TrimSpace(r.src) == "" {
+			continue
+		}
+		// keep line numbers in errors relative to the whole file
+		p := parser.New(lexer.New(strings.Repeat("\n", r.line-1) + r.src))
+		program := p.ParseProgram()
+		if err := p.Error(); err != nil {
+			return "", err
+		}
+		out.WriteString(Print(program, cfg))
+	}
+	return out.String(), nil
+}
+
+type region struct {
+	src      string
+	line     int
+	verbatim bool
+}
+
+func splitRegions(src string) []region {
+	var regions []region
+	var cur strings.Builder
+	start, verbatim := 1, false
+	lines := strings.SplitAfter(src, "\n")
+	for i, line := range lines {
+		directive := isDirective(line, directiveOff)
+		if !verbatim && directive || verbatim && isDirective(line, directiveOn) {
+			if !verbatim {
+				regions = append(regions, region{src: cur.String(), line: start})
+				cur.Reset()
+				start = i + 1
+			}
+			cur.WriteString(line)
+			if verbatim {
+				regions = append(regions, region{src: ensureNewline(cur.String()), line: start, verbatim: true})
+				cur.Reset()
+				start = i + 2
+			}
+			verbatim = !verbatim
+			continue
+		}
+		cur.WriteString(line)
+	}
+	regions = append(regions, region{src: cur.String(), line: start, verbatim: verbatim})
+	if verbatim {
+		regions[len(regions)-1].src = ensureNewline(regions[len(regions)-1].src)
+	}
+	return regions
+}
+
+func isDirective(line, directive string) bool {
+	text, ok := strings.CutPrefix(strings.TrimSpace(line), "//")
+	return ok && strings.TrimSpace(text) == directive
+}
+
+func ensureNewline(s string) string {
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		return s + "\n"
+	}
+	return s
+}
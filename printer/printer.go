@@ -0,0 +1,345 @@
+package printer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/parser"
+	"github.com/Serein-sz/knife/token"
+)
+
+type SemicolonPolicy string
+
+const (
+	SemicolonsNever  SemicolonPolicy = "never"
+	SemicolonsAlways SemicolonPolicy = "always"
+)
+
+type QuoteStyle string
+
+const (
+	QuoteDouble QuoteStyle = "double"
+	QuoteSingle QuoteStyle = "single"
+)
+
+type Config struct {
+	// IndentWidth is the number of spaces per block level.
+	IndentWidth int
+	// MaxLineLength is the column after which argument and parameter lists
+	// are broken over several lines.
+	MaxLineLength int
+	// Semicolons controls whether simple statements end with ";".
+	Semicolons SemicolonPolicy
+	// Quotes is the preferred string delimiter. Strings containing the
+	// preferred quote keep the other one.
+	Quotes QuoteStyle
+	// TrailingCommas adds a comma after the last item of a list that is
+	// broken over several lines.
+	TrailingCommas bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		IndentWidth:   4,
+		MaxLineLength: 80,
+		Semicolons:    SemicolonsNever,
+		Quotes:        QuoteDouble,
+	}
+}
+
+// Print formats node as Knife source. A Program ends with a newline and
+// keeps its comments.
+func Print(node ast.Node, cfg Config) string {
+	defaults := DefaultConfig()
+	if cfg.IndentWidth <= 0 {
+		cfg.IndentWidth = defaults.IndentWidth
+	}
+	if cfg.MaxLineLength <= 0 {
+		cfg.MaxLineLength = defaults.MaxLineLength
+	}
+	p := &printer{cfg: cfg}
+	if program, ok := node.(*ast.Program); ok {
+		p.comments = program.Comments
+	}
+	return Render(p.node(node), cfg.MaxLineLength)
+}
+
+type printer struct {
+	cfg      Config
+	comments []*ast.Comment
+}
+
+func (p *printer) node(node ast.Node) Doc {
+	switch node := node.(type) {
+	case *ast.Program:
+		doc := p.statements(node.Statements, ast.Position{Line: math.MaxInt})
+		if doc == nil {
+			return Text("")
+		}
+		return Concat(doc, HardLine())
+	case ast.Statement:
+		return p.statement(node)
+	case ast.Expression:
+		return p.expression(node)
+	}
+	panic(fmt.Sprintf("printer: unexpected node %T", node))
+}
+
+// statements prints one statement per line, together with the comments
+// that appear before end. A comment following a statement on the line it
+// ends on stays there. It returns nil when there is nothing to print.
+func (p *printer) statements(statements []ast.Statement, end ast.Position) Doc {
+	var docs []Doc
+	for _, s := range statements {
+		docs = append(docs, p.commentsBefore(ast.Position{Line: s.Line()})...)
+		doc := p.statement(s)
+		if trailing := p.commentAfter(ast.NodeSpan(s).End, end); trailing != nil {
+			doc = Concat(doc, Text(" "), trailing)
+		}
+		docs = append(docs, doc)
+	}
+	docs = append(docs, p.commentsBefore(end)...)
+	if len(docs) == 0 {
+		return nil
+	}
+	return Join(HardLine(), docs)
+}
+
+// commentsBefore returns the comments that start before pos.
+func (p *printer) commentsBefore(pos ast.Position) []Doc {
+	var docs []Doc
+	for len(p.comments) > 0 && before(commentPosition(p.comments[0]), pos) {
+		docs = append(docs, Text(p.comments[0].Token.Literal))
+		p.comments = p.comments[1:]
+	}
+	return docs
+}
+
+// commentAfter returns the comment on the line of pos that starts after
+// it, unless it starts after end.
+func (p *printer) commentAfter(pos, end ast.Position) Doc {
+	if pos.Line == 0 || len(p.comments) == 0 {
+		return nil
+	}
+	c := commentPosition(p.comments[0])
+	if c.Line != pos.Line || before(c, pos) || !before(c, end) {
+		return nil
+	}
+	doc := Text(p.comments[0].Token.Literal)
+	p.comments = p.comments[1:]
+	return doc
+}
+
+func commentPosition(c *ast.Comment) ast.Position {
+	return ast.Position{Line: c.Token.Line, Column: c.Token.Column}
+}
+
+func before(a, b ast.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+func (p *printer) semicolon() Doc {
+	if p.cfg.Semicolons == SemicolonsAlways {
+		return Text(";")
+	}
+	return Text("")
+}
+
+func (p *printer) statement(statement ast.Statement) Doc {
+	switch s := statement.(type) {
+	case *ast.LetStatement:
+		return Concat(export(s.Exported), Text("let "), Text(s.Name.Value), Text(" = "), p.expression(s.Value), p.semicolon())
+	case *ast.ReturnStatement:
+		if s.Value == nil {
+			return Concat(Text("return"), p.semicolon())
+		}
+		return Concat(Text("return "), p.expression(s.Value), p.semicolon())
+	case *ast.ExpressionStatement:
+		return Concat(p.expression(s.Expression), p.semicolon())
+	case *ast.FunctionDefineStatement:
+		params := make([]ast.Expression, 0, len(s.Parameters))
+		for _, param := range s.Parameters {
+			params = append(params, param)
+		}
+		var close ast.Position
+		if s.Body != nil {
+			close = ast.NodeSpan(s.Body).Start
+		}
+		return Concat(export(s.Exported), Text("func "), Text(s.Name.Value), p.list(params, close), Text(" "), p.block(s.Body))
+	case *ast.BlockStatement:
+		return p.block(s)
+	case *ast.ImportStatement:
+		path := Text(p.quote(s.Path.Value))
+		if s.Names != nil {
+			names := make([]Doc, 0, len(s.Names))
+			for _, name := range s.Names {
+				names = append(names, Text(name.Value))
+			}
+			return Concat(Text("import { "), Join(Text(", "), names), Text(" } from "), path, p.semicolon())
+		}
+		if s.Alias != nil {
+			return Concat(Text("import "), path, Text(" as "+s.Alias.Value), p.semicolon())
+		}
+		return Concat(Text("import "), path, p.semicolon())
+	}
+	panic(fmt.Sprintf("printer: unexpected statement %T", statement))
+}
+
+func export(exported bool) Doc {
+	if exported {
+		return Text("export ")
+	}
+	return Text("")
+}
+
+func (p *printer) block(block *ast.BlockStatement) Doc {
+	if block == nil {
+		return Text("{}")
+	}
+	end := ast.Position{Line: block.RBrace.Line, Column: block.RBrace.Column}
+	if end.Line == 0 {
+		end.Line = math.MaxInt
+	}
+	body := p.statements(block.Statements, end)
+	if body == nil {
+		return Text("{}")
+	}
+	return Concat(
+		Text("{"),
+		Nest(p.cfg.IndentWidth, Concat(HardLine(), body)),
+		HardLine(),
+		Text("}"),
+	)
+}
+
+// list prints a parenthesized, comma separated list that is broken one
+// item per line when it does not fit. The comments up to close, where the
+// list ends, stay next to the items they follow and break the list.
+func (p *printer) list(items []ast.Expression, close ast.Position) Doc {
+	if close.Line == 0 {
+		close.Line = math.MaxInt
+	}
+	var body []Doc
+	var trailing Doc
+	for i, item := range items {
+		if i > 0 {
+			body = append(body, Text(","), p.lineAfter(trailing))
+		}
+		for _, c := range p.commentsBefore(ast.NodeSpan(item).Start) {
+			body = append(body, c, HardLine())
+		}
+		body = append(body, p.expression(item))
+		next := close
+		if i+1 < len(items) {
+			next = ast.NodeSpan(items[i+1]).Start
+		}
+		trailing = p.commentAfter(ast.NodeSpan(item).End, next)
+	}
+	end := SoftLine()
+	if len(items) > 0 {
+		body = append(body, p.trailingComma())
+	}
+	if trailing != nil {
+		body = append(body, Text(" "), trailing)
+		end = HardLine()
+	}
+	for _, c := range p.commentsBefore(close) {
+		if len(body) > 0 {
+			body = append(body, HardLine())
+		}
+		body = append(body, c)
+		end = HardLine()
+	}
+	if len(body) == 0 {
+		return Text("()")
+	}
+	return Group(Concat(
+		Text("("),
+		Nest(p.cfg.IndentWidth, Concat(SoftLine(), Concat(body...))),
+		end,
+		Text(")"),
+	))
+}
+
+// lineAfter is the break after a list item, following its trailing comment
+// when it has one.
+func (p *printer) lineAfter(trailing Doc) Doc {
+	if trailing == nil {
+		return Line()
+	}
+	return Concat(Text(" "), trailing, HardLine())
+}
+
+func (p *printer) trailingComma() Doc {
+	if p.cfg.TrailingCommas {
+		return IfBreak(Text(","), Text(""))
+	}
+	return Text("")
+}
+
+func (p *printer) quote(s string) string {
+	if p.cfg.Quotes == QuoteSingle && !strings.Contains(s, "'") || strings.Contains(s, `"`) {
+		return "'" + s + "'"
+	}
+	return `"` + s + `"`
+}
+
+func (p *printer) expression(expression ast.Expression) Doc {
+	switch e := expression.(type) {
+	case *ast.Identifier:
+		return Text(e.Value)
+	case *ast.NumberLiteral:
+		return Text(e.Value)
+	case *ast.StringLiteral:
+		return Text(p.quote(e.Value))
+	case *ast.Null:
+		return Text("null")
+	case *ast.Boolean:
+		return Text(strconv.FormatBool(e.Value))
+	case *ast.IfExpression:
+		doc := Concat(Text("if ("), p.expression(e.Condition), Text(") "), p.block(e.Consequence))
+		if elseIf := e.ElseIf(); elseIf != nil {
+			return Concat(doc, Text(" else "), p.expression(elseIf))
+		}
+		if e.Alternative != nil {
+			return Concat(doc, Text(" else "), p.block(e.Alternative))
+		}
+		return doc
+	case *ast.PrefixExpression:
+		return Concat(Text(e.Op), p.operand(e.Rhs, parser.PREFIX))
+	case *ast.InfixExpression:
+		precedence := parser.Precedence(token.TokenType(e.Op))
+		return Concat(
+			p.operand(e.Lhs, precedence),
+			Text(" "+e.Op+" "),
+			p.operand(e.Rhs, precedence+1),
+		)
+	case *ast.FunctionCallExpression:
+		function := p.operand(e.Function, parser.CALL)
+		return Concat(function, p.list(e.Arguments, ast.Position{Line: e.RParen.Line, Column: e.RParen.Column}))
+	case *ast.MemberExpression:
+		return Concat(p.operand(e.Object, parser.CALL), Text("."+e.Property.Value))
+	}
+	panic(fmt.Sprintf("printer: unexpected expression %T", expression))
+}
+
+// operand prints e, in parentheses when it binds less tightly than
+// precedence requires.
+func (p *printer) operand(e ast.Expression, precedence int) Doc {
+	own := parser.CALL
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		own = parser.Precedence(token.TokenType(e.Op))
+	case *ast.PrefixExpression:
+		own = parser.PREFIX
+	case *ast.IfExpression:
+		own = parser.LOWEST
+	}
+	if own < precedence {
+		return Concat(Text("("), p.expression(e), Text(")"))
+	}
+	return p.expression(e)
+}
@@ -0,0 +1,221 @@
+package printer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+)
+
+func format(t *testing.T, src string, cfg Config) string {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		t.Fatalf("parse error: %v\n%s", err, src)
+	}
+	return Print(program, cfg)
+}
+
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a =   1", "let a = 1\n"},
+		{`print( "hello, knife" )`, "print(\"hello, knife\")\n"},
+		{"func f(x){return x}", "func f(x) {\n    return x\n}\n"},
+		{"func f() {}", "func f() {}\n"},
+		{"let a = - ( 1 + 2 )", "let a = -(1 + 2)\n"},
+		{"if(a){1}else if(b){2}else{3}", "if (a) {\n    1\n} else if (b) {\n    2\n} else {\n    3\n}\n"},
+		{
+			"func outer(a){ func inner(b){ return a+b } return inner(a) }",
+			"func outer(a) {\n    func inner(b) {\n        return a + b\n    }\n    return inner(a)\n}\n",
+		},
+		{"print(f(1), g(2))\nprint(3)", "print(f(1), g(2))\nprint(3)\n"},
+		{"let a = (1 + 2) * 3", "let a = (1 + 2) * 3\n"},
+		{"let a = 1 + 2 * 3", "let a = 1 + 2 * 3\n"},
+		{"let a = 1 - (2 - 3)", "let a = 1 - (2 - 3)\n"},
+		{"let a = (1 - 2) - 3", "let a = 1 - 2 - 3\n"},
+		{"let a = 1 == (2 < 3)", "let a = 1 == 2 < 3\n"},
+		{"let a = (1 == 2) < 3", "let a = (1 == 2) < 3\n"},
+		{"let a = (f)(1)", "let a = f(1)\n"},
+		{"import {a,b} from 'lib/x'\nimport './y.k'   as  y", "import { a, b } from \"lib/x\"\nimport \"./y.k\" as y\n"},
+		{"export let a = y.f( 1 ).b", "export let a = y.f(1).b\n"},
+		{"export func f(){}", "export func f() {}\n"},
+	}
+	for i, tt := range tests {
+		got := format(t, tt.input, DefaultConfig())
+		if got != tt.expected {
+			t.Fatalf("tests[%d] - expected:\n%q\ngot:\n%q", i, tt.expected, got)
+		}
+	}
+}
+
+func TestPrintLongArguments(t *testing.T) {
+	src := `print(first_argument, second_argument, nested(third_argument, fourth_argument))`
+	cfg := Config{IndentWidth: 2, MaxLineLength: 50}
+	expected := `print(
+  first_argument,
+  second_argument,
+  nested(third_argument, fourth_argument)
+)
+`
+	if got := format(t, src, cfg); got != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestPrintIndentWidth(t *testing.T) {
+	got := format(t, "func f(){ return 1 }", Config{IndentWidth: 2})
+	if got != "func f() {\n  return 1\n}\n" {
+		t.Fatalf("unexpected output: %q", got)
+	}
+}
+
+func TestPrintIdempotent(t *testing.T) {
+	err := filepath.Walk("../example", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".k") {
+			return err
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		p := parser.New(lexer.New(string(src)))
+		program := p.ParseProgram()
+		if p.Error() != nil {
+			t.Logf("skipping %s: does not parse", path)
+			return nil
+		}
+		for _, cfg := range []Config{DefaultConfig(), {IndentWidth: 2, MaxLineLength: 20}} {
+			once := Print(program, cfg)
+			twice := format(t, once, cfg)
+			if once != twice {
+				t.Errorf("%s: formatting is not idempotent\nfirst:\n%s\nsecond:\n%s", path, once, twice)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrintComments(t *testing.T) {
+	src := `// header
+let a = 1 // one
+func f(x) {
+    // inside
+    return x
+    // end of body
+}
+// footer
+`
+	got := format(t, src, DefaultConfig())
+	if got != src {
+		t.Fatalf("expected:\n%s\ngot:\n%s", src, got)
+	}
+
+	got = format(t, "func f() {\n// only a comment\n}\n", DefaultConfig())
+	if got != "func f() {\n    // only a comment\n}\n" {
+		t.Fatalf("unexpected output: %q", got)
+	}
+}
+
+func TestPrintTrailingComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"func f(x) { return x } // trailing\n",
+			"func f(x) {\n    return x\n} // trailing\n",
+		},
+		{
+			"if (a) { 1 } else { 2 } // trailing\n",
+			"if (a) {\n    1\n} else {\n    2\n} // trailing\n",
+		},
+		{
+			"print(\n    a, // first\n    // before b\n    b\n    // last\n)\nprint(1)\n",
+			"print(\n    a, // first\n    // before b\n    b\n    // last\n)\nprint(1)\n",
+		},
+		{
+			"print(f(1,\n  2), // inner\n  3) // outer\n",
+			"print(\n    f(1, 2), // inner\n    3\n) // outer\n",
+		},
+		{
+			"print(x, y // last\n)\n",
+			"print(\n    x,\n    y // last\n)\n",
+		},
+		{
+			"func g(a, // one\n  b) {\n  return a\n}\n",
+			"func g(\n    a, // one\n    b\n) {\n    return a\n}\n",
+		},
+	}
+	for i, tt := range tests {
+		got := format(t, tt.input, DefaultConfig())
+		if got != tt.expected {
+			t.Fatalf("tests[%d] - expected:\n%s\ngot:\n%s", i, tt.expected, got)
+		}
+		if again := format(t, got, DefaultConfig()); again != got {
+			t.Fatalf("tests[%d] - not stable, formatted again:\n%s", i, again)
+		}
+	}
+}
+
+func TestPrintStyleOptions(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Semicolons = SemicolonsAlways
+	cfg.Quotes = QuoteSingle
+	got := format(t, `func f(x) { return x }
+let a = "text"
+let b = "it's"
+f(a)`, cfg)
+	expected := "func f(x) {\n    return x;\n}\nlet a = 'text';\nlet b = \"it's\";\nf(a);\n"
+	if got != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	cfg = Config{MaxLineLength: 20, TrailingCommas: true}
+	got = format(t, "print(first_value, second_value)\nprint(1, 2)", cfg)
+	expected = "print(\n    first_value,\n    second_value,\n)\nprint(1, 2)\n"
+	if got != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+	if again := format(t, got, cfg); again != got {
+		t.Fatalf("trailing commas are not idempotent:\n%s", again)
+	}
+}
+
+func TestFormatDirectives(t *testing.T) {
+	src := `let a =   1
+// knife-fmt: off
+let   table = matrix(1, 0,
+                     0, 1)
+// knife-fmt: on
+let b =   2
+`
+	expected := `let a = 1
+// knife-fmt: off
+let   table = matrix(1, 0,
+                     0, 1)
+// knife-fmt: on
+let b = 2
+`
+	got, err := Format(src, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	_, err = Format("let a = 1\n// knife-fmt: off\nlet b = 2\n// knife-fmt: on\nprint(1 +)\n", DefaultConfig())
+	if err == nil || !strings.Contains(err.Error(), "line: 5") {
+		t.Fatalf("expected error on line 5, got=%v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/Serein-sz/knife/ast"
+)
+
+// Resolver binds every identifier of a program to a frame slot or to a
+// global name, and reports names that are undefined or used before their
+// definition.
+type Resolver struct {
+	predeclared map[string]bool
+	errors      []string
+}
+
+type scope struct {
+	parent *scope
+	// fn is nil for the program scope, whose names stay in a map.
+	fn    *ast.FunctionDefineStatement
+	slots map[string]int
+	// defined holds the names whose definition has been resolved so far,
+	// all holds every name defined anywhere in the scope.
+	defined map[string]bool
+	all     map[string]bool
+	// functions defined in the scope are resolved once the scope is
+	// complete, since their bodies only run when called.
+	functions []*ast.FunctionDefineStatement
+}
+
+// New returns a Resolver treating predeclared, such as the builtins and
+// the names already set in the global environment, as global names.
+func New(predeclared ...string) *Resolver {
+	r := &Resolver{predeclared: map[string]bool{}}
+	for _, name := range predeclared {
+		r.predeclared[name] = true
+	}
+	return r
+}
+
+func (r *Resolver) Resolve(program *ast.Program) {
+	global := &scope{defined: map[string]bool{}, all: definitions(program.Statements)}
+	r.scope(global, program.Statements)
+}
+
+func (r *Resolver) Error() error {
+	if len(r.errors) == 0 {
+		return nil
+	}
+	var s string
+	for _, msg := range r.errors {
+		s += "\t" + msg + "\n"
+	}
+	return fmt.Errorf("resolver error: %v", s)
+}
+
+// Errors returns each error message, in the order they were found.
+func (r *Resolver) Errors() []string {
+	return r.errors
+}
+
+func (r *Resolver) errorf(node ast.Node, format string, a ...any) {
+	r.errors = append(r.errors, fmt.Sprintf("line: %d, error: ", node.Line())+fmt.Sprintf(format, a...))
+}
+
+func (r *Resolver) scope(s *scope, statements []ast.Statement) {
+	r.statements(s, statements)
+	for _, f := range s.functions {
+		inner := &scope{
+			parent:  s,
+			fn:      f,
+			slots:   map[string]int{},
+			defined: map[string]bool{},
+			all:     map[string]bool{},
+		}
+		for _, p := range f.Parameters {
+			inner.all[p.Value] = true
+			r.define(inner, p)
+		}
+		if f.Body != nil {
+			for name := range definitions(f.Body.Statements) {
+				inner.all[name] = true
+			}
+			r.scope(inner, f.Body.Statements)
+		}
+		f.Locals = len(inner.slots)
+	}
+}
+
+func (r *Resolver) statements(s *scope, statements []ast.Statement) {
+	for _, statement := range statements {
+		switch st := statement.(type) {
+		case *ast.LetStatement:
+			r.expression(s, st.Value)
+			r.define(s, st.Name)
+		case *ast.FunctionDefineStatement:
+			r.define(s, st.Name)
+			s.functions = append(s.functions, st)
+		case *ast.ReturnStatement:
+			r.expression(s, st.Value)
+		case *ast.ExpressionStatement:
+			r.expression(s, st.Expression)
+		case *ast.BlockStatement:
+			r.statements(s, st.Statements)
+		case *ast.ImportStatement:
+			r.define(s, st.Alias)
+			for _, name := range st.Names {
+				r.define(s, name)
+			}
+		}
+	}
+}
+
+func (r *Resolver) define(s *scope, id *ast.Identifier) {
+	if id == nil {
+		return
+	}
+	s.defined[id.Value] = true
+	if s.fn == nil {
+		id.Binding = ast.Binding{Kind: ast.Global}
+		return
+	}
+	slot, ok := s.slots[id.Value]
+	if !ok {
+		slot = len(s.slots)
+		s.slots[id.Value] = slot
+	}
+	id.Binding = ast.Binding{Kind: ast.Local, Slot: slot}
+}
+
+func (r *Resolver) expression(s *scope, expression ast.Expression) {
+	switch e := expression.(type) {
+	case *ast.Identifier:
+		r.identifier(s, e)
+	case *ast.PrefixExpression:
+		r.expression(s, e.Rhs)
+	case *ast.InfixExpression:
+		r.expression(s, e.Lhs)
+		r.expression(s, e.Rhs)
+	case *ast.FunctionCallExpression:
+		r.expression(s, e.Function)
+		for _, a := range e.Arguments {
+			r.expression(s, a)
+		}
+	case *ast.MemberExpression:
+		r.expression(s, e.Object)
+	case *ast.IfExpression:
+		r.expression(s, e.Condition)
+		if e.Consequence != nil {
+			r.statements(s, e.Consequence.Statements)
+		}
+		if e.Alternative != nil {
+			r.statements(s, e.Alternative.Statements)
+		}
+	}
+}
+
+func (r *Resolver) identifier(s *scope, id *ast.Identifier) {
+	depth := 0
+	for cur := s; cur != nil; cur = cur.parent {
+		if cur.all[id.Value] {
+			// Names of the scope being resolved must be defined first;
+			// enclosing scopes are complete by the time a body runs.
+			if cur == s && !cur.defined[id.Value] {
+				r.errorf(id, "%s is used before its definition", id.Value)
+				return
+			}
+			if cur.fn == nil {
+				id.Binding = ast.Binding{Kind: ast.Global, Depth: depth}
+			} else {
+				id.Binding = ast.Binding{Kind: ast.Local, Depth: depth, Slot: cur.slots[id.Value]}
+			}
+			return
+		}
+		if cur.fn != nil {
+			depth++
+		}
+	}
+	if r.predeclared[id.Value] {
+		id.Binding = ast.Binding{Kind: ast.Global, Depth: depth}
+		return
+	}
+	r.errorf(id, "undefined identifier: %s", id.Value)
+}
+
+// definitions returns the names defined by statements, including those in
+// nested blocks, but not inside function bodies.
+func definitions(statements []ast.Statement) map[string]bool {
+	names := map[string]bool{}
+	for _, statement := range statements {
+		ast.Inspect(statement, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.LetStatement:
+				names[n.Name.Value] = true
+			case *ast.FunctionDefineStatement:
+				names[n.Name.Value] = true
+				return false
+			case *ast.ImportStatement:
+				if n.Alias != nil {
+					names[n.Alias.Value] = true
+				}
+				for _, name := range n.Names {
+					names[name.Value] = true
+				}
+				return false
+			}
+			return true
+		})
+	}
+	return names
+}
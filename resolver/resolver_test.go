@@ -0,0 +1,89 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+)
+
+func resolve(t *testing.T, src string) (*ast.Program, *Resolver) {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		t.Fatal(err)
+	}
+	r := New("print")
+	r.Resolve(program)
+	return program, r
+}
+
+func TestBindings(t *testing.T) {
+	program, r := resolve(t, `let a = 1
+func f(x, y) {
+  let z = x + a
+  func g() {
+    return z + y
+  }
+  if (x) {
+    let w = 2
+    return w
+  }
+  return g()
+}
+print(f(a, 2))
+`)
+	if err := r.Error(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		id, ok := n.(*ast.Identifier)
+		if !ok {
+			return true
+		}
+		b := id.Binding
+		switch b.Kind {
+		case ast.Local:
+			got = append(got, fmt.Sprintf("%s:L%d.%d", id.Value, b.Depth, b.Slot))
+		case ast.Global:
+			got = append(got, fmt.Sprintf("%s:G%d", id.Value, b.Depth))
+		default:
+			got = append(got, id.Value+":?")
+		}
+		return true
+	})
+	expected := "a:G0 f:G0 x:L0.0 y:L0.1 z:L0.2 x:L0.0 a:G1 g:L0.3 z:L1.2 y:L1.1 " +
+		"x:L0.0 w:L0.4 w:L0.4 g:L0.3 print:G0 f:G0 a:G0"
+	if s := strings.Join(got, " "); s != expected {
+		t.Fatalf("expected=%s\ngot=%s", expected, s)
+	}
+	f := program.Statements[1].(*ast.FunctionDefineStatement)
+	if f.Locals != 5 {
+		t.Fatalf("expected 5 locals, got %d", f.Locals)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected []string
+	}{
+		{"print(b)\nlet b = 1", []string{"line: 1, error: b is used before its definition"}},
+		{"func f() {\n return c\n}", []string{"line: 2, error: undefined identifier: c"}},
+		{"func f() {\n let x = x + 1\n return x\n}", []string{"line: 2, error: x is used before its definition"}},
+		// functions may call functions defined after them
+		{"func f() {\n return g()\n}\nfunc g() {\n return 1\n}\nprint(f())", nil},
+		{"let a = 1\nlet a = a + 1\nprint(a)", nil},
+	}
+	for _, tt := range tests {
+		_, r := resolve(t, tt.src)
+		if strings.Join(r.Errors(), "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: expected %q, got %q", tt.src, tt.expected, r.Errors())
+		}
+	}
+}
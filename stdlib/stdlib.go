@@ -0,0 +1,99 @@
+// Package stdlib holds the prelude: Knife sources embedded in the binary,
+// so they are versioned with the interpreter, and run in the global
+// environment before user code.
+package stdlib
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/eval"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+	"github.com/Serein-sz/knife/resolver"
+)
+
+//go:embed *.k
+var sources embed.FS
+
+// File is a source file of the prelude.
+type File struct {
+	Name   string
+	Source string
+}
+
+// Files returns the sources of the prelude sorted by name, without the
+// _test.k files.
+func Files() []File {
+	entries, err := fs.ReadDir(sources, ".")
+	if err != nil {
+		panic(err)
+	}
+	var files []File
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), "_test.k") {
+			continue
+		}
+		src, err := fs.ReadFile(sources, e.Name())
+		if err != nil {
+			panic(err)
+		}
+		files = append(files, File{Name: e.Name(), Source: string(src)})
+	}
+	return files
+}
+
+// Programs parses and resolves the prelude. Each call returns new
+// programs, so that callers may rewrite them.
+func Programs() ([]*ast.Program, error) {
+	var programs []*ast.Program
+	for _, f := range Files() {
+		p := parser.New(lexer.New(f.Source))
+		program := p.ParseProgram()
+		if err := p.Error(); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		r := resolver.New(append(eval.BuiltinNames(), Names()...)...)
+		r.Resolve(program)
+		if err := r.Error(); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		programs = append(programs, program)
+	}
+	return programs, nil
+}
+
+var names = sync.OnceValue(func() []string {
+	var names []string
+	for _, f := range Files() {
+		program := parser.New(lexer.New(f.Source)).ParseProgram()
+		for _, statement := range program.Statements {
+			switch st := statement.(type) {
+			case *ast.LetStatement:
+				names = append(names, st.Name.Value)
+			case *ast.FunctionDefineStatement:
+				names = append(names, st.Name.Value)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+})
+
+// Names returns the names the prelude defines, sorted.
+func Names() []string {
+	return slices.Clone(names())
+}
+
+// Defines reports whether the prelude defines name.
+func Defines(name string) bool {
+	n := Names()
+	i := sort.SearchStrings(n, name)
+	return i < len(n) && n[i] == name
+}
@@ -0,0 +1,46 @@
+package stdlib_test
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/eval"
+	"github.com/Serein-sz/knife/stdlib"
+	"github.com/Serein-sz/knife/utils"
+)
+
+// TestPrelude runs the _test.k files of the prelude on both engines.
+func TestPrelude(t *testing.T) {
+	for _, engine := range []string{utils.EngineTree, utils.EngineVM} {
+		var stdout, stderr bytes.Buffer
+		code := utils.Main([]string{"test", "--engine=" + engine, "."}, strings.NewReader(""), &stdout, &stderr)
+		if code != 0 || !strings.Contains(stdout.String(), "PASS") {
+			t.Errorf("%s: exit %d\n%s%s", engine, code, stdout.String(), stderr.String())
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := stdlib.Names()
+	for _, name := range []string{"max", "min", "sort_by", "sum"} {
+		if !slices.Contains(names, name) || !stdlib.Defines(name) {
+			t.Errorf("expected the prelude to define %s, got %v", name, names)
+		}
+	}
+	if stdlib.Defines("less") {
+		t.Errorf("nested functions should not be global")
+	}
+	// the prelude comes before the builtins when looking names up
+	for _, name := range names {
+		if eval.IsBuiltin(name) {
+			t.Errorf("the prelude hides the builtin %s", name)
+		}
+	}
+	for _, f := range stdlib.Files() {
+		if strings.HasSuffix(f.Name, "_test.k") {
+			t.Errorf("%s should not be part of the prelude", f.Name)
+		}
+	}
+}
@@ -38,20 +38,26 @@ const (
 	COMMA     = ","
 	COLON     = ":"
 	SEMICOLON = ";"
+	DOT       = "."
 
 	FUNCTION = "func"
 	IF       = "if"
 	ELSE     = "else"
 	RETURN   = "return"
+	IMPORT   = "import"
+	EXPORT   = "export"
 
+	COMMENT = "COMMENT"
 	EOF     = "EOF"
 	ILLEGAL = "ILLEGAL"
 )
 
 type Token struct {
-	Line    int
-	Type    TokenType
-	Literal string
+	Line int `json:"line"`
+	// Column is the 1-based byte offset of the token in its line.
+	Column  int       `json:"column"`
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
 }
 
 var keywords = map[string]TokenType{
@@ -62,6 +68,8 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"import": IMPORT,
+	"export": EXPORT,
 	"null":   NULL,
 }
 
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Serein-sz/knife/compiler"
+	"github.com/Serein-sz/knife/optimizer"
+)
+
+// bytecodeExt 为预编译字节码文件的扩展名
+const bytecodeExt = ".kc"
+
+// BuildOptions 控制 knife build 的输出
+type BuildOptions struct {
+	// Out 为输出文件，为空时写入与源文件同名的 .kc 文件，为 - 时写入 Stdout
+	Out      string
+	Optimize bool
+	Stdin    io.Reader
+	Stdout   io.Writer
+}
+
+// Build 将 path 编译为字节码文件
+func Build(path string, opts BuildOptions) error {
+	out := opts.Out
+	if out == "" {
+		if path == "-" {
+			return errors.New("从标准输入编译时需通过 -o 指定输出文件")
+		}
+		out = strings.TrimSuffix(path, filepath.Ext(path)) + bytecodeExt
+	}
+	src, err := readSource(path, opts.Stdin)
+	if err != nil {
+		return err
+	}
+	file, err := compileSource(src, opts.Optimize)
+	if err != nil {
+		return err
+	}
+	if out == "-" {
+		return compiler.WriteFile(opts.Stdout, file)
+	}
+	return writeBytecode(out, file)
+}
+
+func compileSource(src string, optimize bool) (*compiler.File, error) {
+	program, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if optimize {
+		optimizer.Optimize(program)
+	}
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	return &compiler.File{Version: Version, Checksum: compiler.Checksum(src), Bytecode: bytecode}, nil
+}
+
+// writeBytecode 先写入临时文件再重命名，避免并发执行的脚本读到写了一半的文件
+func writeBytecode(path string, file *compiler.File) error {
+	var buf bytes.Buffer
+	if err := compiler.WriteFile(&buf, file); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".knife-*.kc")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func readBytecode(path string) (*compiler.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return compiler.ReadFile(f)
+}
+
+// loadBytecode 读取 knife build 生成的文件，拒绝其他版本编译的文件，
+// 以及同目录下同名源文件在编译后又被修改的文件
+func loadBytecode(path string) (*compiler.File, error) {
+	file, err := readBytecode(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if file.Version != Version {
+		return nil, fmt.Errorf("%s 由 knife %s 编译，与当前版本 %s 不一致，请重新执行 knife build", path, file.Version, Version)
+	}
+	source := strings.TrimSuffix(path, bytecodeExt) + ".k"
+	if src, err := os.ReadFile(source); err == nil && compiler.Checksum(string(src)) != file.Checksum {
+		return nil, fmt.Errorf("%s 已过期，%s 在编译后被修改，请重新执行 knife build", path, source)
+	}
+	return file, nil
+}
+
+// DefaultCacheDir 返回编译缓存目录：环境变量 KNIFE_CACHE_DIR，
+// 未设置时为用户缓存目录下的 knife，都不可用时返回空字符串
+func DefaultCacheDir() string {
+	if dir := os.Getenv("KNIFE_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "knife")
+}
+
+// compileCached 以源码内容的哈希为键缓存编译结果，缓存文件的版本或校验和
+// 不一致时重新编译；缓存目录不可用时不影响执行
+func compileCached(src string, cacheDir string, optimize bool) (*compiler.Bytecode, error) {
+	checksum := compiler.Checksum(src)
+	key := hex.EncodeToString(checksum[:])
+	if optimize {
+		key += ".opt"
+	}
+	path := filepath.Join(cacheDir, key+bytecodeExt)
+	if file, err := readBytecode(path); err == nil && file.Version == Version && file.Checksum == checksum {
+		return file.Bytecode, nil
+	}
+	file, err := compileSource(src, optimize)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err == nil {
+		writeBytecode(path, file)
+	}
+	return file.Bytecode, nil
+}
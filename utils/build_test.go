@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/compiler"
+)
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.k")
+	os.WriteFile(src, []byte("func f(x) {\n return x * 2\n}\nassert(f(args) == 4)\n"), 0644)
+	if code, _, stderr := runMain("", "build", src); code != 0 {
+		t.Fatalf("build failed: %s", stderr)
+	}
+	out := filepath.Join(dir, "main.kc")
+	if code, _, stderr := runMain("", "run", out); code == 0 || !strings.Contains(stderr, "illegal operands") {
+		t.Fatalf("expected the script to run and fail on args, got exit %d: %s", code, stderr)
+	}
+	os.WriteFile(src, []byte("assert(true)\n"), 0644)
+	if code, _, stderr := runMain("", "run", out); code != 1 || !strings.Contains(stderr, "已过期") {
+		t.Fatalf("expected a stale bytecode error, got exit %d: %s", code, stderr)
+	}
+	if code, _, _ := runMain("", "run", "--engine=tree", out); code != 1 {
+		t.Fatalf("expected the tree engine to refuse bytecode")
+	}
+
+	other := filepath.Join(dir, "other.kc")
+	if code, _, stderr := runMain("", "build", "-o", other, src); code != 0 {
+		t.Fatalf("build failed: %s", stderr)
+	}
+	if code, _, stderr := runMain("", "run", other); code != 0 {
+		t.Fatalf("run failed: %s", stderr)
+	}
+	if code, _, _ := runMain("", "build", "-"); code != 1 {
+		t.Fatalf("expected building stdin without -o to fail")
+	}
+}
+
+func TestRunCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("KNIFE_CACHE_DIR", cacheDir)
+	src := "assert(1 == 1)\n"
+	checksum := compiler.Checksum(src)
+	entry := filepath.Join(cacheDir, hex.EncodeToString(checksum[:])+".kc")
+
+	if code, _, stderr := runMain(src, "run", "--engine=vm", "-"); code != 0 {
+		t.Fatalf("run failed: %s", stderr)
+	}
+	if _, err := readBytecode(entry); err != nil {
+		t.Fatalf("expected a cache entry: %v", err)
+	}
+
+	// A cache entry for the same source is used without compiling it again.
+	file, err := compileSource("assert(1 == 2)\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Checksum = checksum
+	writeBytecode(entry, file)
+	if code, _, _ := runMain(src, "run", "--engine=vm", "-"); code != 1 {
+		t.Fatalf("expected the cached bytecode to run")
+	}
+	if code, _, _ := runMain(src, "run", "--engine=vm", "--no-cache", "-"); code != 0 {
+		t.Fatalf("expected --no-cache to compile the source")
+	}
+
+	// Entries written by another version are replaced.
+	file.Version = "0.0.0"
+	writeBytecode(entry, file)
+	if code, _, stderr := runMain(src, "run", "--engine=vm", "-"); code != 0 {
+		t.Fatalf("expected the source to be compiled again: %s", stderr)
+	}
+	if cached, err := readBytecode(entry); err != nil || cached.Version != Version {
+		t.Fatalf("expected the entry to be rewritten, got %+v, %v", cached, err)
+	}
+}
@@ -0,0 +1,296 @@
+package utils
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Serein-sz/knife/eval"
+)
+
+// Version 解释器版本号
+const Version = "1.0.1"
+
+const usage = `用法: knife <命令> [参数]
+
+命令:
+  run [--allow-*] [--engine=E] [--no-cache] [--optimize] [file.k|file.kc|-] [-- args...]
+                                          执行脚本，脚本中可通过 args 读取参数，E 为 tree 或 vm，
+                                          未指定文件时执行 knife.toml 中的 entry
+  build [-o out.kc] [--optimize] <file.k|->
+                                          编译为字节码文件
+  fmt [--check|--diff] <path|->...        格式化.k文件或文件夹，- 表示标准输入
+  check <path|->...                       语法检查
+  lint [--format=F] <path|->...           静态检查，F 为 text、json 或 sarif
+  test [--allow-*] [--engine=E] [path]    执行 _test.k 文件中以 test 开头的函数
+  deps list|verify|lock [path]            列出依赖、校验依赖与 knife.lock 是否一致或重新生成 knife.lock
+  repl [--allow-*]                        启动交互式解释器
+  tokens [--json] <file.k|->              输出词法分析结果
+  ast [--json] <file.k|->                 输出语法树
+
+选项:
+  --version  显示版本号
+  --help     显示帮助
+`
+
+// exitUsage 表示命令行参数错误时的退出码
+const exitUsage = 2
+
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command func(c *cli, args []string) error
+
+var commands = map[string]command{
+	"run":    (*cli).run,
+	"fmt":    (*cli).format,
+	"check":  (*cli).check,
+	"lint":   (*cli).lint,
+	"test":   (*cli).test,
+	"repl":   (*cli).repl,
+	"build":  (*cli).build,
+	"deps":   (*cli).deps,
+	"tokens": (*cli).tokens,
+	"ast":    (*cli).ast,
+}
+
+var errUsage = errors.New("usage")
+
+// Main 解析命令行并执行对应的子命令，返回进程退出码
+func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+	if len(args) == 0 {
+		io.WriteString(stderr, usage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "--version", "-version", "version":
+		fmt.Fprintf(stdout, "knife %s\n", Version)
+		return 0
+	case "--help", "-help", "-h", "help":
+		io.WriteString(stdout, usage)
+		return 0
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "未知命令: %s\n\n%s", args[0], usage)
+		return exitUsage
+	}
+	err := cmd(c, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		return exitUsage
+	}
+	fmt.Fprintln(c.stderr, strings.TrimRight(err.Error(), "\n"))
+	return 1
+}
+
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+// parse 解析子命令参数，-- 之后的参数原样返回
+func (c *cli) parse(fs *flag.FlagSet, args []string) (positional []string, rest []string, err error) {
+	for i, a := range args {
+		if a == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	return fs.Args(), rest, nil
+}
+
+func (c *cli) usageError(fs *flag.FlagSet, format string, a ...any) error {
+	fmt.Fprintf(c.stderr, format+"\n", a...)
+	fs.Usage()
+	return errUsage
+}
+
+func (c *cli) run(args []string) error {
+	fs := c.flagSet("run")
+	var permissions eval.Permissions
+	BindPermissionFlags(fs, &permissions)
+	engine := fs.String("engine", "", "执行引擎，tree 或 vm，默认 .kc 文件为 vm，其余为 tree")
+	noCache := fs.Bool("no-cache", false, "vm 引擎不使用编译缓存")
+	optimize := fs.Bool("optimize", false, "执行前折叠常量并删除不可达代码")
+	positional, rest, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		m, err := findManifest(".")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if m == nil || m.Entry == "" {
+			return c.usageError(fs, "请指定需要执行的文件，或在 knife.toml 中设置 entry")
+		}
+		positional = []string{filepath.Join(m.Dir, m.Entry)}
+	}
+	cacheDir := ""
+	if !*noCache {
+		cacheDir = DefaultCacheDir()
+	}
+	return Run(positional[0], RunOptions{
+		Args:        append(positional[1:], rest...),
+		Permissions: permissions,
+		Stdin:       c.stdin,
+		Stdout:      c.stdout,
+		Stderr:      c.stderr,
+		Engine:      *engine,
+		CacheDir:    cacheDir,
+		Optimize:    *optimize,
+	})
+}
+
+func (c *cli) build(args []string) error {
+	fs := c.flagSet("build")
+	opts := BuildOptions{Stdin: c.stdin, Stdout: c.stdout}
+	fs.StringVar(&opts.Out, "o", "", "输出文件，默认为同名的 .kc 文件，- 表示标准输出")
+	fs.BoolVar(&opts.Optimize, "optimize", false, "编译前折叠常量并删除不可达代码")
+	positional, _, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return c.usageError(fs, "请指定一个需要编译的文件")
+	}
+	return Build(positional[0], opts)
+}
+
+func (c *cli) deps(args []string) error {
+	fs := c.flagSet("deps")
+	positional, _, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 || len(positional) > 2 {
+		return c.usageError(fs, "用法: knife deps list|verify|lock [path]")
+	}
+	dir := "."
+	if len(positional) == 2 {
+		dir = positional[1]
+	}
+	switch positional[0] {
+	case "list":
+		return ListDependencies(dir, c.stdout)
+	case "verify":
+		return VerifyDependencies(dir, c.stdout)
+	case "lock":
+		return LockDependencies(dir)
+	}
+	return c.usageError(fs, "未知的 deps 子命令: %s", positional[0])
+}
+
+func (c *cli) format(args []string) error {
+	fs := c.flagSet("fmt")
+	opts := FormatOptions{Stdin: c.stdin, Stdout: c.stdout, Stderr: c.stderr}
+	fs.BoolVar(&opts.Check, "check", false, "只列出未格式化的文件，存在时以非零状态码退出")
+	fs.BoolVar(&opts.Diff, "diff", false, "输出格式化前后的差异，不写入文件")
+	positional, _, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return c.usageError(fs, "请指定需要格式化的路径")
+	}
+	var errs []error
+	for _, path := range positional {
+		if err := Format(path, opts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *cli) check(args []string) error {
+	fs := c.flagSet("check")
+	positional, _, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return c.usageError(fs, "请指定需要检查的路径")
+	}
+	return Check(positional, c.stdin, c.stderr)
+}
+
+func (c *cli) lint(args []string) error {
+	fs := c.flagSet("lint")
+	opts := LintOptions{Stdin: c.stdin, Stdout: c.stdout}
+	fs.StringVar(&opts.Format, "format", "text", "输出格式: text、json 或 sarif")
+	positional, _, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return c.usageError(fs, "请指定需要检查的路径")
+	}
+	return Lint(positional, opts)
+}
+
+func (c *cli) test(args []string) error {
+	fs := c.flagSet("test")
+	var permissions eval.Permissions
+	BindPermissionFlags(fs, &permissions)
+	engine := fs.String("engine", EngineTree, "执行引擎，tree 或 vm")
+	positional, rest, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	path := "."
+	if len(positional) > 0 {
+		path = positional[0]
+	}
+	return Test(path, RunOptions{Args: rest, Permissions: permissions, Engine: *engine, Stdout: c.stdout, Stderr: c.stderr}, c.stdout)
+}
+
+func (c *cli) repl(args []string) error {
+	fs := c.flagSet("repl")
+	var permissions eval.Permissions
+	BindPermissionFlags(fs, &permissions)
+	if _, _, err := c.parse(fs, args); err != nil {
+		return err
+	}
+	return Repl(c.stdin, c.stdout, DefaultHistoryPath(), permissions)
+}
+
+func (c *cli) tokens(args []string) error {
+	fs := c.flagSet("tokens")
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出")
+	positional, _, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return c.usageError(fs, "请指定一个文件")
+	}
+	return Tokens(positional[0], c.stdin, c.stdout, *asJSON)
+}
+
+func (c *cli) ast(args []string) error {
+	fs := c.flagSet("ast")
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出")
+	positional, _, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return c.usageError(fs, "请指定一个文件")
+	}
+	return Ast(positional[0], c.stdin, c.stdout, *asJSON)
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/token"
+)
+
+func runMain(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Main(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestMainExitCodes(t *testing.T) {
+	t.Setenv("KNIFE_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.k")
+	os.WriteFile(bad, []byte("print(1 +)\n"), 0644)
+	failing := filepath.Join(dir, "failing.k")
+	os.WriteFile(failing, []byte("print(undefined_name)\n"), 0644)
+	good := filepath.Join(dir, "good.k")
+	os.WriteFile(good, []byte("let a = 1\n"), 0644)
+
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{nil, exitUsage},
+		{[]string{"unknown"}, exitUsage},
+		{[]string{"run"}, exitUsage},
+		{[]string{"--version"}, 0},
+		{[]string{"run", good}, 0},
+		{[]string{"run", bad}, 1},
+		{[]string{"run", failing}, 1},
+		{[]string{"run", "--engine=vm", good}, 0},
+		{[]string{"run", "--engine=vm", bad}, 1},
+		{[]string{"run", "--engine=other", good}, 1},
+		{[]string{"run", "--optimize", good}, 0},
+		{[]string{"run", "--optimize", "--engine=vm", failing}, 1},
+		{[]string{"test", "--engine=vm", "../example/src"}, 0},
+		{[]string{"run", filepath.Join(dir, "missing.k")}, 1},
+		{[]string{"check", good}, 0},
+		{[]string{"check", dir}, 1},
+		{[]string{"check", failing}, 1},
+		{[]string{"tokens", good}, 0},
+		{[]string{"ast", bad}, 1},
+	}
+	for i, tt := range tests {
+		code, _, stderr := runMain("", tt.args...)
+		if code != tt.expected {
+			t.Fatalf("tests[%d] %v - expected exit %d, got %d: %s", i, tt.args, tt.expected, code, stderr)
+		}
+	}
+}
+
+func TestMainRunStdinArgs(t *testing.T) {
+	code, _, stderr := runMain("assert(len(args) == 2)\nassert(get(args, 1) == \"b\")", "run", "-", "--", "a", "b")
+	if code != 0 {
+		t.Fatalf("expected args to hold two strings, got exit %d: %s", code, stderr)
+	}
+
+	dir := t.TempDir()
+	test := filepath.Join(dir, "math_test.k")
+	os.WriteFile(test, []byte("func test_add() { assert(2 == 1 + 1) }\nfunc test_sub() { assert(1 == 1 - 1, \"bad\") }\n"), 0644)
+	code, stdout, _ := runMain("", "test", dir)
+	if code != 1 || !strings.Contains(stdout, "ok\t"+test+"\ttest_add") || !strings.Contains(stdout, "FAIL\t"+test+"\ttest_sub") {
+		t.Fatalf("unexpected test output, exit %d:\n%s", code, stdout)
+	}
+}
+
+func TestMainRunOutput(t *testing.T) {
+	for _, engine := range []string{EngineTree, EngineVM} {
+		code, stdout, stderr := runMain("println(\"a\", 1)\neprint(\"oops\")\nprintf(\"%03d\", 7)\n", "run", "--no-cache", "--engine="+engine, "-")
+		if code != 0 || stdout != "a 1\n007" || stderr != "oops\n" {
+			t.Fatalf("%s: unexpected output, exit %d: %q %q", engine, code, stdout, stderr)
+		}
+	}
+}
+
+func TestMainRunFS(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app/main.k":   "print(fs.read(\"data.txt\"))\nfs.write(\"out.txt\", \"done\")\n",
+		"app/data.txt": "hello",
+	})
+	main := filepath.Join(dir, "app/main.k")
+	for _, engine := range []string{EngineTree, EngineVM} {
+		code, stdout, stderr := runMain("", "run", "--no-cache", "--engine="+engine, "--allow-read", "--allow-write="+filepath.Join(dir, "app"), main)
+		if code != 0 || stdout != "hello\n" {
+			t.Fatalf("%s: expected the file next to the script, got exit %d: %q %s", engine, code, stdout, stderr)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "app/out.txt")); err != nil || string(data) != "done" {
+		t.Fatalf("expected out.txt next to the script, got %q (%v)", data, err)
+	}
+	if code, _, stderr := runMain("", "run", "--no-cache", "--allow-read", main); code != 1 || !strings.Contains(stderr, "fs.write: permission denied: fs-write") {
+		t.Fatalf("expected the write to be denied, got exit %d: %s", code, stderr)
+	}
+}
+
+func TestMainRunFSScopes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app/main.k":      "fs.write(\"out/res.txt\", fs.read(\"data/in.txt\"))\n",
+		"app/data/in.txt": "hello",
+		"app/out/.keep":   "",
+		"app/leak.k":      "print(fs.read(\"secret.txt\"))\n",
+		"app/secret.txt":  "secret",
+	})
+	t.Chdir(t.TempDir())
+	for _, engine := range []string{EngineTree, EngineVM} {
+		main := filepath.Join(dir, "app/main.k")
+		code, _, stderr := runMain("", "run", "--no-cache", "--engine="+engine, "--allow-read=data", "--allow-write=out", main)
+		if code != 0 {
+			t.Fatalf("%s: expected the scopes to be taken from the script directory, got exit %d: %s", engine, code, stderr)
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "app/out/res.txt")); err != nil || string(data) != "hello" {
+			t.Fatalf("%s: expected out/res.txt next to the script, got %q (%v)", engine, data, err)
+		}
+		leak := filepath.Join(dir, "app/leak.k")
+		if code, _, stderr := runMain("", "run", "--no-cache", "--engine="+engine, "--allow-read=data", leak); code != 1 || !strings.Contains(stderr, "permission denied: fs-read") {
+			t.Fatalf("%s: expected the read outside the scope to be denied, got exit %d: %s", engine, code, stderr)
+		}
+	}
+}
+
+func TestMainJSONOutput(t *testing.T) {
+	code, stdout, stderr := runMain("let a = f(1)\n", "ast", "--json", "-")
+	if code != 0 {
+		t.Fatalf("ast --json failed: %s", stderr)
+	}
+	program, err := ast.DecodeProgram([]byte(stdout))
+	if err != nil || program.String() != "let a = f(1)" {
+		t.Fatalf("unexpected decoded program %v: %v", program, err)
+	}
+
+	code, stdout, _ = runMain("let a", "tokens", "--json", "-")
+	var tokens []token.Token
+	if err := json.Unmarshal([]byte(stdout), &tokens); code != 0 || err != nil || len(tokens) != 3 || tokens[1].Column != 5 {
+		t.Fatalf("unexpected tokens %s: %v", stdout, err)
+	}
+}
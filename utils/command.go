@@ -1,74 +1,299 @@
 package utils
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/Serein-sz/knife/ast"
 	"github.com/Serein-sz/knife/environment"
 	"github.com/Serein-sz/knife/eval"
 	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/optimizer"
 	"github.com/Serein-sz/knife/parser"
+	"github.com/Serein-sz/knife/resolver"
+	"github.com/Serein-sz/knife/stdlib"
+	"github.com/Serein-sz/knife/token"
 )
 
-func Run(mainProgramPath string) {
-	src, err := ReadFile(mainProgramPath)
+// RunOptions 控制脚本的执行方式
+type RunOptions struct {
+	// Args 以 args 数组的形式传给脚本
+	Args        []string
+	Permissions eval.Permissions
+	// Stdin 在路径为 - 时作为源代码读取
+	Stdin io.Reader
+	// Stdout 与 Stderr 接收脚本的输出，为空时为 os.Stdout 与 os.Stderr
+	Stdout io.Writer
+	Stderr io.Writer
+	// Engine 为 EngineTree 或 EngineVM，为空时 .kc 文件使用 EngineVM，其余使用 EngineTree
+	Engine string
+	// CacheDir 为 vm 引擎的编译缓存目录，为空时不缓存
+	CacheDir string
+	// Optimize 为真时执行前折叠常量并删除不可达代码
+	Optimize bool
+}
+
+// Run 执行 mainProgramPath 指向的脚本或 .kc 字节码文件，路径为 - 时从标准输入读取
+func Run(mainProgramPath string, opts RunOptions) error {
+	isBytecode := strings.HasSuffix(mainProgramPath, bytecodeExt)
+	if isBytecode && opts.Engine == "" {
+		opts.Engine = EngineVM
+	}
+	engine, err := newEngine(opts, mainProgramPath)
 	if err != nil {
-		panic("not found source code")
+		return err
 	}
-	l := lexer.New(src)
-	p := parser.New(l)
-	program := p.ParseProgram()
-	if err = p.Error(); err != nil {
-		io.WriteString(os.Stderr, err.Error())
+	machine, isVM := engine.(vmEngine)
+	if isBytecode && !isVM {
+		return fmt.Errorf("字节码文件只能由 %s 引擎执行", EngineVM)
+	}
+	env := engine.globals()
+	env.Set("args", stringArray(opts.Args))
+
+	if isBytecode {
+		file, err := loadBytecode(mainProgramPath)
+		if err != nil {
+			return err
+		}
+		err = machine.runBytecode(file.Bytecode, env)
+		return evalError(err)
 	}
-	env := environment.NewEnvironment(nil)
-	_, err = eval.Eval(program, env)
+	src, err := readSource(mainProgramPath, opts.Stdin)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "eval err: %v", err)
+		return err
+	}
+	if isVM && opts.CacheDir != "" {
+		bytecode, err := compileCached(src, opts.CacheDir, opts.Optimize)
+		if err != nil {
+			return err
+		}
+		return evalError(machine.runBytecode(bytecode, env))
 	}
+	program, err := parse(src)
+	if err != nil {
+		return err
+	}
+	if opts.Optimize {
+		optimizer.Optimize(program)
+	}
+	return evalError(engine.run(program, env))
 }
 
-// Format 格式化.k文件或递归格式化文件夹中的.k文件
-// 作者: 王强
-// 日期: 2025-04-30
-// 版本: 1.0.1
-func Format(path string) {
-	fileInfo, err := os.Stat(path)
+func evalError(err error) error {
 	if err != nil {
-		panic("路径不存在")
+		return fmt.Errorf("eval err: %w", err)
 	}
+	return nil
+}
 
-	if fileInfo.IsDir() {
-		filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+// Check 只做语法检查，错误信息写入 w
+func Check(paths []string, stdin io.Reader, w io.Writer) error {
+	failed := 0
+	for _, path := range paths {
+		err := walkSources(path, func(filePath string) error {
+			src, err := readSource(filePath, stdin)
 			if err != nil {
 				return err
 			}
-			if !info.IsDir() && strings.HasSuffix(filePath, ".k") {
-				formatFile(filePath)
+			if _, err := parse(src); err != nil {
+				fmt.Fprintf(w, "%s: %v", filePath, err)
+				failed++
 			}
 			return nil
 		})
-	} else {
-		formatFile(path)
+		if err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个文件存在语法错误", failed)
 	}
+	return nil
 }
 
-func formatFile(filePath string) {
-	src, err := ReadFile(filePath)
+// Tokens 按行输出词法分析结果，asJSON 为真时输出 JSON 数组
+func Tokens(path string, stdin io.Reader, w io.Writer, asJSON bool) error {
+	src, err := readSource(path, stdin)
 	if err != nil {
-		panic("未找到源代码文件")
+		return err
 	}
 	l := lexer.New(src)
-	p := parser.New(l)
+	var tokens []token.Token
+	for {
+		tok := l.NextToken()
+		if asJSON {
+			tokens = append(tokens, tok)
+		} else {
+			fmt.Fprintf(w, "%d:%d\t%s\t%q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+		}
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	if !asJSON {
+		return nil
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tokens)
+}
+
+// Ast 输出语法树结构，语法错误时仍输出已解析的部分，
+// asJSON 为真时输出可由 ast.DecodeProgram 还原的 JSON
+func Ast(path string, stdin io.Reader, w io.Writer, asJSON bool) error {
+	src, err := readSource(path, stdin)
+	if err != nil {
+		return err
+	}
+	p := parser.New(lexer.New(src))
 	program := p.ParseProgram()
-	if err = p.Error(); err != nil {
-		io.WriteString(os.Stderr, err.Error())
+	if !asJSON {
+		dumpNode(w, "", program, 0)
+		return p.Error()
 	}
-	err = WriteFile(filePath, program.String())
+	data, err := ast.EncodeJSON(program)
 	if err != nil {
-		io.WriteString(os.Stderr, err.Error())
+		return err
+	}
+	fmt.Fprintf(w, "%s\n", data)
+	return p.Error()
+}
+
+// Test 执行目录下所有 _test.k 文件中以 test 开头的无参函数
+func Test(path string, opts RunOptions, w io.Writer) error {
+	failures := 0
+	total := 0
+	err := walkSources(path, func(filePath string) error {
+		if !strings.HasSuffix(filePath, "_test.k") {
+			return nil
+		}
+		src, err := ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		program, err := parse(src)
+		if err != nil {
+			failures++
+			fmt.Fprintf(w, "FAIL\t%s\n%v", filePath, err)
+			return nil
+		}
+		engine, err := newEngine(opts, filePath)
+		if err != nil {
+			return err
+		}
+		env := engine.globals()
+		env.Set("args", stringArray(opts.Args))
+		if err := engine.run(program, env); err != nil {
+			failures++
+			fmt.Fprintf(w, "FAIL\t%s\n\t%v\n", filePath, strings.TrimRight(err.Error(), "\n"))
+			return nil
+		}
+		for _, name := range env.Names() {
+			obj, _ := env.Get(name)
+			n, ok := parameterCount(obj)
+			if !ok || !strings.HasPrefix(name, "test") || n != 0 {
+				continue
+			}
+			total++
+			if err := engine.call(obj); err != nil {
+				failures++
+				fmt.Fprintf(w, "FAIL\t%s\t%s\n\t%v\n", filePath, name, strings.TrimRight(err.Error(), "\n"))
+				continue
+			}
+			fmt.Fprintf(w, "ok\t%s\t%s\n", filePath, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d of %d tests failed", failures, total)
+	}
+	fmt.Fprintf(w, "PASS\t%d tests\n", total)
+	return nil
+}
+
+// walkSources 对文件调用 fn，对文件夹则递归处理其中的.k文件，跳过 .knifeignore 中列出的路径
+func walkSources(path string, fn func(filePath string) error) error {
+	if path == "-" {
+		return fn(path)
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("路径不存在: %s", path)
+	}
+	if !fileInfo.IsDir() {
+		return fn(path)
+	}
+	ignore, err := loadIgnore(path)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath != path && ignore.match(filePath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && strings.HasSuffix(filePath, ".k") {
+			return fn(filePath)
+		}
+		return nil
+	})
+}
+
+func readSource(path string, stdin io.Reader) (string, error) {
+	if path != "-" {
+		return ReadFile(path)
+	}
+	if stdin == nil {
+		return "", errors.New("no stdin available")
+	}
+	content, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// parse 解析并静态解析源码，脚本中可直接使用内置函数、标准库和 args
+func parse(src string) (*ast.Program, error) {
+	return parseWith(src, append(predeclared(), "args")...)
+}
+
+// predeclared 返回无需定义即可使用的名称：内置函数和标准库中定义的名称
+func predeclared() []string {
+	return append(eval.BuiltinNames(), stdlib.Names()...)
+}
+
+func parseWith(src string, predeclared ...string) (*ast.Program, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+	r := resolver.New(predeclared...)
+	r.Resolve(program)
+	if err := r.Error(); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+func stringArray(values []string) *environment.Array {
+	elements := make([]environment.Object, 0, len(values))
+	for _, v := range values {
+		elements = append(elements, &environment.String{Value: v})
 	}
+	return &environment.Array{Elements: elements}
 }
@@ -0,0 +1,419 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Serein-sz/knife/config"
+)
+
+// lockFile 记录每个依赖的来源和内容哈希，与 knife.toml 放在同一目录
+const lockFile = "knife.lock"
+
+// Package 为解析后的依赖
+type Package struct {
+	Name    string
+	Version string
+	// Source 为声明它的清单中写的来源
+	Source string
+	// Hash 为来源内容的 sha256：目录按其中文件的路径和内容计算，归档按文件本身计算
+	Hash string
+	// Dir 为依赖的文件所在目录，归档解压在缓存目录中
+	Dir string
+	// Entry 为 import "依赖名" 导入的文件，相对于 Dir
+	Entry string
+}
+
+// ResolveDependencies 解析 m 的依赖及依赖的依赖，按名称排序返回；
+// 所有依赖共用一个名字空间，同名依赖的内容不同时报错。
+// 归档解压到 cacheDir 下以哈希命名的目录中，不需要网络
+func ResolveDependencies(m *Manifest, cacheDir string) ([]*Package, error) {
+	resolved := map[string]*Package{}
+	queue := []*Manifest{m}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, name := range cur.dependencyNames() {
+			pkg, err := resolvePackage(cur.Dir, name, cur.Dependencies[name], cacheDir)
+			if err != nil {
+				return nil, fmt.Errorf("依赖 %s: %w", name, err)
+			}
+			if prev, ok := resolved[name]; ok {
+				if prev.Hash != pkg.Hash {
+					return nil, fmt.Errorf("依赖 %s 存在内容不同的两个来源: %s 与 %s", name, prev.Source, pkg.Source)
+				}
+				continue
+			}
+			resolved[name] = pkg
+			manifest, err := LoadManifest(pkg.Dir)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("依赖 %s: %w", name, err)
+			}
+			pkg.Version = manifest.Version
+			if manifest.Entry != "" {
+				pkg.Entry = manifest.Entry
+			}
+			queue = append(queue, manifest)
+		}
+	}
+	packages := make([]*Package, 0, len(resolved))
+	for _, pkg := range resolved {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	return packages, nil
+}
+
+func resolvePackage(dir, name, source, cacheDir string) (*Package, error) {
+	pkg := &Package{Name: name, Source: source, Entry: defaultEntry}
+	path := source
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("来源不存在: %s", source)
+	}
+	switch {
+	case info.IsDir():
+		pkg.Dir = path
+		pkg.Hash, err = hashDir(path)
+	case isArchive(path):
+		pkg.Hash, err = hashFile(path)
+		if err == nil {
+			pkg.Dir, err = extractArchive(path, filepath.Join(cacheDir, "deps", strings.TrimPrefix(pkg.Hash, "sha256:")))
+		}
+	default:
+		return nil, fmt.Errorf("来源须为目录或 .tar.gz 归档: %s", source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+func isArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashDir 按文件名顺序对每个文件的相对路径和内容哈希，跳过以 . 开头的文件和目录以及 knife.lock
+func hashDir(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || d.Name() == lockFile {
+			return nil
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		fmt.Fprintf(h, "%s\x00%s\n", filepath.ToSlash(rel), sum)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extractArchive 将归档解压到 target，已解压过时直接复用；
+// 归档中所有文件都在同一个顶层目录下时返回该目录
+func extractArchive(archive, target string) (string, error) {
+	if _, err := os.Stat(target); err != nil {
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", err
+		}
+		tmp, err := os.MkdirTemp(filepath.Dir(target), ".extract-*")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(tmp)
+		if err := untar(archive, tmp); err != nil {
+			return "", err
+		}
+		// 并发解压同一归档时保留先完成的结果
+		if err := os.Rename(tmp, target); err != nil {
+			if _, statErr := os.Stat(target); statErr != nil {
+				return "", err
+			}
+		}
+	}
+	entries, err := os.ReadDir(target)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(target, entries[0].Name()), nil
+	}
+	return target, nil
+}
+
+// untar 解压 .tar.gz 中的目录和普通文件，拒绝指向 dir 之外的路径
+func untar(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", archive, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", archive, err)
+		}
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("%s: 归档包含不安全的路径: %s", archive, header.Name)
+		}
+		path := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+		case tar.TypeReg:
+			err = writeArchiveFile(path, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeArchiveFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// lockEntry 为 knife.lock 中的一个依赖
+type lockEntry struct {
+	Version string
+	Source  string
+	Hash    string
+}
+
+func newLockEntry(pkg *Package) lockEntry {
+	return lockEntry{Version: pkg.Version, Source: pkg.Source, Hash: pkg.Hash}
+}
+
+// readLock 读取 dir 下的 knife.lock，文件不存在时返回 nil
+func readLock(dir string) (map[string]lockEntry, error) {
+	path := filepath.Join(dir, lockFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc, err := config.Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	lock := map[string]lockEntry{}
+	for name, table := range doc {
+		if name == "" {
+			continue
+		}
+		var entry lockEntry
+		for key, field := range map[string]*string{"version": &entry.Version, "source": &entry.Source, "hash": &entry.Hash} {
+			if *field, _, err = table.String(key); err != nil {
+				return nil, fmt.Errorf("%s: [%s] %w", path, name, err)
+			}
+		}
+		lock[name] = entry
+	}
+	return lock, nil
+}
+
+func writeLock(dir string, packages []*Package) error {
+	var b strings.Builder
+	b.WriteString("# 由 knife 生成，请勿手动修改\n")
+	for _, pkg := range packages {
+		fmt.Fprintf(&b, "\n[%s]\nversion = %q\nsource = %q\nhash = %q\n", pkg.Name, pkg.Version, pkg.Source, pkg.Hash)
+	}
+	return os.WriteFile(filepath.Join(dir, lockFile), []byte(b.String()), 0644)
+}
+
+// loadDependencies 解析项目的依赖并与 knife.lock 对照：新增或来源改变的依赖写入 knife.lock，
+// 来源不变而内容改变的依赖报错
+func loadDependencies(m *Manifest) ([]*Package, error) {
+	packages, err := ResolveDependencies(m, depsCacheDir())
+	if err != nil {
+		return nil, err
+	}
+	lock, err := readLock(m.Dir)
+	if err != nil {
+		return nil, err
+	}
+	changed := len(lock) != len(packages)
+	for _, pkg := range packages {
+		entry, ok := lock[pkg.Name]
+		if ok && entry.Source == pkg.Source && entry.Hash != pkg.Hash {
+			return nil, fmt.Errorf("依赖 %s 的内容与 %s 不一致，确认修改无误后执行 knife deps lock", pkg.Name, lockFile)
+		}
+		if !ok || entry != newLockEntry(pkg) {
+			changed = true
+		}
+	}
+	if !changed {
+		return packages, nil
+	}
+	return packages, writeLock(m.Dir, packages)
+}
+
+// depsCacheDir 返回解压归档的目录，没有缓存目录时使用临时目录
+func depsCacheDir() string {
+	if dir := DefaultCacheDir(); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "knife")
+}
+
+// ListDependencies 输出 dir 所在项目的依赖：名称、版本、来源和内容哈希
+func ListDependencies(dir string, w io.Writer) error {
+	m, err := projectManifest(dir)
+	if err != nil {
+		return err
+	}
+	packages, err := ResolveDependencies(m, depsCacheDir())
+	if err != nil {
+		return err
+	}
+	for _, pkg := range packages {
+		version := pkg.Version
+		if version == "" {
+			version = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", pkg.Name, version, pkg.Source, pkg.Hash)
+	}
+	return nil
+}
+
+// VerifyDependencies 检查依赖与 knife.lock 是否一致，输出每个依赖的结果，不修改 knife.lock
+func VerifyDependencies(dir string, w io.Writer) error {
+	m, err := projectManifest(dir)
+	if err != nil {
+		return err
+	}
+	packages, err := ResolveDependencies(m, depsCacheDir())
+	if err != nil {
+		return err
+	}
+	lock, err := readLock(m.Dir)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return fmt.Errorf("缺少 %s，请先执行 knife deps lock", lockFile)
+	}
+	failed := 0
+	for _, pkg := range packages {
+		entry, ok := lock[pkg.Name]
+		delete(lock, pkg.Name)
+		var problem string
+		switch {
+		case !ok:
+			problem = "未记录在 " + lockFile + " 中"
+		case entry.Source != pkg.Source:
+			problem = fmt.Sprintf("来源由 %s 变为 %s", entry.Source, pkg.Source)
+		case entry.Hash != pkg.Hash:
+			problem = fmt.Sprintf("内容哈希为 %s，%s 中为 %s", pkg.Hash, lockFile, entry.Hash)
+		}
+		if problem == "" {
+			fmt.Fprintf(w, "ok\t%s\n", pkg.Name)
+			continue
+		}
+		fmt.Fprintf(w, "FAIL\t%s\t%s\n", pkg.Name, problem)
+		failed++
+	}
+	for _, name := range sortedKeys(lock) {
+		fmt.Fprintf(w, "FAIL\t%s\t已不再被依赖\n", name)
+		failed++
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个依赖与 %s 不一致", failed, lockFile)
+	}
+	return nil
+}
+
+// LockDependencies 按依赖的当前内容重新生成 knife.lock
+func LockDependencies(dir string) error {
+	m, err := projectManifest(dir)
+	if err != nil {
+		return err
+	}
+	packages, err := ResolveDependencies(m, depsCacheDir())
+	if err != nil {
+		return err
+	}
+	return writeLock(m.Dir, packages)
+}
+
+func projectManifest(dir string) (*Manifest, error) {
+	m, err := findManifest(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s 及其上级目录中没有 %s", dir, manifestFile)
+	}
+	return m, err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeArchive 将 files 写入 .tar.gz 归档 path
+func writeArchive(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedKeys(files) {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(files[name]))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	t.Setenv("KNIFE_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app/knife.toml": "name = \"app\"\nentry = \"src/main.k\"\n\n[dependencies]\nstrs = \"../strs\"\ntools = \"vendor/tools-1.0.0.tar.gz\"\n",
+		"app/src/main.k": "import \"strs\" as s\nimport { twice } from \"tools\"\nassert(s.shout(\"a\") == \"a!\")\nassert(twice(2) == 4)\n",
+		"strs/knife.toml": "name = \"strs\"\nversion = \"0.2.0\"\nentry = \"lib.k\"\n\n" +
+			"[dependencies]\ntools = \"../app/vendor/tools-1.0.0.tar.gz\"\n",
+		"strs/lib.k":       "import { bang } from \"util/bang\"\nimport { twice } from \"tools\"\nexport func shout(x) {\n return x + bang(twice(0))\n}\n",
+		"strs/util/bang.k": "export func bang(n) {\n return \"!\"\n}\n",
+	})
+	writeArchive(t, filepath.Join(dir, "app/vendor/tools-1.0.0.tar.gz"), map[string]string{
+		"tools-1.0.0/knife.toml": "name = \"tools\"\nversion = \"1.0.0\"\n",
+		"tools-1.0.0/main.k":     "export func twice(x) {\n return x * 2\n}\n",
+	})
+	app := filepath.Join(dir, "app")
+	t.Chdir(app)
+
+	for _, engine := range []string{EngineTree, EngineVM} {
+		if code, _, stderr := runMain("", "run", "--engine="+engine); code != 0 {
+			t.Fatalf("%s: run failed: %s", engine, stderr)
+		}
+	}
+	lock, err := os.ReadFile(filepath.Join(app, lockFile))
+	if err != nil || !strings.Contains(string(lock), "[strs]\nversion = \"0.2.0\"\nsource = \"../strs\"\nhash = \"sha256:") {
+		t.Fatalf("expected knife.lock to record strs, got %s (%v)", lock, err)
+	}
+	code, stdout, stderr := runMain("", "deps", "list")
+	if code != 0 || !strings.Contains(stdout, "strs\t0.2.0\t../strs\tsha256:") || !strings.Contains(stdout, "tools\t1.0.0\tvendor/tools-1.0.0.tar.gz\tsha256:") {
+		t.Fatalf("unexpected deps list, exit %d: %s%s", code, stdout, stderr)
+	}
+	if code, stdout, stderr := runMain("", "deps", "verify"); code != 0 {
+		t.Fatalf("expected verify to pass, got exit %d: %s%s", code, stdout, stderr)
+	}
+
+	os.WriteFile(filepath.Join(dir, "strs/util/bang.k"), []byte("export func bang(n) {\n return \"!!\"\n}\n"), 0644)
+	if code, _, stderr := runMain("", "run"); code != 1 || !strings.Contains(stderr, "依赖 strs 的内容与 knife.lock 不一致") {
+		t.Fatalf("expected a lock mismatch, got exit %d: %s", code, stderr)
+	}
+	if code, stdout, _ := runMain("", "deps", "verify", app); code != 1 || !strings.Contains(stdout, "FAIL\tstrs\t内容哈希为") || !strings.Contains(stdout, "ok\ttools") {
+		t.Fatalf("expected verify to fail for strs, got exit %d: %s", code, stdout)
+	}
+	if code, _, stderr := runMain("", "deps", "lock"); code != 0 {
+		t.Fatalf("deps lock failed: %s", stderr)
+	}
+	if code, stdout, _ := runMain("", "deps", "verify"); code != 0 {
+		t.Fatalf("expected verify to pass after deps lock: %s", stdout)
+	}
+	if code, _, stderr := runMain("", "run", "src/main.k"); code != 1 || !strings.Contains(stderr, "assertion failed") {
+		t.Fatalf("expected the changed dependency to fail the assert, got exit %d: %s", code, stderr)
+	}
+}
+
+func TestDependencyErrors(t *testing.T) {
+	t.Setenv("KNIFE_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	writeArchive(t, filepath.Join(dir, "vendor/evil.tar.gz"), map[string]string{"../evil.k": "print(1)\n"})
+	tests := []struct {
+		manifest string
+		expected string
+	}{
+		{"[dependencies]\nevil = \"vendor/evil.tar.gz\"\n", "归档包含不安全的路径: ../evil.k"},
+		{"[dependencies]\nnothing = \"../nothing\"\n", "依赖 nothing: 来源不存在: ../nothing"},
+		{"[dependencies]\nmain = \"main.k\"\n", "来源须为目录或 .tar.gz 归档"},
+		{"[dependencies]\n\"a/b\" = \"vendor\"\n", "依赖名只能包含"},
+		{"nmae = \"typo\"\n", "未知的清单字段: nmae"},
+	}
+	os.WriteFile(filepath.Join(dir, "main.k"), []byte("print(1)\n"), 0644)
+	for _, tt := range tests {
+		os.WriteFile(filepath.Join(dir, manifestFile), []byte(tt.manifest), 0644)
+		if code, _, stderr := runMain("", "run", filepath.Join(dir, "main.k")); code != 1 || !strings.Contains(stderr, tt.expected) {
+			t.Errorf("%q: expected %q, got exit %d: %s", tt.manifest, tt.expected, code, stderr)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "evil.k")); err == nil {
+		t.Fatal("the archive was extracted outside of its directory")
+	}
+}
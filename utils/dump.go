@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Serein-sz/knife/ast"
+)
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// dumpNode 以缩进形式输出节点及其子节点，字符串字段直接显示在节点名后
+func dumpNode(w io.Writer, label string, node ast.Node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if label != "" {
+		label += ": "
+	}
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		fmt.Fprintf(w, "%s%snil\n", indent, label)
+		return
+	}
+	name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	var attrs []string
+	if _, ok := node.(*ast.Program); !ok {
+		attrs = append(attrs, fmt.Sprintf("line=%d", node.Line()))
+	}
+	attrs = append(attrs, nodeAttributes(node)...)
+	fmt.Fprintf(w, "%s%s%s\n", indent, label, strings.TrimSpace(name+" "+strings.Join(attrs, " ")))
+	for _, c := range nodeChildren(node) {
+		if c.list {
+			fmt.Fprintf(w, "%s  %s: [%d]\n", indent, c.label, len(c.nodes))
+			for _, n := range c.nodes {
+				dumpNode(w, "", n, depth+2)
+			}
+			continue
+		}
+		dumpNode(w, c.label, c.nodes[0], depth+1)
+	}
+}
+
+type dumpChild struct {
+	label string
+	list  bool
+	nodes []ast.Node
+}
+
+func nodeChildren(node ast.Node) []dumpChild {
+	var children []dumpChild
+	v := reflect.ValueOf(node).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		switch {
+		case f.Type().Implements(nodeType):
+			n, _ := f.Interface().(ast.Node)
+			children = append(children, dumpChild{label: t.Field(i).Name, nodes: []ast.Node{n}})
+		case f.Kind() == reflect.Slice && f.Type().Elem().Implements(nodeType):
+			c := dumpChild{label: t.Field(i).Name, list: true}
+			for j := 0; j < f.Len(); j++ {
+				c.nodes = append(c.nodes, f.Index(j).Interface().(ast.Node))
+			}
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+func nodeAttributes(node ast.Node) []string {
+	var attrs []string
+	v := reflect.ValueOf(node).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if f := v.Field(i); f.Kind() == reflect.String {
+			attrs = append(attrs, fmt.Sprintf("%s=%q", t.Field(i).Name, f.String()))
+		}
+	}
+	sort.Strings(attrs)
+	return attrs
+}
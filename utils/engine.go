@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/compiler"
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/eval"
+	"github.com/Serein-sz/knife/stdlib"
+	"github.com/Serein-sz/knife/vm"
+)
+
+// 可选的执行引擎
+const (
+	// EngineTree 直接遍历语法树执行，为默认引擎
+	EngineTree = "tree"
+	// EngineVM 先编译为字节码再由虚拟机执行
+	EngineVM = "vm"
+)
+
+// engine 执行解析后的程序，并可调用程序中定义的函数
+type engine interface {
+	run(program *ast.Program, env *environment.Environment) error
+	call(fn environment.Object) error
+	// globals 返回新的全局环境，其上级为执行过标准库的环境
+	globals() *environment.Environment
+}
+
+// newEngine 返回执行引擎，脚本中的 import 由同一引擎加载，相对于入口文件 entry 查找
+func newEngine(opts RunOptions, entry string) (engine, error) {
+	dir, err := scriptDir(entry)
+	if err != nil {
+		return nil, err
+	}
+	switch opts.Engine {
+	case "", EngineTree:
+		interpreter := eval.New()
+		interpreter.Permissions = opts.Permissions
+		interpreter.Stdout, interpreter.Stderr = opts.Stdout, opts.Stderr
+		interpreter.Dir = dir
+		e := treeEngine{Interpreter: interpreter, prelude: &prelude{}}
+		if err := e.loadPrelude(e); err != nil {
+			return nil, err
+		}
+		importer, err := newModules(entry, e, opts.Optimize)
+		if err != nil {
+			return nil, err
+		}
+		interpreter.Importer = importer
+		return e, nil
+	case EngineVM:
+		machine := vm.New()
+		machine.Permissions = opts.Permissions
+		machine.Stdout, machine.Stderr = opts.Stdout, opts.Stderr
+		machine.Dir = dir
+		e := vmEngine{VM: machine, prelude: &prelude{}}
+		if err := e.loadPrelude(e); err != nil {
+			return nil, err
+		}
+		importer, err := newModules(entry, e, opts.Optimize)
+		if err != nil {
+			return nil, err
+		}
+		machine.Importer = importer
+		return e, nil
+	}
+	return nil, fmt.Errorf("未知的执行引擎: %s，可选 %s 或 %s", opts.Engine, EngineTree, EngineVM)
+}
+
+// scriptDir 返回 fs 内置函数解析相对路径的目录，即入口文件所在的目录，
+// 从标准输入读取时为当前目录
+func scriptDir(entry string) (string, error) {
+	if entry == "-" {
+		return os.Getwd()
+	}
+	abs, err := filepath.Abs(entry)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(abs), nil
+}
+
+// prelude 为执行过标准库的环境，由两种引擎共用
+type prelude struct {
+	env *environment.Environment
+}
+
+// loadPrelude 由 e 在新环境中执行标准库
+func (p *prelude) loadPrelude(e engine) error {
+	programs, err := stdlib.Programs()
+	if err != nil {
+		return err
+	}
+	p.env = environment.NewEnvironment(nil)
+	for _, program := range programs {
+		if err := e.run(program, p.env); err != nil {
+			return fmt.Errorf("标准库: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *prelude) globals() *environment.Environment {
+	return environment.NewEnvironment(p.env)
+}
+
+type treeEngine struct {
+	*eval.Interpreter
+	*prelude
+}
+
+func (e treeEngine) run(program *ast.Program, env *environment.Environment) error {
+	_, err := e.Eval(context.Background(), program, env)
+	return err
+}
+
+func (e treeEngine) call(fn environment.Object) error {
+	_, err := e.Call(context.Background(), fn)
+	return err
+}
+
+type vmEngine struct {
+	*vm.VM
+	*prelude
+}
+
+func (e vmEngine) run(program *ast.Program, env *environment.Environment) error {
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		return err
+	}
+	return e.runBytecode(bytecode, env)
+}
+
+func (e vmEngine) runBytecode(bytecode *compiler.Bytecode, env *environment.Environment) error {
+	_, err := e.Run(context.Background(), bytecode, env)
+	return err
+}
+
+func (e vmEngine) call(fn environment.Object) error {
+	_, err := e.Call(context.Background(), fn)
+	return err
+}
+
+// parameterCount 返回脚本函数的参数个数，obj 不是脚本函数时 ok 为假
+func parameterCount(obj environment.Object) (n int, ok bool) {
+	switch f := obj.(type) {
+	case *environment.FunctionDefine:
+		return len(f.Parameters), true
+	case *environment.Closure:
+		return f.Fn.Parameters, true
+	}
+	return 0, false
+}
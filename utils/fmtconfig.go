@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Serein-sz/knife/config"
+	"github.com/Serein-sz/knife/printer"
+)
+
+const (
+	formatConfigFile = ".knifefmt"
+	manifestFile     = "knife.toml"
+)
+
+// LoadFormatConfig 从 dir 开始逐级向上查找 .knifefmt 或 knife.toml 中的 [fmt] 段，
+// 同一目录下 .knifefmt 优先，找不到时返回默认配置
+func LoadFormatConfig(dir string) (printer.Config, error) {
+	cfg := printer.DefaultConfig()
+	table, path, err := findConfig(dir, formatConfigFile, "fmt")
+	if err != nil || table == nil {
+		return cfg, err
+	}
+	if err := applyFormatConfig(table, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// findConfig 从 dir 开始逐级向上查找配置，返回 dotfile 的配置（顶层或 [section] 段）或
+// knife.toml 中 section 段的内容及其所在文件，都找不到时 table 为 nil
+func findConfig(dir, dotfile, section string) (table config.Table, path string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		for _, name := range []string{dotfile, manifestFile} {
+			path := filepath.Join(dir, name)
+			data, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, path, err
+			}
+			doc, err := config.Parse(string(data))
+			if err != nil {
+				return nil, path, fmt.Errorf("%s: %w", path, err)
+			}
+			if name == manifestFile {
+				if doc[section] == nil {
+					continue
+				}
+				return doc[section], path, nil
+			}
+			table, err := dotfileTable(doc, section)
+			if err != nil {
+				return nil, path, fmt.Errorf("%s: %w", path, err)
+			}
+			return table, path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, "", nil
+		}
+		dir = parent
+	}
+}
+
+// dotfileTable 返回 dotfile 的配置：顶层的键与 [section] 段合并，
+// 两处重复的键或其他段都报错
+func dotfileTable(doc config.Document, section string) (config.Table, error) {
+	table := config.Table{}
+	for name, t := range doc {
+		if name != "" && name != section {
+			return nil, fmt.Errorf("未知的配置段: [%s]", name)
+		}
+		for key, v := range t {
+			if _, ok := table[key]; ok {
+				return nil, fmt.Errorf("重复的配置项: %s", key)
+			}
+			table[key] = v
+		}
+	}
+	return table, nil
+}
+
+func applyFormatConfig(table config.Table, cfg *printer.Config) error {
+	for key := range table {
+		switch key {
+		case "indent", "max_line_length", "semicolons", "quote_style", "trailing_commas":
+		default:
+			return fmt.Errorf("未知的格式化选项: %s", key)
+		}
+	}
+	if v, ok, err := table.Int("indent"); err != nil {
+		return err
+	} else if ok {
+		cfg.IndentWidth = v
+	}
+	if v, ok, err := table.Int("max_line_length"); err != nil {
+		return err
+	} else if ok {
+		cfg.MaxLineLength = v
+	}
+	if v, ok, err := table.String("semicolons"); err != nil {
+		return err
+	} else if ok {
+		switch policy := printer.SemicolonPolicy(v); policy {
+		case printer.SemicolonsNever, printer.SemicolonsAlways:
+			cfg.Semicolons = policy
+		default:
+			return fmt.Errorf("semicolons: 可选值为 never 或 always")
+		}
+	}
+	if v, ok, err := table.String("quote_style"); err != nil {
+		return err
+	} else if ok {
+		switch style := printer.QuoteStyle(v); style {
+		case printer.QuoteDouble, printer.QuoteSingle:
+			cfg.Quotes = style
+		default:
+			return fmt.Errorf("quote_style: 可选值为 double 或 single")
+		}
+	}
+	if v, ok, err := table.String("trailing_commas"); err != nil {
+		return err
+	} else if ok {
+		switch v {
+		case "never":
+			cfg.TrailingCommas = false
+		case "multiline":
+			cfg.TrailingCommas = true
+		default:
+			return fmt.Errorf("trailing_commas: 可选值为 never 或 multiline")
+		}
+	}
+	return nil
+}
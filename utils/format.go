@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/Serein-sz/knife/printer"
+)
+
+// FormatOptions 控制格式化结果的输出方式
+type FormatOptions struct {
+	// Check 只列出未格式化的文件，不写入
+	Check bool
+	// Diff 输出统一格式的差异，不写入
+	Diff   bool
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+type formatJob struct {
+	path string
+	cfg  printer.Config
+}
+
+type formatResult struct {
+	path      string
+	src       string
+	formatted string
+	err       error
+}
+
+// Format 格式化.k文件或递归格式化文件夹中的.k文件，路径为 - 时从标准输入读取并输出到标准输出
+// 语法错误的文件不会被改写
+// 作者: 王强
+// 日期: 2025-04-30
+// 版本: 1.0.1
+func Format(path string, opts FormatOptions) error {
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+
+	var jobs []formatJob
+	configs := map[string]printer.Config{}
+	err := walkSources(path, func(filePath string) error {
+		dir := filepath.Dir(filePath)
+		if filePath == "-" {
+			dir = "."
+		}
+		cfg, ok := configs[dir]
+		if !ok {
+			var err error
+			if cfg, err = LoadFormatConfig(dir); err != nil {
+				return err
+			}
+			configs[dir] = cfg
+		}
+		jobs = append(jobs, formatJob{path: filePath, cfg: cfg})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	results := formatFiles(jobs, opts.Stdin)
+	var unformatted, failed int
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			fmt.Fprintf(opts.Stderr, "%s: %v\n", r.path, strings.TrimRight(r.err.Error(), "\n"))
+			continue
+		}
+		if r.path == "-" && !opts.Check && !opts.Diff {
+			io.WriteString(opts.Stdout, r.formatted)
+			continue
+		}
+		if r.formatted == r.src {
+			continue
+		}
+		unformatted++
+		switch {
+		case opts.Check:
+			fmt.Fprintln(opts.Stdout, r.path)
+		case opts.Diff:
+			UnifiedDiff(opts.Stdout, r.path, r.src, r.formatted)
+		default:
+			if err := WriteFile(r.path, r.formatted); err != nil {
+				failed++
+				fmt.Fprintf(opts.Stderr, "%s: %v\n", r.path, err)
+			}
+		}
+	}
+
+	var errs []error
+	if failed > 0 {
+		errs = append(errs, fmt.Errorf("%d 个文件格式化失败", failed))
+	}
+	if opts.Check && unformatted > 0 {
+		errs = append(errs, fmt.Errorf("%d 个文件未格式化", unformatted))
+	}
+	return errors.Join(errs...)
+}
+
+// formatFiles 并行格式化文件，结果顺序与 jobs 一致
+func formatFiles(jobs []formatJob, stdin io.Reader) []formatResult {
+	results := make([]formatResult, len(jobs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.NumCPU(), len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = formatFile(jobs[i], stdin)
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return results
+}
+
+func formatFile(job formatJob, stdin io.Reader) formatResult {
+	res := formatResult{path: job.path}
+	res.src, res.err = readSource(job.path, stdin)
+	if res.err != nil {
+		return res
+	}
+	res.formatted, res.err = printer.Format(res.src, job.cfg)
+	return res
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.k":     "let a =   1\n",
+		"b.k":     "let b = 2\n",
+		"bad.k":   "print(1 +)\n",
+		"sub/c.k": "func f(x){ return x }\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(src), 0644)
+	}
+
+	var stdout, stderr bytes.Buffer
+	opts := FormatOptions{Check: true, Stdout: &stdout, Stderr: &stderr}
+	if err := Format(dir, opts); err == nil {
+		t.Fatalf("expected --check to fail")
+	}
+	expected := filepath.Join(dir, "a.k") + "\n" + filepath.Join(dir, "sub", "c.k") + "\n"
+	if stdout.String() != expected {
+		t.Fatalf("expected=%q, got=%q", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	opts = FormatOptions{Diff: true, Stdout: &stdout, Stderr: &stderr}
+	Format(filepath.Join(dir, "a.k"), opts)
+	if !strings.Contains(stdout.String(), "-let a =   1\n+let a = 1\n") {
+		t.Fatalf("unexpected diff:\n%s", stdout.String())
+	}
+
+	stderr.Reset()
+	if err := Format(dir, FormatOptions{Stdout: &stdout, Stderr: &stderr}); err == nil {
+		t.Fatalf("expected parse error to be reported")
+	}
+	for name, src := range files {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		if name == "bad.k" && string(data) != src {
+			t.Fatalf("file with parse errors was rewritten: %q", data)
+		}
+		if name == "a.k" && string(data) != "let a = 1\n" {
+			t.Fatalf("a.k was not formatted: %q", data)
+		}
+	}
+
+	stdout.Reset()
+	opts = FormatOptions{Stdin: strings.NewReader("let x =  2"), Stdout: &stdout, Stderr: &stderr}
+	if err := Format("-", opts); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "let x = 2\n" {
+		t.Fatalf("unexpected stdin output: %q", stdout.String())
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	var out bytes.Buffer
+	UnifiedDiff(&out, "f.k", a, b)
+	expected := `--- f.k
++++ f.k
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`
+	if out.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestFormatConfigAndIgnore(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"knife.toml":           "name = \"demo\"\n\n[fmt]\nindent = 2\n",
+		".knifeignore":         "# generated code\ngen/\nskip_*.k\n",
+		"src/a.k":              "func f(){ return 1 }\n",
+		"src/skip_me.k":        "let   a = 1\n",
+		"gen/b.k":              "let   b = 2\n",
+		"strict/.knifefmt":     "semicolons = \"always\"\n",
+		"strict/c.k":           "let c =  3\n",
+		"broken/.knifefmt":     "indent = \"wide\"\n",
+		"broken/unformatted.k": "let d = 4\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(src), 0644)
+	}
+
+	var stdout, stderr bytes.Buffer
+	opts := FormatOptions{Stdout: &stdout, Stderr: &stderr}
+	if err := Format(filepath.Join(dir, "broken"), opts); err == nil {
+		t.Fatalf("expected invalid .knifefmt to be reported")
+	}
+	os.RemoveAll(filepath.Join(dir, "broken"))
+
+	if err := Format(dir, opts); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, stderr.String())
+	}
+	expected := map[string]string{
+		"src/a.k":       "func f() {\n  return 1\n}\n",
+		"src/skip_me.k": "let   a = 1\n",
+		"gen/b.k":       "let   b = 2\n",
+		"strict/c.k":    "let c = 3;\n",
+	}
+	for name, want := range expected {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		if string(data) != want {
+			t.Fatalf("%s: expected=%q, got=%q", name, want, data)
+		}
+	}
+}
+
+func TestFormatConfigSection(t *testing.T) {
+	tests := []struct {
+		src    string
+		indent int
+		err    string
+	}{
+		{"[fmt]\nindent = 2\n", 2, ""},
+		{"max_line_length = 100\n\n[fmt]\nindent = 3\n", 3, ""},
+		{"[format]\nindent = 2\n", 0, "未知的配置段: [format]"},
+		{"indent = 2\n\n[fmt]\nindent = 3\n", 0, "重复的配置项: indent"},
+	}
+	for i, tt := range tests {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, ".knifefmt"), []byte(tt.src), 0644)
+		cfg, err := LoadFormatConfig(dir)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("tests[%d] - expected error %q, got=%v", i, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || cfg.IndentWidth != tt.indent {
+			t.Fatalf("tests[%d] - expected indent %d, got %d (%v)", i, tt.indent, cfg.IndentWidth, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const ignoreFile = ".knifeignore"
+
+type ignorePattern struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreList 对应一个 .knifeignore 文件，语法与 .gitignore 的常用部分一致
+type ignoreList struct {
+	dir      string
+	patterns []ignorePattern
+}
+
+// loadIgnore 从 dir 开始逐级向上查找最近的 .knifeignore，找不到时返回 nil
+func loadIgnore(dir string) (*ignoreList, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, ignoreFile))
+		if err == nil {
+			return parseIgnore(dir, string(data)), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+func parseIgnore(dir, src string) *ignoreList {
+	l := &ignoreList{dir: dir}
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p ignorePattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		p.pattern = line
+		l.patterns = append(l.patterns, p)
+	}
+	return l
+}
+
+// match 判断 filePath 是否被忽略，后出现的规则优先
+func (l *ignoreList) match(filePath string, isDir bool) bool {
+	if l == nil {
+		return false
+	}
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(l.dir, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	ignored := false
+	for _, p := range l.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		var ok bool
+		if p.anchored {
+			ok, _ = path.Match(p.pattern, rel)
+		} else {
+			ok, _ = path.Match(p.pattern, path.Base(rel))
+		}
+		if ok {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
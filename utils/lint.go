@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Serein-sz/knife/config"
+	"github.com/Serein-sz/knife/lint"
+)
+
+const lintConfigFile = ".knifelint"
+
+// LintOptions 控制静态检查结果的输出方式
+type LintOptions struct {
+	// Format 为 text、json 或 sarif
+	Format string
+	Stdin  io.Reader
+	Stdout io.Writer
+}
+
+// Lint 对文件或文件夹中的.k文件做静态检查，路径为 - 时从标准输入读取，
+// 发现问题时返回错误
+func Lint(paths []string, opts LintOptions) error {
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	write := lint.WriteText
+	switch opts.Format {
+	case "", "text":
+	case "json":
+		write = lint.WriteJSON
+	case "sarif":
+		write = func(w io.Writer, diagnostics []lint.Diagnostic) error {
+			return lint.WriteSARIF(w, diagnostics, Version)
+		}
+	default:
+		return fmt.Errorf("未知的输出格式: %s", opts.Format)
+	}
+
+	var diagnostics []lint.Diagnostic
+	linters := map[string]*lint.Linter{}
+	for _, path := range paths {
+		err := walkSources(path, func(filePath string) error {
+			dir := filepath.Dir(filePath)
+			if filePath == "-" {
+				dir = "."
+			}
+			linter, ok := linters[dir]
+			if !ok {
+				cfg, err := LoadLintConfig(dir)
+				if err != nil {
+					return err
+				}
+				if linter, err = lint.New(cfg); err != nil {
+					return err
+				}
+				linters[dir] = linter
+			}
+			src, err := readSource(filePath, opts.Stdin)
+			if err != nil {
+				return err
+			}
+			diagnostics = append(diagnostics, linter.LintSource(filePath, src)...)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := write(opts.Stdout, diagnostics); err != nil {
+		return err
+	}
+	if len(diagnostics) > 0 {
+		return fmt.Errorf("发现 %d 个问题", len(diagnostics))
+	}
+	return nil
+}
+
+// LoadLintConfig 从 dir 开始逐级向上查找 .knifelint 或 knife.toml 中的 [lint] 段，
+// 每个键为规则名，值为 true/false 或 "error"、"warning"、"off"
+func LoadLintConfig(dir string) (lint.Config, error) {
+	cfg := lint.Config{Rules: map[string]lint.Severity{}}
+	table, path, err := findConfig(dir, lintConfigFile, "lint")
+	if err != nil || table == nil {
+		return cfg, err
+	}
+	if err := applyLintConfig(table, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func applyLintConfig(table config.Table, cfg *lint.Config) error {
+	rules := map[string]lint.Rule{}
+	for _, r := range lint.Rules() {
+		rules[r.Name()] = r
+	}
+	for name, value := range table {
+		r, ok := rules[name]
+		if !ok {
+			return fmt.Errorf("未知的检查规则: %s", name)
+		}
+		switch v := value.(type) {
+		case bool:
+			if v {
+				cfg.Rules[name] = r.Severity()
+			} else {
+				cfg.Rules[name] = lint.SeverityOff
+			}
+		case string:
+			switch severity := lint.Severity(v); severity {
+			case lint.SeverityError, lint.SeverityWarning, lint.SeverityOff:
+				cfg.Rules[name] = severity
+			default:
+				return fmt.Errorf("%s: 可选值为 error、warning 或 off", name)
+			}
+		default:
+			return fmt.Errorf("%s: 应为布尔值或字符串", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.k"), []byte("let unused = 1\nfoo()\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "knife.toml"), []byte("[lint]\nunused-variable = false\n"), 0644)
+
+	code, stdout, _ := runMain("", "lint", dir)
+	if code != 1 || strings.Contains(stdout, "unused-variable") || !strings.Contains(stdout, "undefined-call") {
+		t.Fatalf("unexpected lint result %d:\n%s", code, stdout)
+	}
+
+	os.WriteFile(filepath.Join(dir, ".knifelint"), []byte("unused-variable = false\nundefined-call = \"off\"\n"), 0644)
+	if code, stdout, _ := runMain("", "lint", "--format=json", dir); code != 0 || stdout != "[]\n" {
+		t.Fatalf("expected a clean json report, got %d: %s", code, stdout)
+	}
+
+	os.WriteFile(filepath.Join(dir, ".knifelint"), []byte("no-such-rule = true\n"), 0644)
+	if code, _, stderr := runMain("", "lint", dir); code != 1 || !strings.Contains(stderr, "no-such-rule") {
+		t.Fatalf("expected unknown rule error, got %d: %s", code, stderr)
+	}
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Serein-sz/knife/config"
+)
+
+// Manifest 为 knife.toml 中描述项目的字段：
+//
+//	name = "app"
+//	version = "0.1.0"
+//	entry = "src/main.k"
+//
+//	[dependencies]
+//	strings = "../strings"               # 本地目录
+//	json = "vendor/json-1.2.0.tar.gz"    # 归档
+type Manifest struct {
+	// Dir 为 knife.toml 所在的目录
+	Dir     string
+	Name    string
+	Version string
+	// Entry 为入口文件，相对于 Dir；knife run 未指定文件时执行它，
+	// 作为依赖时为 import "依赖名" 导入的文件
+	Entry string
+	// Dependencies 为依赖名到来源的映射，来源为本地目录或 .tar.gz 归档，相对于 Dir
+	Dependencies map[string]string
+}
+
+// defaultEntry 为清单未指定 entry 时的入口文件
+const defaultEntry = "main.k"
+
+// LoadManifest 读取 dir 下的 knife.toml，文件不存在时返回的错误满足 errors.Is(err, os.ErrNotExist)
+func LoadManifest(dir string) (*Manifest, error) {
+	path := filepath.Join(dir, manifestFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := config.Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m := &Manifest{Dir: dir, Dependencies: map[string]string{}}
+	if err := m.apply(doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// findManifest 从 dir 开始逐级向上查找并读取 knife.toml
+func findManifest(dir string) (*Manifest, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return LoadManifest(projectRoot(dir))
+}
+
+func (m *Manifest) apply(doc config.Document) error {
+	top := doc[""]
+	for key := range top {
+		switch key {
+		case "name", "version", "entry":
+		default:
+			return fmt.Errorf("未知的清单字段: %s", key)
+		}
+	}
+	for key, field := range map[string]*string{"name": &m.Name, "version": &m.Version, "entry": &m.Entry} {
+		v, _, err := top.String(key)
+		if err != nil {
+			return err
+		}
+		*field = v
+	}
+	deps := doc["dependencies"]
+	for name := range deps {
+		if !validPackageName(name) {
+			return fmt.Errorf("依赖名只能包含字母、数字、_ 和 -，且不能以数字或 - 开头: %s", name)
+		}
+		source, _, err := deps.String(name)
+		if err != nil {
+			return err
+		}
+		if source == "" {
+			return fmt.Errorf("依赖 %s 未指定来源", name)
+		}
+		m.Dependencies[name] = source
+	}
+	return nil
+}
+
+// dependencyNames 按名称排序返回依赖名
+func (m *Manifest) dependencyNames() []string {
+	names := make([]string, 0, len(m.Dependencies))
+	for name := range m.Dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validPackageName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case i > 0 && (c == '-' || '0' <= c && c <= '9'):
+		default:
+			return false
+		}
+	}
+	return true
+}
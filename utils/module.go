@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/eval"
+	"github.com/Serein-sz/knife/optimizer"
+)
+
+// modules 为脚本加载 import 的模块：以 ./ 或 ../ 开头的路径相对于导入它的文件，
+// 第一段为依赖名的路径在该依赖中查找，只有依赖名时导入依赖的入口文件，
+// 其余相对于导入它的文件所属的项目或依赖的根目录，省略扩展名时补上 .k；
+// 每个文件只执行一次，结果按绝对路径缓存，导入尚未执行完的文件时报告循环导入
+type modules struct {
+	// root 为项目根目录：入口文件向上最近的含 knife.toml 的目录，没有时为入口文件所在目录
+	root string
+	// packages 为 knife.toml 中声明的依赖，以依赖名为键
+	packages map[string]*Package
+	engine   engine
+	optimize bool
+	cache    map[string]*environment.Module
+	// loading 为正在执行的文件，最后一个为当前文件
+	loading []string
+}
+
+// newModules 返回以 entry 为入口文件的模块加载器，entry 为 - 时以当前目录为准；
+// 项目有 knife.toml 时解析其中的依赖并与 knife.lock 对照
+func newModules(entry string, e engine, optimize bool) (*modules, error) {
+	if entry == "-" {
+		entry = "<stdin>"
+	}
+	entry, err := filepath.Abs(entry)
+	if err != nil {
+		entry = filepath.Clean(entry)
+	}
+	m := &modules{
+		root:     projectRoot(filepath.Dir(entry)),
+		packages: map[string]*Package{},
+		engine:   e,
+		optimize: optimize,
+		cache:    map[string]*environment.Module{},
+		loading:  []string{entry},
+	}
+	manifest, err := LoadManifest(m.root)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	packages, err := loadDependencies(manifest)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range packages {
+		m.packages[pkg.Name] = pkg
+	}
+	return m, nil
+}
+
+// projectRoot 从 dir 开始逐级向上查找 knife.toml 所在的目录，找不到时返回 dir
+func projectRoot(dir string) string {
+	for cur := dir; ; {
+		if _, err := os.Stat(filepath.Join(cur, manifestFile)); err == nil {
+			return cur
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return dir
+		}
+		cur = parent
+	}
+}
+
+func (m *modules) Import(path string) (*environment.Module, error) {
+	file := m.resolve(path)
+	if mod, ok := m.cache[file]; ok {
+		return mod, nil
+	}
+	for i, loading := range m.loading {
+		if loading == file {
+			cycle := make([]string, 0, len(m.loading)-i+1)
+			for _, f := range append(m.loading[i:], file) {
+				cycle = append(cycle, m.rel(f))
+			}
+			return nil, fmt.Errorf("循环导入: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	src, err := ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("模块不存在: %s", m.rel(file))
+	}
+	if err != nil {
+		return nil, err
+	}
+	program, err := parseWith(src, predeclared()...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.rel(file), err)
+	}
+	if m.optimize {
+		optimizer.Optimize(program)
+	}
+	env := m.engine.globals()
+	m.loading = append(m.loading, file)
+	err = m.engine.run(program, env)
+	m.loading = m.loading[:len(m.loading)-1]
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.rel(file), err)
+	}
+	mod := &environment.Module{Path: m.rel(file), Exports: eval.Exports(program, env)}
+	m.cache[file] = mod
+	return mod, nil
+}
+
+func (m *modules) resolve(path string) string {
+	var file string
+	switch {
+	case filepath.IsAbs(path):
+		file = path
+	case strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../"):
+		file = filepath.Join(filepath.Dir(m.current()), path)
+	default:
+		name, rest, _ := strings.Cut(path, "/")
+		if pkg, ok := m.packages[name]; ok {
+			if rest == "" {
+				rest = pkg.Entry
+			}
+			file = filepath.Join(pkg.Dir, rest)
+		} else if pkg := m.packageOf(m.current()); pkg != nil {
+			file = filepath.Join(pkg.Dir, path)
+		} else {
+			file = filepath.Join(m.root, path)
+		}
+	}
+	if filepath.Ext(file) == "" {
+		file += ".k"
+	}
+	return filepath.Clean(file)
+}
+
+// current 返回正在执行的文件
+func (m *modules) current() string {
+	return m.loading[len(m.loading)-1]
+}
+
+// packageOf 返回 file 所属的依赖，file 不在任何依赖中时返回 nil
+func (m *modules) packageOf(file string) *Package {
+	for _, pkg := range m.packages {
+		if within(pkg.Dir, file) {
+			return pkg
+		}
+	}
+	return nil
+}
+
+// rel 返回 file 相对于项目根目录的路径，依赖中的文件以依赖名开头，用于错误信息
+func (m *modules) rel(file string) string {
+	if pkg := m.packageOf(file); pkg != nil {
+		rel, _ := filepath.Rel(pkg.Dir, file)
+		return pkg.Name + "/" + filepath.ToSlash(rel)
+	}
+	if !within(m.root, file) {
+		return file
+	}
+	rel, _ := filepath.Rel(m.root, file)
+	return filepath.ToSlash(rel)
+}
+
+// within 判断 file 是否在目录 dir 中
+func within(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && filepath.IsLocal(rel)
+}
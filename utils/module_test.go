@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/environment"
+)
+
+// writeFiles 在 dir 下创建 files 中的文件
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	t.Setenv("KNIFE_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"knife.toml": "name = \"demo\"\n",
+		"lib/math.k": "export let ten = 10\nexport func add(a, b) {\n return a + b\n}\n" +
+			"func hidden() {\n return 1\n}\nexport func sub(a, b) {\n return a - b + hidden() - 1\n}\n",
+		"lib/twice.k": "import { add } from \"./math.k\"\nexport func twice(x) {\n return add(x, x)\n}\n",
+		"app/main.k": "import \"../lib/math.k\" as m\nimport { sub } from \"lib/math\"\nimport { twice } from \"lib/twice.k\"\n" +
+			"assert(m.add(1, 2) == 3)\nassert(sub(m.ten, 4) == 6)\nassert(twice(m.ten) == 20)\n",
+	})
+	for _, engine := range []string{EngineTree, EngineVM} {
+		if code, _, stderr := runMain("", "run", "--engine="+engine, filepath.Join(dir, "app", "main.k")); code != 0 {
+			t.Fatalf("%s: run failed: %s", engine, stderr)
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	t.Setenv("KNIFE_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.k":       "import \"./b.k\"\n",
+		"b.k":       "import \"./c.k\" as c\n",
+		"c.k":       "import { x } from \"./a.k\"\n",
+		"lib.k":     "export let x = 1\nlet y = 2\n",
+		"missing.k": "import { y } from \"./lib.k\"\n",
+		"member.k":  "import \"./lib.k\" as lib\nprint(lib.y)\n",
+		"nofile.k":  "import \"./nothing.k\"\n",
+		"broken.k":  "import \"./syntax.k\"\n",
+		"syntax.k":  "let = 1\n",
+	})
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"a.k", "循环导入: a.k -> b.k -> c.k -> a.k"},
+		{"missing.k", "line: 1, error: lib.k does not export y"},
+		{"member.k", "line: 2, error: lib.k does not export y"},
+		{"nofile.k", "模块不存在: nothing.k"},
+		{"broken.k", "syntax.k: parser error"},
+	}
+	for _, engine := range []string{EngineTree, EngineVM} {
+		for _, tt := range tests {
+			code, _, stderr := runMain("", "run", "--engine="+engine, filepath.Join(dir, tt.file))
+			if code != 1 || !strings.Contains(stderr, tt.expected) {
+				t.Errorf("%s %s: expected %q, got exit %d: %s", engine, tt.file, tt.expected, code, stderr)
+			}
+		}
+	}
+}
+
+// countingEngine 记录执行过的程序数
+type countingEngine struct {
+	engine
+	runs int
+}
+
+func (e *countingEngine) run(program *ast.Program, env *environment.Environment) error {
+	e.runs++
+	return e.engine.run(program, env)
+}
+
+func TestModuleCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"lib/math.k": "export let one = 1\n",
+		"lib/more.k": "import \"./math.k\" as math\nexport let two = math.one + 1\n",
+	})
+	tree, err := newEngine(RunOptions{}, filepath.Join(dir, "main.k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := &countingEngine{engine: tree}
+	m, err := newModules(filepath.Join(dir, "main.k"), counter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.(treeEngine).Importer = m
+
+	first, err := m.Import("./lib/math.k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Import("lib/more"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.Import("lib/math")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || counter.runs != 2 {
+		t.Fatalf("expected each module to run once, got %d runs", counter.runs)
+	}
+	if first.Path != "lib/math.k" || first.Exports["one"].Inspect() != "1" {
+		t.Fatalf("unexpected module %s with exports %v", first.Path, first.Exports)
+	}
+}
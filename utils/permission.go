@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/Serein-sz/knife/eval"
+)
+
+// capabilityFlag 对应一个 --allow-* 参数，不带值时授予全部权限，
+// 带值时按逗号分隔的路径限定范围，例如 --allow-read=./data，
+// 相对路径与 fs 内置函数的参数一样相对于入口文件所在的目录
+type capabilityFlag struct {
+	capability  eval.Capability
+	permissions *eval.Permissions
+	value       string
+}
+
+func (f *capabilityFlag) String() string {
+	return f.value
+}
+
+func (f *capabilityFlag) Set(value string) error {
+	f.value = value
+	if value == "true" || value == "" {
+		f.permissions.Allow(f.capability)
+		return nil
+	}
+	if value == "false" {
+		return nil
+	}
+	f.permissions.Allow(f.capability, strings.Split(value, ",")...)
+	return nil
+}
+
+func (f *capabilityFlag) IsBoolFlag() bool {
+	return true
+}
+
+type allowAllFlag struct {
+	permissions *eval.Permissions
+}
+
+func (f *allowAllFlag) String() string {
+	return ""
+}
+
+func (f *allowAllFlag) Set(value string) error {
+	if value == "true" {
+		f.permissions.AllowAll()
+	}
+	return nil
+}
+
+func (f *allowAllFlag) IsBoolFlag() bool {
+	return true
+}
+
+// BindPermissionFlags 注册 --allow-read、--allow-write、--allow-env、
+// --allow-exec、--allow-net、--allow-time 与 --allow-all 参数
+func BindPermissionFlags(fs *flag.FlagSet, p *eval.Permissions) {
+	flags := []struct {
+		name       string
+		capability eval.Capability
+		usage      string
+	}{
+		{"allow-read", eval.CapFSRead, "允许读取文件，可用逗号分隔的路径限定范围，相对路径相对于入口文件所在的目录"},
+		{"allow-write", eval.CapFSWrite, "允许写入文件，可用逗号分隔的路径限定范围，相对路径相对于入口文件所在的目录"},
+		{"allow-env", eval.CapEnv, "允许读取环境变量"},
+		{"allow-exec", eval.CapExec, "允许执行外部命令"},
+		{"allow-net", eval.CapNet, "允许访问网络"},
+		{"allow-time", eval.CapTime, "允许读取系统时间"},
+	}
+	for _, f := range flags {
+		fs.Var(&capabilityFlag{capability: f.capability, permissions: p}, f.name, f.usage)
+	}
+	fs.Var(&allowAllFlag{permissions: p}, "allow-all", "授予全部权限")
+}
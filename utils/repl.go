@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/eval"
+)
+
+const (
+	replPrompt         = ">> "
+	replContinuePrompt = ".. "
+	replHelp           = `:help          显示帮助
+:env           列出当前环境中的变量
+:load <file.k> 在当前环境中执行文件
+:reset         清空当前环境
+:history       显示编号的历史输入
+!!             重新执行上一条输入
+!<n>           重新执行编号为 n 的历史输入
+:quit          退出
+`
+)
+
+// DefaultHistoryPath 返回 REPL 历史记录文件的默认位置
+func DefaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".knife_history")
+}
+
+type repl struct {
+	out         io.Writer
+	engine      engine
+	env         *environment.Environment
+	interpreter *eval.Interpreter
+	modules     *modules
+	historyPath string
+	// history 为历史输入，启动时从 historyPath 读入，供 !! 和 !<n> 调用
+	history []string
+}
+
+// Repl 启动交互式解释器，所有输入共享同一个环境，
+// 括号或字符串未闭合时提示继续输入，historyPath 为空时不记录历史
+func Repl(in io.Reader, out io.Writer, historyPath string, permissions eval.Permissions) error {
+	// import 相对于当前目录查找
+	e, err := newEngine(RunOptions{Engine: EngineTree, Permissions: permissions, Stdout: out, Stderr: out}, "-")
+	if err != nil {
+		return err
+	}
+	r := &repl{
+		out:         out,
+		engine:      e,
+		env:         e.globals(),
+		interpreter: e.(treeEngine).Interpreter,
+		modules:     e.(treeEngine).Importer.(*modules),
+		historyPath: historyPath,
+		history:     loadHistory(historyPath),
+	}
+
+	scanner := bufio.NewScanner(in)
+	var input strings.Builder
+	for {
+		if input.Len() == 0 {
+			io.WriteString(out, replPrompt)
+		} else {
+			io.WriteString(out, replContinuePrompt)
+		}
+		if !scanner.Scan() {
+			io.WriteString(out, "\n")
+			return scanner.Err()
+		}
+		line := scanner.Text()
+		if input.Len() == 0 && isRecall(strings.TrimSpace(line)) {
+			entry, err := r.recall(strings.TrimSpace(line))
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			fmt.Fprintln(out, entry)
+			line = entry
+		}
+		if input.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			r.saveHistory(line)
+			if quit := r.command(strings.TrimSpace(line)); quit {
+				return nil
+			}
+			continue
+		}
+
+		input.WriteString(line)
+		input.WriteString("\n")
+		if incomplete(input.String()) {
+			continue
+		}
+		src := input.String()
+		input.Reset()
+		if strings.TrimSpace(src) == "" {
+			continue
+		}
+		r.saveHistory(strings.TrimRight(src, "\n"))
+		r.eval(src)
+	}
+}
+
+// isRecall 报告 line 是否为 !! 或 !<n>，其余以 ! 开头的输入（如 !x）按表达式求值
+func isRecall(line string) bool {
+	if line == "!!" {
+		return true
+	}
+	if len(line) < 2 || line[0] != '!' {
+		return false
+	}
+	for _, c := range line[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// recall 返回 !! 或 !<n> 所指的历史输入
+func (r *repl) recall(line string) (string, error) {
+	if len(r.history) == 0 {
+		return "", fmt.Errorf("没有历史输入")
+	}
+	if line == "!!" {
+		return r.history[len(r.history)-1], nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 || n > len(r.history) {
+		return "", fmt.Errorf("没有编号为 %s 的历史输入", line[1:])
+	}
+	return r.history[n-1], nil
+}
+
+func (r *repl) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case ":help":
+		io.WriteString(r.out, replHelp)
+	case ":env":
+		for _, id := range r.env.Names() {
+			obj, _ := r.env.Get(id)
+			fmt.Fprintf(r.out, "%s = %s\n", id, inspect(obj))
+		}
+	case ":load":
+		if arg == "" {
+			io.WriteString(r.out, "用法: :load <file.k>\n")
+			return false
+		}
+		if err := r.load(arg); err != nil {
+			fmt.Fprintf(r.out, "load err: %v\n", err)
+		}
+	case ":reset":
+		r.env = r.engine.globals()
+	case ":history":
+		for i, entry := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, strings.ReplaceAll(entry, "\n", "\n      "))
+		}
+	case ":quit", ":exit", ":q":
+		return true
+	default:
+		fmt.Fprintf(r.out, "未知命令: %s，输入 :help 查看帮助\n", name)
+	}
+	return false
+}
+
+// load 在当前环境中执行文件，其中的 import 和 fs 路径相对于该文件所在的目录
+func (r *repl) load(file string) error {
+	src, err := ReadFile(file)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	dir := r.interpreter.Dir
+	r.interpreter.Dir = filepath.Dir(abs)
+	r.modules.loading = append(r.modules.loading, abs)
+	defer func() {
+		r.interpreter.Dir = dir
+		r.modules.loading = r.modules.loading[:len(r.modules.loading)-1]
+	}()
+	r.eval(src)
+	return nil
+}
+
+func (r *repl) eval(src string) {
+	program, err := parseWith(src, append(predeclared(), r.env.Names()...)...)
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+		return
+	}
+	res, err := r.interpreter.Eval(context.Background(), program, r.env)
+	if err != nil {
+		fmt.Fprintf(r.out, "eval err: %v\n", strings.TrimRight(err.Error(), "\n"))
+		return
+	}
+	if len(program.Statements) == 0 {
+		return
+	}
+	if _, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement); !ok {
+		return
+	}
+	if res == nil || res.Type() == environment.NULL {
+		return
+	}
+	fmt.Fprintln(r.out, inspect(res))
+}
+
+func (r *repl) saveHistory(entry string) {
+	r.history = append(r.history, entry)
+	if r.historyPath == "" {
+		return
+	}
+	f, err := os.OpenFile(r.historyPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	io.WriteString(f, entry+"\n")
+}
+
+// loadHistory 读入历史记录文件，与输入时一样把未闭合的多行合为一条
+func loadHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var history []string
+	var entry strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if entry.Len() == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		if entry.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			history = append(history, line)
+			continue
+		}
+		entry.WriteString(line)
+		if incomplete(entry.String()) {
+			entry.WriteString("\n")
+			continue
+		}
+		history = append(history, entry.String())
+		entry.Reset()
+	}
+	if entry.Len() > 0 {
+		history = append(history, strings.TrimRight(entry.String(), "\n"))
+	}
+	return history
+}
+
+// incomplete 判断输入中是否有未闭合的括号或字符串
+func incomplete(src string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(src); i++ {
+		ch := src[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '"', '\'':
+			quote = ch
+		case '/':
+			if i+1 < len(src) && src[i+1] == '/' {
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+			}
+		case '(', '{', '[':
+			depth++
+		case ')', '}', ']':
+			depth--
+		}
+	}
+	return quote != 0 || depth > 0
+}
+
+func inspect(obj environment.Object) string {
+	if obj == nil {
+		return "null"
+	}
+	return strings.TrimRight(obj.Inspect(), "\n")
+}
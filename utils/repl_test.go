@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/eval"
+)
+
+func TestRepl(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.k")
+	if err := os.WriteFile(lib, []byte("let ten = 10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	history := filepath.Join(dir, "history")
+
+	input := strings.Join([]string{
+		"let a = 1",
+		"a + 2",
+		"func add(x, y) {",
+		"    return x + y",
+		"}",
+		"add(a, 4)",
+		":load " + lib,
+		"ten",
+		":env",
+		":reset",
+		":env",
+		":quit",
+	}, "\n")
+	var out bytes.Buffer
+	if err := Repl(strings.NewReader(input), &out, history, eval.Permissions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := out.String()
+	for _, want := range []string{">> 3\n", ".. .. >> 5\n", ">> 10\n", "a = 1\n", "ten = 10\n"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "a = 1\n") != 1 {
+		t.Fatalf("expected :reset to clear the environment, got:\n%s", got)
+	}
+
+	data, err := os.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "func add(x, y) {\n    return x + y\n}\n") {
+		t.Fatalf("unexpected history:\n%s", data)
+	}
+}
+
+func TestReplHistory(t *testing.T) {
+	history := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(history, []byte("let a = 1\nfunc f(x) {\n    return x * 2\n}\n:env\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := strings.Join([]string{":history", "!1", "!2", "f(a)", "!!", "!9", ":quit"}, "\n")
+	var out bytes.Buffer
+	if err := Repl(strings.NewReader(input), &out, history, eval.Permissions{}); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"   2  func f(x) {\n          return x * 2\n      }\n   3  :env\n",
+		">> let a = 1\n",
+		">> 2\n>> f(a)\n2\n",
+		"没有编号为 9 的历史输入",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestReplNotExpression(t *testing.T) {
+	input := strings.Join([]string{"!true", "let x = false", "!x", "!(1 == 2)", ":quit"}, "\n")
+	var out bytes.Buffer
+	if err := Repl(strings.NewReader(input), &out, filepath.Join(t.TempDir(), "history"), eval.Permissions{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := ">> false\n>> >> true\n>> true\n>> "
+	if got := out.String(); got != expected {
+		t.Fatalf("expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestReplLoadImports(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "lib")
+	files := map[string]string{
+		"main.k":   "import { two } from \"./two.k\"\nlet four = two + two\nlet data = fs.read(\"data.txt\")\n",
+		"two.k":    "export let two = 2\n",
+		"data.txt": "ok",
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var perms eval.Permissions
+	perms.Allow(eval.CapFSRead)
+	input := strings.Join([]string{":load " + filepath.Join(dir, "main.k"), "four", "data", ":quit"}, "\n")
+	var out bytes.Buffer
+	if err := Repl(strings.NewReader(input), &out, "", perms); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, ">> 4\n>> ok\n") {
+		t.Fatalf("expected :load to resolve paths against the file, got:\n%s", got)
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected bool
+	}{
+		{"let a = 1", false},
+		{"func f() {", true},
+		{"func f() {\n}", false},
+		{`print("abc`, true},
+		{`print("a{c")`, false},
+		{"print(1,", true},
+		{"print('a", true},
+		{"func f() { // {", true},
+		{"let a = 1 // (", false},
+	}
+	for i, tt := range tests {
+		if got := incomplete(tt.src); got != tt.expected {
+			t.Fatalf("tests[%d] - expected=%v, got=%v", i, tt.expected, got)
+		}
+	}
+}
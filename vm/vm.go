@@ -0,0 +1,375 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/compiler"
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/eval"
+)
+
+// VM executes Bytecode with a value stack and a frame per call. Frames are
+// environments, so closures, globals and builtins behave as they do in the
+// evaluator.
+type VM struct {
+	// Limits are enforced as by the evaluator, except that MaxSteps counts
+	// instructions.
+	Limits      eval.Limits
+	Permissions eval.Permissions
+	// Importer loads the modules of import statements; without one they
+	// fail.
+	Importer eval.Importer
+	// Stdout and Stderr receive what scripts print; nil means os.Stdout
+	// and os.Stderr.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Dir is the directory the fs builtins resolve relative paths
+	// against; empty means the working directory.
+	Dir string
+	// Builtins holds the host functions only this VM exposes.
+	Builtins eval.Builtins
+
+	stack  []environment.Object
+	frames []frame
+
+	ctx   context.Context
+	done  <-chan struct{}
+	steps int
+}
+
+type frame struct {
+	fn  *environment.CompiledFunction
+	env *environment.Environment
+	ip  int
+	// base is the stack height when the frame was entered.
+	base int
+}
+
+func New() *VM {
+	return &VM{Limits: eval.Limits{MaxDepth: eval.DefaultMaxDepth}}
+}
+
+// Run executes bytecode with env as its global environment and returns the
+// value of its last statement. Modules run while importing share the
+// limits of the program importing them.
+func (vm *VM) Run(ctx context.Context, bytecode *compiler.Bytecode, env *environment.Environment) (environment.Object, error) {
+	vm.start(ctx)
+	base, height := len(vm.frames), len(vm.stack)
+	vm.frames = append(vm.frames, frame{fn: bytecode.Main, env: env, base: height})
+	res, err := vm.run(base)
+	vm.frames = vm.frames[:base]
+	vm.stack = vm.stack[:height]
+	return res, err
+}
+
+// Call invokes a closure or builtin with args, as a call expression in a
+// script would.
+func (vm *VM) Call(ctx context.Context, fn environment.Object, args ...environment.Object) (environment.Object, error) {
+	vm.start(ctx)
+	return vm.callValue(fn, args, 0, ast.Span{})
+}
+
+// callValue calls fn on top of the running frames, if any, and returns
+// once it has. line and span locate the call site.
+func (vm *VM) callValue(fn environment.Object, args []environment.Object, line int, span ast.Span) (environment.Object, error) {
+	base, height := len(vm.frames), len(vm.stack)
+	vm.stack = append(vm.stack, fn)
+	vm.stack = append(vm.stack, args...)
+	entered, err := vm.call(len(args), line, span)
+	var res environment.Object
+	switch {
+	case err != nil:
+	case entered:
+		res, err = vm.run(base)
+	default:
+		res = vm.pop()
+	}
+	vm.frames = vm.frames[:base]
+	vm.stack = vm.stack[:height]
+	return res, err
+}
+
+func (vm *VM) start(ctx context.Context) {
+	if len(vm.frames) > 0 {
+		return
+	}
+	vm.ctx = ctx
+	vm.done = ctx.Done()
+	vm.steps = 0
+}
+
+func (vm *VM) push(obj environment.Object) {
+	vm.stack = append(vm.stack, obj)
+}
+
+func (vm *VM) pop() environment.Object {
+	if len(vm.stack) == 0 {
+		return nil
+	}
+	obj := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return obj
+}
+
+// run executes until the frames above base have returned and yields the
+// value returned by the last of them.
+func (vm *VM) run(base int) (environment.Object, error) {
+	res, ip, err := vm.loop(base)
+	if err != nil {
+		return nil, vm.unwind(err, ip, base)
+	}
+	return res, nil
+}
+
+// unwind wraps err, raised by the instruction at ip of the top frame, for
+// every call argument it happened in, as the evaluator does while
+// returning from nested argument evaluations.
+func (vm *VM) unwind(err error, ip int, base int) error {
+	for i := len(vm.frames) - 1; i >= base; i-- {
+		f := vm.frames[i]
+		if i < len(vm.frames)-1 {
+			// the frame is suspended after its OpCall
+			ip = f.ip - 2
+		}
+		for _, a := range f.fn.Arguments {
+			if a.Start <= ip && ip < a.End {
+				err = fmt.Errorf("line: %d, error: passing exp error: [%s]%w", a.Line, a.Source, err)
+			}
+		}
+	}
+	return err
+}
+
+func (vm *VM) loop(base int) (environment.Object, int, error) {
+	for {
+		f := &vm.frames[len(vm.frames)-1]
+		ins, constants := f.fn.Instructions, f.fn.Constants
+		ip := f.ip
+		op := compiler.Opcode(ins[ip])
+		f.ip++
+
+		vm.steps++
+		if vm.steps&1023 == 0 {
+			select {
+			case <-vm.done:
+				return nil, ip, fmt.Errorf("execution stopped: %w", vm.ctx.Err())
+			default:
+			}
+		}
+		if vm.Limits.MaxSteps > 0 && vm.steps > vm.Limits.MaxSteps {
+			return nil, ip, fmt.Errorf("%w: %d", eval.ErrStepLimit, vm.Limits.MaxSteps)
+		}
+
+		switch op {
+		case compiler.OpConstant:
+			obj := constants[compiler.ReadUint16(ins[ip+1:])]
+			f.ip += 2
+			if err := vm.Limits.CheckAlloc(obj); err != nil {
+				return nil, ip, err
+			}
+			vm.push(obj)
+		case compiler.OpNull:
+			vm.push(eval.NULL)
+		case compiler.OpTrue:
+			vm.push(eval.TRUE)
+		case compiler.OpFalse:
+			vm.push(eval.FALSE)
+		case compiler.OpPop:
+			vm.pop()
+		case compiler.OpGetLocal:
+			depth, slot := int(ins[ip+1]), int(compiler.ReadUint16(ins[ip+2:]))
+			f.ip += 5
+			if obj := f.env.Outer(depth).Slot(slot); obj != nil {
+				vm.push(obj)
+				break
+			}
+			name := constants[compiler.ReadUint16(ins[ip+4:])].(*environment.String).Value
+			b, ok := vm.Builtins.Lookup(name)
+			if !ok {
+				return nil, ip, fmt.Errorf("line: %d, error: undefined identifier: %s\n", f.fn.Line(ip), name)
+			}
+			vm.push(b)
+		case compiler.OpSetLocal:
+			f.env.SetSlot(int(compiler.ReadUint16(ins[ip+1:])), vm.pop())
+			f.ip += 2
+		case compiler.OpGetGlobal:
+			depth := int(ins[ip+1])
+			name := constants[compiler.ReadUint16(ins[ip+2:])].(*environment.String).Value
+			f.ip += 3
+			if obj, ok := f.env.Outer(depth).Find(name); ok {
+				vm.push(obj)
+			} else if b, ok := vm.Builtins.Lookup(name); ok {
+				vm.push(b)
+			} else {
+				return nil, ip, fmt.Errorf("line: %d, error: undefined identifier: %s\n", f.fn.Line(ip), name)
+			}
+		case compiler.OpSetGlobal:
+			name := constants[compiler.ReadUint16(ins[ip+1:])].(*environment.String).Value
+			f.ip += 2
+			f.env.Set(name, vm.pop())
+		case compiler.OpAdd, compiler.OpSub, compiler.OpMul, compiler.OpDiv,
+			compiler.OpEqual, compiler.OpNotEqual,
+			compiler.OpLess, compiler.OpLessEqual, compiler.OpGreater, compiler.OpGreaterEqual:
+			rhs := vm.pop()
+			lhs := vm.pop()
+			res, err := eval.Infix(operators[op], lhs, rhs)
+			if err != nil {
+				return nil, ip, err
+			}
+			if err := vm.Limits.CheckAlloc(res); err != nil {
+				return nil, ip, err
+			}
+			vm.push(res)
+		case compiler.OpMinus, compiler.OpBang:
+			prefix := "-"
+			if op == compiler.OpBang {
+				prefix = "!"
+			}
+			res, err := eval.Prefix(prefix, vm.pop())
+			if err != nil {
+				return nil, ip, err
+			}
+			vm.push(res)
+		case compiler.OpJump:
+			f.ip = int(compiler.ReadUint16(ins[ip+1:]))
+		case compiler.OpJumpNotTruthy:
+			if eval.Truthy(vm.pop()) {
+				f.ip += 2
+			} else {
+				f.ip = int(compiler.ReadUint16(ins[ip+1:]))
+			}
+		case compiler.OpClosure:
+			fn := constants[compiler.ReadUint16(ins[ip+1:])].(*environment.CompiledFunction)
+			f.ip += 2
+			vm.push(&environment.Closure{Fn: fn, Env: f.env})
+		case compiler.OpCall:
+			argc := int(ins[ip+1])
+			f.ip++
+			if _, err := vm.call(argc, f.fn.Line(ip), callSpan(f.fn, ip)); err != nil {
+				return nil, ip, err
+			}
+		case compiler.OpImport:
+			path := constants[compiler.ReadUint16(ins[ip+1:])].(*environment.String).Value
+			f.ip += 2
+			m, err := eval.Import(vm.Importer, f.fn.Line(ip), path)
+			if err != nil {
+				return nil, ip, err
+			}
+			vm.push(m)
+		case compiler.OpMember:
+			name := constants[compiler.ReadUint16(ins[ip+1:])].(*environment.String).Value
+			f.ip += 2
+			obj, err := eval.Member(vm.pop(), name, f.fn.Line(ip))
+			if err != nil {
+				return nil, ip, err
+			}
+			vm.push(obj)
+		case compiler.OpTailCall:
+			argc := int(ins[ip+1])
+			f.ip++
+			if fn, ok := vm.stack[len(vm.stack)-1-argc].(*environment.Closure); ok {
+				// reuse the frame, so tail calls take no depth
+				if argc != fn.Fn.Parameters {
+					return nil, ip, fmt.Errorf("line: %d, error: expected %d arguments, got %d\n", f.fn.Line(ip), fn.Fn.Parameters, argc)
+				}
+				env := environment.NewFrame(fn.Env, fn.Fn.Locals)
+				for i, a := range vm.stack[len(vm.stack)-argc:] {
+					env.SetSlot(i, a)
+				}
+				vm.stack = vm.stack[:f.base]
+				f.fn, f.env, f.ip = fn.Fn, env, 0
+				break
+			}
+			if _, err := vm.call(argc, f.fn.Line(ip), callSpan(f.fn, ip)); err != nil {
+				return nil, ip, err
+			}
+			fallthrough
+		case compiler.OpReturn:
+			value := vm.pop()
+			vm.stack = vm.stack[:f.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == base {
+				return value, 0, nil
+			}
+			vm.push(value)
+		default:
+			return nil, ip, fmt.Errorf("unknown opcode %d", op)
+		}
+	}
+}
+
+// call calls the function below the argc arguments on top of the stack.
+// Builtins are called right away and leave their result on the stack;
+// closures push a frame, reported by entered.
+func (vm *VM) call(argc int, line int, span ast.Span) (entered bool, err error) {
+	callee := vm.stack[len(vm.stack)-1-argc]
+	args := vm.stack[len(vm.stack)-argc:]
+	switch fn := callee.(type) {
+	case *environment.Closure:
+		if argc != fn.Fn.Parameters {
+			return false, fmt.Errorf("line: %d, error: expected %d arguments, got %d\n", line, fn.Fn.Parameters, argc)
+		}
+		if vm.Limits.MaxDepth > 0 && len(vm.frames) > vm.Limits.MaxDepth {
+			return false, fmt.Errorf("line: %d, error: %w: %d", line, eval.ErrDepthLimit, vm.Limits.MaxDepth)
+		}
+		env := environment.NewFrame(fn.Env, fn.Fn.Locals)
+		for i, a := range args {
+			env.SetSlot(i, a)
+		}
+		vm.stack = vm.stack[:len(vm.stack)-1-argc]
+		vm.frames = append(vm.frames, frame{fn: fn.Fn, env: env, base: len(vm.stack)})
+		return true, nil
+	case *environment.Builtin:
+		res, err := eval.CallBuiltin(fn, &environment.CallContext{
+			Caller:     caller{vm, line, span},
+			Span:       span,
+			Stdout:     vm.Stdout,
+			Stderr:     vm.Stderr,
+			Dir:        vm.Dir,
+			CheckAlloc: vm.Limits.CheckSize,
+			Args:       append([]environment.Object(nil), args...),
+		}, &vm.Permissions)
+		if err != nil {
+			return false, err
+		}
+		if err := vm.Limits.CheckAlloc(res); err != nil {
+			return false, err
+		}
+		vm.stack = vm.stack[:len(vm.stack)-1-argc]
+		vm.push(res)
+		return false, nil
+	}
+	return false, fmt.Errorf("%v is not callable", callee.Inspect())
+}
+
+// callSpan returns the source range of the call instruction of fn at ip,
+// falling back to its line for bytecode without call sites.
+func callSpan(fn *environment.CompiledFunction, ip int) ast.Span {
+	if span := fn.CallSpan(ip); span.Start.Line != 0 {
+		return span
+	}
+	return ast.Span{Start: ast.Position{Line: fn.Line(ip)}}
+}
+
+// caller calls back into the VM from a builtin called at span.
+type caller struct {
+	vm   *VM
+	line int
+	span ast.Span
+}
+
+func (c caller) Call(fn environment.Object, args ...environment.Object) (environment.Object, error) {
+	return c.vm.callValue(fn, args, c.line, c.span)
+}
+
+// operators maps the infix opcodes back to their operator.
+var operators [256]string
+
+func init() {
+	for s, op := range compiler.Operators {
+		operators[op] = s
+	}
+}
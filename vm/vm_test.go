@@ -0,0 +1,361 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Serein-sz/knife/ast"
+	"github.com/Serein-sz/knife/compiler"
+	"github.com/Serein-sz/knife/environment"
+	"github.com/Serein-sz/knife/eval"
+	"github.com/Serein-sz/knife/lexer"
+	"github.com/Serein-sz/knife/parser"
+	"github.com/Serein-sz/knife/resolver"
+)
+
+func parse(t testing.TB, src string) (*ast.Program, error) {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+	r := resolver.New(eval.BuiltinNames()...)
+	r.Resolve(program)
+	return program, r.Error()
+}
+
+// engines runs program with the evaluator and with the VM and returns the
+// output, both streams together, and error of each.
+func engines(t *testing.T, program *ast.Program) (tree, vm [2]string) {
+	t.Helper()
+	var out bytes.Buffer
+	in := eval.New()
+	in.Stdout, in.Stderr = &out, &out
+	_, err := in.Eval(context.Background(), program, environment.NewEnvironment(nil))
+	tree = [2]string{out.String(), errString(err)}
+
+	out.Reset()
+	bytecode, err := compiler.Compile(program)
+	if err == nil {
+		machine := New()
+		machine.Stdout, machine.Stderr = &out, &out
+		_, err = machine.Run(context.Background(), bytecode, environment.NewEnvironment(nil))
+	}
+	vm = [2]string{out.String(), errString(err)}
+	return tree, vm
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// unparsable lists the files of the example corpus that are not Knife
+// programs and are expected not to parse.
+var unparsable = map[string]string{
+	"lexer.k": "token fixture of the lexer tests, with function literals",
+}
+
+func TestCorpus(t *testing.T) {
+	err := filepath.Walk("../example", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".k") {
+			return err
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel("../example", path)
+		program, err := parse(t, string(src))
+		if _, skip := unparsable[filepath.ToSlash(rel)]; skip {
+			if err == nil {
+				t.Errorf("%s parses now, remove it from unparsable", path)
+			}
+			return nil
+		}
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			return nil
+		}
+		tree, vm := engines(t, program)
+		if tree != vm {
+			t.Errorf("%s: engines differ\ntree: %q\nvm:   %q", path, tree, vm)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSameAsEvaluator(t *testing.T) {
+	tests := []string{
+		`print(1 + 2 * 3, 10 / 4, 10.0 / 4, "a" + "b")`,
+		`print(if (1 < 2) { "yes" } else { "no" }, if (false) { 1 })`,
+		"func f(n) {\n if (n == 0) { return \"done\" }\n return f(n - 1)\n}\nprint(f(50))",
+		"func f() {\n let a = 1\n}\nprint(f())",
+		"func f(a, b) {\n return a\n}\nf(1)",
+		"let a = 1\nprint(a + \"s\")",
+		"print(-\"s\")",
+		"let a = 1\na(2)",
+		"print(assert(1 == 2, \"oops\"))",
+		"func f(x) {\n return x + \"s\"\n}\nprint(1, f(f(1)))",
+		"func outer() {\n func inner() {\n return later\n }\n let r = inner()\n let later = 1\n return r\n}\nouter()",
+		"func f(n) {\n if (n > 0) {\n return f(n - 1)\n } else {\n return g(n)\n }\n}\nfunc g(a, b) {\n return a\n}\nprint(f(3))",
+		"func f(x) {\n return print(x)\n}\nprint(f(\"s\"))",
+		"func f() {\n return 1(2)\n}\nprint(f())",
+		"func d(x) {\n return x * 2\n}\nfunc add(a, b) {\n return a + b\n}\nprint(map(range(3), d), reduce(range(4), add), sort(range(3), add))",
+		"func scale(k) {\n func by(x) {\n return x * k\n }\n return by\n}\nprint(map(range(3), scale(10)), map(array(\"ab\"), len))",
+		"func rows(n) {\n func row(i) {\n return range(i)\n }\n return map(range(n), row)\n}\nprint(flatten(rows(4)))",
+		"func f(a, b) {\n return a\n}\nprint(map(range(2), f))",
+		"func bad(a, b) {\n return -\"s\"\n}\nprint(1, sort(range(3), bad))",
+		"func g(x) {\n return map(range(x), g)\n}\nprint(g(3))",
+		"print()\nprintln(1, \"a\", array(2))\neprint(\"e\")\nprintf(\"%d|%5.2f|%s|%v|%t|%x\", 42, 1.5, \"s\", array(1), true, 255)",
+		"printf(1)",
+		"let v = json.parse('{\"a\": [1, 2.5, 123456789012345678901234567890], \"b\": null}')\nprint(v, json.stringify(v), json.stringify(v, 2))",
+		"print(json.parse('[1,'))",
+		"print(json.stringify(array(len)))",
+		"print(fs.exists(\"vm_test.go\"))",
+		"let r = re(\"(?P<k>[a-z]+)=([0-9]+)\")\nfunc f(m) {\n return get(get(m, \"named\"), \"k\")\n}\nprint(r.find(\"a=1 b=2\"), r.replace(\"a=1 b=2\", f), r.split(\"x a=1 y\"), r.nothing)",
+		"print(re(\"(\"))",
+	}
+	for _, src := range tests {
+		program, err := parse(t, src)
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		tree, vm := engines(t, program)
+		if tree != vm {
+			t.Errorf("%q: engines differ\ntree: %q\nvm:   %q", src, tree, vm)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	program, err := parse(t, "func f(n) {\n return f(n + 1) + 1\n}\nf(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := New()
+	vm.Limits.MaxDepth = 100
+	_, err = vm.Run(context.Background(), bytecode, environment.NewEnvironment(nil))
+	if !errors.Is(err, eval.ErrDepthLimit) || !strings.HasPrefix(err.Error(), "line: 2, ") {
+		t.Fatalf("expected a depth limit error, got %v", err)
+	}
+
+	vm = New()
+	vm.Limits = eval.Limits{MaxSteps: 1000}
+	_, err = vm.Run(context.Background(), bytecode, environment.NewEnvironment(nil))
+	if !errors.Is(err, eval.ErrStepLimit) {
+		t.Fatalf("expected a step limit error, got %v", err)
+	}
+
+	program, err = parse(t, "func double(s, n) {\n if (n == 0) { return s }\n return double(s + s, n - 1)\n}\ndouble(\"ab\", 10)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	concat, err := compiler.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm = New()
+	vm.Limits = eval.Limits{MaxAlloc: 16}
+	_, err = vm.Run(context.Background(), concat, environment.NewEnvironment(nil))
+	if !errors.Is(err, eval.ErrAllocLimit) {
+		t.Fatalf("expected an allocation limit error building a string, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	vm = New()
+	vm.Limits = eval.Limits{}
+	_, err = vm.Run(ctx, bytecode, environment.NewEnvironment(nil))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+}
+
+func TestBuiltinErrorSpan(t *testing.T) {
+	program, err := parse(t, "let n = 1\n  len(n)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New().Run(context.Background(), bytecode, environment.NewEnvironment(nil))
+	var builtinErr *environment.BuiltinError
+	if !errors.As(err, &builtinErr) {
+		t.Fatalf("expected a builtin error, got %v", err)
+	}
+	expected := ast.Span{Start: ast.Position{Line: 2, Column: 3}, End: ast.Position{Line: 2, Column: 9}}
+	if builtinErr.Span != expected {
+		t.Fatalf("expected the error at %v, got %v", expected, builtinErr.Span)
+	}
+}
+
+func TestCallbackLimits(t *testing.T) {
+	program, err := parse(t, "func f(x) {\n return map(range(100), f)\n}\nf(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := New()
+	vm.Limits = eval.Limits{MaxSteps: 10000, MaxDepth: 100}
+	_, err = vm.Run(context.Background(), bytecode, environment.NewEnvironment(nil))
+	if !errors.Is(err, eval.ErrDepthLimit) {
+		t.Fatalf("expected a depth limit error, got %v", err)
+	}
+	if len(vm.stack) != 0 || len(vm.frames) != 0 {
+		t.Fatalf("expected the VM to unwind, got %d values and %d frames", len(vm.stack), len(vm.frames))
+	}
+}
+
+func TestTailCall(t *testing.T) {
+	n := "10000000"
+	if testing.Short() {
+		n = "100000"
+	}
+	program, err := parse(t, "func loop(n) {\n if (n == 0) { return 0 }\n return loop(n - 1)\n}\nloop("+n+")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := New()
+	vm.Limits.MaxDepth = 100
+	res, err := vm.Run(context.Background(), bytecode, environment.NewEnvironment(nil))
+	if err != nil || res.Inspect() != "0" {
+		t.Fatalf("expected 0, got %v, %v", res, err)
+	}
+	if len(vm.stack) != 0 {
+		t.Fatalf("expected an empty stack, got %d values", len(vm.stack))
+	}
+}
+
+func TestCall(t *testing.T) {
+	program, err := parse(t, "let base = 10\nfunc add(a, b) {\n return base + a + b\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := environment.NewEnvironment(nil)
+	vm := New()
+	if _, err := vm.Run(context.Background(), bytecode, env); err != nil {
+		t.Fatal(err)
+	}
+	add, _ := env.Get("add")
+	res, err := vm.Call(context.Background(), add, &environment.Number{Value: "1"}, &environment.Number{Value: "2"})
+	if err != nil || res.Inspect() != "13" {
+		t.Fatalf("expected 13, got %v, %v", res, err)
+	}
+	if _, err := vm.Call(context.Background(), add); err == nil {
+		t.Fatalf("expected an arity error")
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	vm := New()
+	vm.Builtins.RegisterFunc("repeat", strings.Repeat)
+	p := parser.New(lexer.New("func twice(s) {\n return repeat(s, 2)\n}\ntwice(\"ab\")"))
+	program := p.ParseProgram()
+	r := resolver.New(append(eval.BuiltinNames(), vm.Builtins.Names()...)...)
+	r.Resolve(program)
+	if err := r.Error(); err != nil {
+		t.Fatal(err)
+	}
+	bytecode, err := compiler.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := vm.Run(context.Background(), bytecode, environment.NewEnvironment(nil))
+	if err != nil || res.Inspect() != "abab" {
+		t.Fatalf("expected abab, got %v, %v", res, err)
+	}
+	_, err = New().Run(context.Background(), bytecode, environment.NewEnvironment(nil))
+	if err == nil || !strings.Contains(err.Error(), "undefined identifier: repeat") {
+		t.Fatalf("expected repeat to be undefined in another VM, got %v", err)
+	}
+}
+
+func BenchmarkFib25(b *testing.B) {
+	program, err := parse(b, "func fib(n) {\n if (n < 2) { return n }\n return fib(n - 1) + fib(n - 2)\n}\nfib(25)")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("tree", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := eval.Eval(context.Background(), program, environment.NewEnvironment(nil)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("vm", func(b *testing.B) {
+		bytecode, err := compiler.Compile(program)
+		if err != nil {
+			b.Fatal(err)
+		}
+		vm := New()
+		for i := 0; i < b.N; i++ {
+			if _, err := vm.Run(context.Background(), bytecode, environment.NewEnvironment(nil)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// FuzzReadFile checks that the VM reports errors instead of panicking on
+// any bytecode ReadFile accepts.
+func FuzzReadFile(f *testing.F) {
+	for _, src := range []string{
+		"let a = 1\nprint(a + 2)",
+		"func f(x) {\n func g() {\n  return x\n }\n return g()\n}\nprint(f(1))",
+		"func f(n) {\n if (n < 1) { return 0 }\n return f(n - 1)\n}\nf(3)",
+	} {
+		program, err := parse(f, src)
+		if err != nil {
+			f.Fatal(err)
+		}
+		bytecode, err := compiler.Compile(program)
+		if err != nil {
+			f.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := compiler.WriteFile(&buf, &compiler.File{Bytecode: bytecode}); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, err := compiler.ReadFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		machine := New()
+		machine.Stdout, machine.Stderr = io.Discard, io.Discard
+		machine.Limits = eval.Limits{MaxSteps: 10000, MaxDepth: 100, MaxAlloc: 1000}
+		machine.Run(context.Background(), file.Bytecode, environment.NewEnvironment(nil))
+	})
+}